@@ -0,0 +1,55 @@
+// registrymock — мок реестра налогоплательщиков для разработки и стендов.
+// Отдаёт компании из JSON-файла по протоколу, который ожидает сервер
+// при COMPANY_REGISTRY_URL: GET /companies/{tax_id}.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/pkg/registry"
+)
+
+const usage = `usage: registrymock -file companies.json [-addr :8090] [-latency 0s]
+
+The file is a JSON array: [{"tax_id": "301234567", "name": "OOO Vipos", "active": true}]
+
+flags:`
+
+func main() {
+	flags := flag.NewFlagSet("registrymock", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	addr := flags.String("addr", ":8090", "listen address")
+	file := flags.String("file", "", "registry file (required)")
+	latency := flags.Duration("latency", 0, "artificial delay before every response")
+	flags.Parse(os.Args[1:])
+
+	if *file == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	reg, err := registry.NewFileRegistry(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handler := registry.Handler(reg)
+	if *latency > 0 {
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(*latency)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	log.Printf("serving %d companies from %s on %s", reg.Len(), *file, *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
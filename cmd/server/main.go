@@ -11,20 +11,25 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 	_ "github.com/idkOybek/newNewTerminal/docs"
 	"github.com/idkOybek/newNewTerminal/internal/config"
 	"github.com/idkOybek/newNewTerminal/internal/handler"
+	"github.com/idkOybek/newNewTerminal/internal/metrics"
 	customMiddleware "github.com/idkOybek/newNewTerminal/internal/middleware"
+	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/internal/scheduler"
 	"github.com/idkOybek/newNewTerminal/internal/service"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
 	"github.com/idkOybek/newNewTerminal/pkg/database"
+	"github.com/idkOybek/newNewTerminal/pkg/delivery"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/mail"
+	"github.com/idkOybek/newNewTerminal/pkg/notify"
+	"github.com/idkOybek/newNewTerminal/pkg/ratelimit"
+	"github.com/idkOybek/newNewTerminal/pkg/registry"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
 	httpSwagger "github.com/swaggo/http-swagger"
-
-	_ "github.com/idkOybek/newNewTerminal/internal/repository/postgres"
-
-	"go.uber.org/zap"
 )
 
 // @title Terminal Backend
@@ -57,49 +62,180 @@ func main() {
 		log.Fatalf("Failed to create logger: %v", err)
 	}
 
+	// Tracing должен быть настроен до открытия БД: драйвер оборачивается в спаны
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		ServiceName: "terminal-backend",
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		logger.Fatalw("Failed to set up tracing", "error", err)
+	}
+
 	// Connect to database
-	db, err := database.NewPostgresDB(cfg.DatabaseURL)
+	db, err := database.NewPostgresDB(cfg.DB.DatabaseURL, cfg.DB.Pool())
 	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
+		logger.Fatalw("Failed to connect to database", "error", err)
 	}
 	defer db.Close()
 
 	if err := db.Ping(); err != nil {
-		logger.Fatal("Failed to ping database", zap.Error(err))
+		logger.Fatalw("Failed to ping database", "error", err)
+	}
+
+	// server migrate <command> управляет схемой и завершается
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), db, logger, os.Args[2:]); err != nil {
+			db.Close()
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	migrator, err := prepareSchema(context.Background(), db, logger, cfg)
+	if err != nil {
+		logger.Fatalw("Database schema is not ready", "error", err)
 	}
 
 	// Initialize repositories
 	repos := repository.NewRepositories(db, logger)
 
+	// Report delivery targets
+	mailer := mail.NewMailer(cfg.SMTP.Mail())
+	deliverers := map[string]delivery.Deliverer{
+		models.DeliveryTypeDirectory: delivery.NewDirectoryDeliverer(cfg.Export.ReportsDir),
+		models.DeliveryTypeWebhook:   delivery.NewWebhookDeliverer(30 * time.Second),
+	}
+	if mailer.Configured() {
+		deliverers[models.DeliveryTypeEmail] = delivery.NewEmailDeliverer(mailer)
+	}
+
+	companyRegistry, err := registry.Open(cfg.Company.Registry, cfg.Company.RegistryTimeout)
+	if err != nil {
+		logger.Fatalw("Failed to open company registry", "error", err)
+	}
+
+	tokens := auth.NewManager(cfg.JWT.Keys())
+
+	// Письма со ссылками сброса пароля и подтверждения почты
+	var notifier notify.Notifier
+	switch cfg.Account.Notifier {
+	case "smtp":
+		notifier = notify.NewSMTPNotifier(mailer)
+	case "file":
+		notifier = notify.NewFileNotifier(cfg.Account.NotifyDir)
+	default:
+		notifier = notify.NewLogNotifier(logger)
+	}
+	if cfg.Account.Notifier != "smtp" {
+		logger.Warnw("Account emails are not sent, links with tokens are stored locally", "notifier", cfg.Account.Notifier)
+	}
+
+	breached, err := cfg.Password.Breached()
+	if err != nil {
+		logger.Fatalw("Failed to load breached password list", "error", err)
+	}
+	if breached != nil {
+		logger.Infow("Loaded breached password list", "entries", breached.Len())
+	}
+
 	// Initialize services
 	services := service.NewServices(service.Deps{
-		Repos:  repos,
-		Logger: logger,
+		Repos:               repos,
+		Logger:              logger,
+		Deliverers:          deliverers,
+		Tokens:              tokens,
+		Lockout:             cfg.Lockout.Policy(),
+		TwoFactor:           cfg.TwoFactor.Policy(),
+		Notifier:            notifier,
+		Account:             cfg.Account.Policy(),
+		Password:            cfg.Password.Policy(),
+		BreachedPasswords:   breached,
+		PublicBaseURL:       cfg.Export.PublicBaseURL,
+		UserDeletePolicy:    cfg.UserDeletePolicy,
+		SoftDeleteRetention: cfg.Scheduler.SoftDeleteRetention,
+		Registry:            companyRegistry,
+		CompanyCheck:        cfg.Company.Check,
+		IdempotencyTTL:      cfg.IdempotencyTTL,
+		TerminalStaleAfter:  cfg.Metrics.TerminalStaleAfter,
+		DB:                  db,
+		Schema:              migrator,
 	})
+	appMetrics := metrics.New(db)
 
 	// Initialize handlers
-	authHandler := handler.NewAuthHandler(services.Auth, logger)
+	authHandler := handler.NewAuthHandler(services.Auth, services.Account, logger)
+	twoFactorHandler := handler.NewTwoFactorHandler(services.TwoFactor, logger)
 	userHandler := handler.NewUserHandler(services.User, logger)
 	fiscalModuleHandler := handler.NewFiscalModuleHandler(services.FiscalModule, logger)
-	terminalHandler := handler.NewTerminalHandler(services.Terminal, logger)
-	exportHandler := handler.NewExportHandler(logger, services.User)
+	terminalHandler := handler.NewTerminalHandler(services.Terminal, services.Document, services.Export, logger)
+	exportHandler := handler.NewExportHandler(logger, services.User, services.Export, services.Document)
+	reportHandler := handler.NewReportHandler(services.Report, logger)
+	companyHandler := handler.NewCompanyHandler(services.Company, logger)
+	healthHandler := handler.NewHealthHandler(services.Health)
+
+	// Настройки с тегом reload применяются без перезапуска: по SIGHUP
+	// и раз в CONFIG_RELOAD_INTERVAL (так подхватываются обновлённые *_FILE)
+	reloader := config.NewReloader(cfg, logger)
+	corsPolicy := customMiddleware.NewCORS(cfg.CORS.AllowedOrigins)
+	reloader.OnReload(func(prev, next config.Config) {
+		if next.LogLevel != prev.LogLevel {
+			if err := logger.SetLevel(next.LogLevel); err != nil {
+				logger.Errorw("Failed to apply LOG_LEVEL", "error", err)
+			}
+		}
+		corsPolicy.SetOrigins(next.CORS.AllowedOrigins)
+		tokens.SetKeys(next.JWT.Keys())
+		next.DB.Pool().Apply(db)
+	})
+
+	adminHandler := handler.NewAdminHandler(func() map[string]interface{} {
+		return reloader.Current().Redacted()
+	}, logger)
+
+	// Повтор POST с тем же Idempotency-Key получает сохранённый ответ
+	idempotency := func(next http.Handler) http.Handler { return next }
+	if services.Idempotency.Enabled() {
+		idempotency = customMiddleware.Idempotency(services.Idempotency, logger)
+	}
+
+	// Счётчики в памяти годятся для одного экземпляра; несколько реплик делят их через Postgres
+	var rateStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "postgres" {
+		rateStore = repos.RateLimit
+	}
+	limiter := ratelimit.NewLimiter(rateStore)
+	terminalHandler.LimitStatusChecks(customMiddleware.RateLimit(limiter, "terminal_status", cfg.RateLimit.TerminalStatusRules(), logger))
 
 	// Set up router
 	r := chi.NewRouter()
 
 	// Middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	if cfg.HTTP.TrustProxyHeaders {
+		r.Use(middleware.RealIP)
+	}
+	r.Use(customMiddleware.RequestID)
+	r.Use(customMiddleware.TracingMiddleware)
+	r.Use(appMetrics.Middleware)
 	r.Use(customMiddleware.LoggerMiddleware(logger))
+	r.Use(middleware.Recoverer)
 
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	}))
+	r.Use(corsPolicy.Handler())
+
+	// Metrics
+	var metricsSrv *http.Server
+	if cfg.Metrics.Addr == "" {
+		r.Handle("/metrics", appMetrics.Handler())
+	} else {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", appMetrics.Handler())
+		metricsSrv = &http.Server{Addr: cfg.Metrics.Addr, Handler: metricsMux}
+	}
+
+	// Health checks
+	r.Get("/healthz", healthHandler.Healthz)
+	r.Get("/readyz", healthHandler.Readyz)
+	r.Get("/version", healthHandler.Version)
 
 	// Swagger
 	r.Get("/swagger/*", httpSwagger.Handler(
@@ -108,27 +244,86 @@ func main() {
 
 	// Routes
 	r.Route("/api", func(r chi.Router) {
-		r.Mount("/auth", authHandler.Routes())
+		authLimit := customMiddleware.RateLimit(limiter, "auth", cfg.RateLimit.AuthRules(), logger)
+		r.With(authLimit, idempotency).Mount("/auth", authHandler.Routes())
+		r.With(authLimit, customMiddleware.EnrollmentAuthMiddleware(tokens, logger)).Mount("/auth/2fa", twoFactorHandler.Routes())
+		r.With(authLimit, customMiddleware.PasswordChangeAuthMiddleware(tokens, logger)).Post("/auth/password/change", authHandler.ChangePassword)
 		r.Group(func(r chi.Router) {
-			r.Use(customMiddleware.AuthMiddleware(logger))
+			r.Use(customMiddleware.AuthMiddleware(tokens, logger))
+			r.Use(customMiddleware.RateLimit(limiter, "api", cfg.RateLimit.APIRules(), logger))
+			r.Use(idempotency)
+			r.With(authLimit).Post("/auth/email/verify/resend", authHandler.ResendVerification)
 			r.Mount("/users", userHandler.Routes())
 			r.Mount("/fiscal-modules", fiscalModuleHandler.Routes())
 			r.Mount("/terminals", terminalHandler.Routes())
 			r.Post("/export", exportHandler.ExportXLSX)
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.AdminMiddleware(logger))
+				r.Post("/export/fleet", exportHandler.ExportFleetXLSX)
+				r.Post("/export/fleet/pdf", exportHandler.ExportFleetPDF)
+				r.Get("/export/audit", exportHandler.ListAudit)
+				r.Mount("/admin", adminHandler.Routes())
+			})
+			r.Mount("/reports", reportHandler.Routes())
+			r.Mount("/companies", companyHandler.Routes())
 		})
 	})
 
 	// Set up server
 	srv := &http.Server{
-		Addr:    ":" + cfg.ServerPort,
-		Handler: r,
+		Addr:              ":" + cfg.HTTP.ServerPort,
+		Handler:           r,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
 	}
 
+	// Background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobs := scheduler.New(logger)
+	jobs.Add("scheduled_reports", cfg.Scheduler.ReportsInterval, services.Report.RunDue)
+	if services.Retention.Enabled() {
+		jobs.Add("soft_delete_retention", cfg.Scheduler.RetentionInterval, services.Retention.PurgeDeleted)
+	}
+	if services.Idempotency.Enabled() {
+		jobs.Add("idempotency_keys", cfg.Scheduler.IdempotencyPurgeInterval, services.Idempotency.PurgeExpired)
+	}
+	jobs.Add("rate_limits", cfg.Scheduler.RateLimitPurgeInterval, limiter.Purge)
+	jobs.Add("user_tokens", cfg.Scheduler.UserTokenPurgeInterval, services.Account.PurgeExpired)
+	if cfg.Scheduler.ConfigReloadInterval > 0 {
+		jobs.Add("config_reload", cfg.Scheduler.ConfigReloadInterval, reloader.Reload)
+	}
+	collectFleet := appMetrics.FleetCollector(services.Stats.Fleet)
+	if err := collectFleet(jobsCtx, time.Now()); err != nil {
+		logger.Errorw("Failed to collect fleet metrics", "error", err)
+	}
+	jobs.Add("fleet_metrics", cfg.Metrics.Interval, collectFleet)
+	jobs.Start(jobsCtx)
+
 	// Start server
 	go func() {
-		logger.Info("Starting server", zap.String("port", cfg.ServerPort))
+		logger.Infow("Starting server", "port", cfg.HTTP.ServerPort)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("listen", zap.Error(err))
+			logger.Fatalw("listen", "error", err)
+		}
+	}()
+	if metricsSrv != nil {
+		go func() {
+			logger.Infow("Starting metrics server", "addr", cfg.Metrics.Addr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Errorw("Metrics server failed", "error", err)
+			}
+		}()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.Reload(jobsCtx, time.Now()); err != nil {
+				logger.Errorw("Failed to reload configuration", "error", err)
+			}
 		}
 	}()
 
@@ -138,12 +333,29 @@ func main() {
 	<-quit
 	logger.Info("Shutting down server...")
 
-	// The context is used to inform the server it has 5 seconds to finish
+	// Сначала /readyz начинает отвечать 503, и только после паузы сервер
+	// перестаёт принимать соединения: балансировщик успевает увести трафик
+	services.Health.Drain()
+	if cfg.HTTP.ShutdownDrainDelay > 0 {
+		logger.Infow("Draining traffic", "delay", cfg.HTTP.ShutdownDrainDelay.String())
+		time.Sleep(cfg.HTTP.ShutdownDrainDelay)
+	}
+
+	stopJobs()
+
+	// The context is used to inform the server how long it has to finish
 	// the request it is currently handling
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+		logger.Fatalw("Server forced to shutdown", "error", err)
+	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
+	jobs.Wait()
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Errorw("Failed to flush traces", "error", err)
 	}
 
 	logger.Info("Server exiting")
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/idkOybek/newNewTerminal/internal/config"
+	"github.com/idkOybek/newNewTerminal/internal/repository/postgres"
+	"github.com/idkOybek/newNewTerminal/migrations"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/migrate"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up [N]       apply all pending migrations, or the next N
+  down [N]     revert the last migration, or the last N
+  status       show applied and pending migrations
+  redo         revert and re-apply the last migration
+  force V      set the schema version to V and clear the dirty flag (-1 for an empty database)`
+
+func newMigrator(db *sql.DB, logger *logger.Logger) (*migrate.Migrator, error) {
+	return migrate.New(db, migrations.FS(), migrations.Dir, logger)
+}
+
+// runMigrate выполняет подкоманду migrate
+func runMigrate(ctx context.Context, db *sql.DB, logger *logger.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := newMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+
+	count := func() (int, error) {
+		if len(args) < 2 {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid migration count %q", args[1])
+		}
+		return n, nil
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := count()
+		if err != nil {
+			return err
+		}
+		applied, err := migrator.Up(ctx, n)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		for _, m := range applied {
+			fmt.Printf("applied %06d_%s\n", m.Version, m.Name)
+		}
+	case "down":
+		n, err := count()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			n = 1
+		}
+		reverted, err := migrator.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+		for _, m := range reverted {
+			fmt.Printf("reverted %06d_%s\n", m.Version, m.Name)
+		}
+	case "redo":
+		if err := migrator.Redo(ctx); err != nil {
+			return err
+		}
+		fmt.Println("redo complete")
+	case "force":
+		if len(args) < 2 {
+			return errors.New("force requires a version")
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("schema version forced to %d\n", version)
+	case "status":
+		return printMigrationStatus(ctx, db, migrator)
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, db *sql.DB, migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, s := range statuses {
+		state := "pending"
+		switch {
+		case s.Dirty:
+			state = "dirty"
+		case s.Applied:
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%06d\t%s\t%s\n", s.Version, s.Name, state)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	missing, err := migrate.CheckColumns(ctx, db, postgres.ExpectedColumns)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		fmt.Printf("\nschema drift, missing columns: %s\n", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// prepareSchema применяет миграции при старте (если включено) и сверяет
+// схему с ожиданиями репозиториев
+func prepareSchema(ctx context.Context, db *sql.DB, logger *logger.Logger, cfg config.Config) (*migrate.Migrator, error) {
+	migrator, err := newMigrator(db, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DB.MigrateOnStart {
+		if _, err := migrator.Up(ctx, 0); err != nil {
+			return nil, fmt.Errorf("failed to apply migrations: %w", err)
+		}
+	}
+
+	version, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, migrate.ErrDirty{Version: version}
+	}
+	if version != migrator.Latest() {
+		logger.Warnw("Database schema version differs from the embedded migrations",
+			"schema_version", version, "latest", migrator.Latest())
+	}
+
+	if cfg.DB.SchemaCheck == config.SchemaCheckOff {
+		return migrator, nil
+	}
+	missing, err := migrate.CheckColumns(ctx, db, postgres.ExpectedColumns)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		if cfg.DB.SchemaCheck == config.SchemaCheckStrict {
+			return nil, fmt.Errorf("schema drift, missing columns: %s", strings.Join(missing, ", "))
+		}
+		logger.Errorw("Schema drift detected", "missing_columns", missing)
+	}
+	return migrator, nil
+}
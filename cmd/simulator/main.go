@@ -0,0 +1,313 @@
+// simulator — парк виртуальных касс для проверки прошивки и нагрузочного
+// тестирования сервера. Каждый терминал регистрируется через API, опрашивает
+// статус и пробивает чеки; в конце печатается статистика задержек и ошибок.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/pkg/client"
+)
+
+const usage = `usage: simulator [flags]
+
+Spins up virtual cash registers against a running server. Each one gets its
+own fiscal module, registers via POST /terminals, then polls
+/terminals/exists and /terminals/status/{id}, updates last_request_date and
+burns free_record_balance until the run ends.
+
+Built-in profiles: normal, flaky (lost requests, jitter), slow (high latency),
+skewed (clock off by up to 6h), busy (many receipts per cycle).
+
+flags:`
+
+type options struct {
+	url         string
+	username    string
+	password    string
+	terminals   int
+	duration    time.Duration
+	interval    time.Duration
+	rampUp      time.Duration
+	balance     int
+	mix         string
+	profileFile string
+	prefix      string
+	timeout     time.Duration
+	retries     int
+	reportEvery time.Duration
+	output      string
+	cleanup     bool
+	seed        int64
+}
+
+type report struct {
+	Duration       string           `json:"duration"`
+	Operations     []opSummary      `json:"operations"`
+	InjectedFaults int64            `json:"injected_faults"`
+	Terminals      []terminalResult `json:"terminals"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "simulator:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var opts options
+	flags := flag.NewFlagSet("simulator", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.url, "url", "http://localhost:8080/api", "API base URL")
+	flags.StringVar(&opts.username, "username", "", "login of the user owning the virtual terminals (required)")
+	flags.StringVar(&opts.password, "password", os.Getenv("SIMULATOR_PASSWORD"), "password; defaults to $SIMULATOR_PASSWORD")
+	flags.IntVar(&opts.terminals, "terminals", 10, "number of virtual terminals")
+	flags.DurationVar(&opts.duration, "duration", time.Minute, "how long to run")
+	flags.DurationVar(&opts.interval, "interval", 5*time.Second, "polling interval of each terminal")
+	flags.DurationVar(&opts.rampUp, "ramp-up", 0, "spread terminal start-up over this period")
+	flags.IntVar(&opts.balance, "balance", 1000, "initial free_record_balance")
+	flags.StringVar(&opts.mix, "profiles", "normal", `profile mix, e.g. "normal=8,flaky=1,skewed=1"`)
+	flags.StringVar(&opts.profileFile, "profile-file", "", "JSON file with additional or overriding profiles")
+	flags.StringVar(&opts.prefix, "prefix", "", "cash register number prefix; reuse it to resume a previous fleet (default SIM-<timestamp>)")
+	flags.DurationVar(&opts.timeout, "timeout", 10*time.Second, "HTTP timeout per request")
+	flags.IntVar(&opts.retries, "retries", 2, "retries of idempotent requests")
+	flags.DurationVar(&opts.reportEvery, "report-every", 10*time.Second, "progress output interval; 0 disables it")
+	flags.StringVar(&opts.output, "o", "table", "report format: table or json")
+	flags.BoolVar(&opts.cleanup, "cleanup", false, "delete the created terminals and fiscal modules afterwards (requires an admin account)")
+	flags.Int64Var(&opts.seed, "seed", 0, "random seed for reproducible runs (default: current time)")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return err
+	}
+
+	switch {
+	case opts.username == "":
+		return errors.New("-username is required")
+	case opts.terminals <= 0:
+		return errors.New("-terminals must be positive")
+	case opts.interval <= 0:
+		return errors.New("-interval must be positive")
+	case opts.output != "table" && opts.output != "json":
+		return fmt.Errorf("unknown output format %q", opts.output)
+	}
+	if opts.prefix == "" {
+		opts.prefix = fmt.Sprintf("SIM-%d", time.Now().Unix())
+	}
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+
+	profiles, err := loadProfiles(opts.profileFile)
+	if err != nil {
+		return err
+	}
+	mix, err := parseMix(opts.mix, profiles)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Служебный клиент без сбоев: вход, подготовка модулей и уборка
+	setup := client.New(opts.url,
+		client.WithHTTPClient(&http.Client{Timeout: opts.timeout}),
+		client.WithCredentials(opts.username, opts.password),
+		client.WithUserAgent("terminal-simulator"),
+	)
+	login, err := setup.Login(ctx, &client.UserLoginRequest{Username: opts.username, Password: opts.password})
+	if err != nil {
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+	if login.User == nil {
+		return fmt.Errorf("failed to log in: %w", client.ErrTwoFactorRequired)
+	}
+
+	seeds := rand.New(rand.NewSource(opts.seed))
+	names := assign(mix, opts.terminals)
+	var injected atomic.Int64
+	st := newStats()
+
+	fleet := make([]*virtualTerminal, 0, opts.terminals)
+	for i, name := range names {
+		p := profiles[name]
+		rng := rand.New(rand.NewSource(seeds.Int63()))
+		transport := &faultTransport{base: http.DefaultTransport, profile: p, rng: rng, injected: &injected}
+
+		t := &virtualTerminal{
+			index:              i + 1,
+			profileName:        name,
+			profile:            p,
+			cashRegisterNumber: fmt.Sprintf("%s-%04d", opts.prefix, i+1),
+			inn:                login.User.INN,
+			companyName:        login.User.CompanyName,
+			api: client.New(opts.url,
+				client.WithHTTPClient(&http.Client{Timeout: opts.timeout, Transport: transport}),
+				client.WithToken(setup.Token()),
+				client.WithCredentials(opts.username, opts.password),
+				client.WithRetry(opts.retries, 200*time.Millisecond, 2*time.Second),
+				client.WithUserAgent("terminal-simulator"),
+			),
+			stats: st,
+			rng:   rng,
+		}
+		if p.ClockSkew > 0 {
+			skew := int64(p.ClockSkew)
+			t.skew = time.Duration(rng.Int63n(2*skew+1) - skew)
+		}
+		fleet = append(fleet, t)
+	}
+
+	modules, err := prepareModules(ctx, setup, login.User.ID, fleet)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "running %d terminals (%s, prefix %s, seed %d) for %s\n",
+		len(fleet), opts.mix, opts.prefix, opts.seed, opts.duration)
+
+	runCtx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+	runFleet(runCtx, fleet, st, opts)
+
+	r := report{
+		Duration:       time.Since(st.started).Truncate(time.Millisecond).String(),
+		Operations:     st.summary(),
+		InjectedFaults: injected.Load(),
+	}
+	for _, t := range fleet {
+		r.Terminals = append(r.Terminals, t.result())
+	}
+	if err := printReport(r, opts.output); err != nil {
+		return err
+	}
+
+	if opts.cleanup {
+		// Прогон мог быть прерван сигналом — уборке нужен свой контекст
+		return cleanup(context.Background(), setup, fleet, modules)
+	}
+	return nil
+}
+
+// prepareModules создаёт фискальные модули для терминалов: сервер регистрирует
+// терминал только на существующий модуль с тем же заводским номером.
+// Модули, оставшиеся от прошлого прогона с тем же префиксом, переиспользуются.
+func prepareModules(ctx context.Context, api *client.Client, userID int, fleet []*virtualTerminal) (map[string]int, error) {
+	existing, err := api.ListFiscalModules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fiscal modules: %w", err)
+	}
+	modules := make(map[string]int, len(fleet))
+	for _, m := range existing {
+		modules[m.FactoryNumber] = m.ID
+	}
+
+	created := make(map[string]int, len(fleet))
+	for _, t := range fleet {
+		if id, ok := modules[t.cashRegisterNumber]; ok {
+			created[t.cashRegisterNumber] = id
+			continue
+		}
+		module, err := api.CreateFiscalModule(ctx, &client.FiscalModuleCreateRequest{
+			FiscalNumber:  "FN-" + t.cashRegisterNumber,
+			FactoryNumber: t.cashRegisterNumber,
+			UserID:        userID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fiscal module %s: %w", t.cashRegisterNumber, err)
+		}
+		created[t.cashRegisterNumber] = module.ID
+	}
+	return created, nil
+}
+
+func runFleet(ctx context.Context, fleet []*virtualTerminal, st *stats, opts options) {
+	var wg sync.WaitGroup
+	for i, t := range fleet {
+		delay := opts.rampUp * time.Duration(i) / time.Duration(len(fleet))
+		wg.Add(1)
+		go func(t *virtualTerminal) {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			t.run(ctx, opts.interval, opts.balance)
+		}(t)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var tick <-chan time.Time
+	if opts.reportEvery > 0 {
+		ticker := time.NewTicker(opts.reportEvery)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick:
+			fmt.Fprintln(os.Stderr, st.progress())
+		}
+	}
+}
+
+func printReport(r report, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	fmt.Printf("duration %s, injected faults %d\n\n", r.Duration, r.InjectedFaults)
+	if err := writeTable(os.Stdout, r.Operations); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	return writeProfiles(os.Stdout, r.Terminals)
+}
+
+func cleanup(ctx context.Context, api *client.Client, fleet []*virtualTerminal, modules map[string]int) error {
+	failed := 0
+	for _, t := range fleet {
+		if t.id != 0 {
+			if err := api.DeleteTerminal(ctx, t.id); err != nil && !client.IsNotFound(err) {
+				fmt.Fprintf(os.Stderr, "failed to delete terminal %d: %v\n", t.id, err)
+				failed++
+				continue
+			}
+		}
+		if id, ok := modules[t.cashRegisterNumber]; ok {
+			if err := api.DeleteFiscalModule(ctx, id); err != nil && !client.IsNotFound(err) {
+				fmt.Fprintf(os.Stderr, "failed to delete fiscal module %d: %v\n", id, err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("cleanup: %d deletions failed", failed)
+	}
+	return nil
+}
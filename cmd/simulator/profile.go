@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// profile описывает поведение виртуального терминала: сеть и часы
+type profile struct {
+	// FailureRate — доля запросов, которые теряются (0..1)
+	FailureRate float64 `json:"failure_rate"`
+	// Задержка сети добавляется к каждому запросу, равномерно в [LatencyMin, LatencyMax]
+	LatencyMin duration `json:"latency_min"`
+	LatencyMax duration `json:"latency_max"`
+	// ClockSkew — максимальный уход часов терминала в обе стороны
+	ClockSkew duration `json:"clock_skew"`
+	// BurnMin..BurnMax — сколько чеков терминал пробивает за один цикл
+	BurnMin int `json:"burn_min"`
+	BurnMax int `json:"burn_max"`
+}
+
+var builtinProfiles = map[string]*profile{
+	"normal": {BurnMin: 1, BurnMax: 3},
+	"flaky": {
+		FailureRate: 0.15,
+		LatencyMin:  duration(50 * time.Millisecond),
+		LatencyMax:  duration(800 * time.Millisecond),
+		BurnMin:     1,
+		BurnMax:     3,
+	},
+	"slow": {
+		LatencyMin: duration(500 * time.Millisecond),
+		LatencyMax: duration(3 * time.Second),
+		BurnMin:    1,
+		BurnMax:    3,
+	},
+	"skewed": {ClockSkew: duration(6 * time.Hour), BurnMin: 1, BurnMax: 3},
+	"busy":   {BurnMin: 10, BurnMax: 50},
+}
+
+// loadProfiles дополняет встроенные профили профилями из JSON-файла вида
+// {"name": {"failure_rate": 0.3, "latency_max": "2s"}}
+func loadProfiles(path string) (map[string]*profile, error) {
+	profiles := make(map[string]*profile, len(builtinProfiles))
+	for name, p := range builtinProfiles {
+		profiles[name] = p
+	}
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	custom := map[string]*profile{}
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for name, p := range custom {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+func (p *profile) validate() error {
+	switch {
+	case p.FailureRate < 0 || p.FailureRate > 1:
+		return errors.New("failure_rate must be between 0 and 1")
+	case p.LatencyMin < 0 || p.LatencyMax < p.LatencyMin:
+		return errors.New("latency_max must not be less than latency_min")
+	case p.ClockSkew < 0:
+		return errors.New("clock_skew must not be negative")
+	case p.BurnMin < 0 || p.BurnMax < p.BurnMin:
+		return errors.New("burn_max must not be less than burn_min")
+	}
+	return nil
+}
+
+type weightedProfile struct {
+	name   string
+	weight int
+}
+
+// parseMix разбирает смесь профилей "normal=8,flaky=1,skewed=1"; вес по умолчанию 1
+func parseMix(spec string, profiles map[string]*profile) ([]weightedProfile, error) {
+	var mix []weightedProfile
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weightStr, hasWeight := strings.Cut(part, "=")
+		weight := 1
+		if hasWeight {
+			var err error
+			if weight, err = strconv.Atoi(weightStr); err != nil || weight <= 0 {
+				return nil, fmt.Errorf("invalid weight in %q", part)
+			}
+		}
+		if _, ok := profiles[name]; !ok {
+			return nil, fmt.Errorf("unknown profile %q (known: %s)", name, strings.Join(profileNames(profiles), ", "))
+		}
+		mix = append(mix, weightedProfile{name: name, weight: weight})
+	}
+	if len(mix) == 0 {
+		return nil, errors.New("no profiles given")
+	}
+	return mix, nil
+}
+
+// assign распределяет профили между n терминалами пропорционально весам
+func assign(mix []weightedProfile, n int) []string {
+	total := 0
+	for _, m := range mix {
+		total += m.weight
+	}
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		slot := i % total
+		for _, m := range mix {
+			if slot < m.weight {
+				names = append(names, m.name)
+				break
+			}
+			slot -= m.weight
+		}
+	}
+	return names
+}
+
+func profileNames(profiles map[string]*profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var errSimulatedFailure = errors.New("simulated network failure")
+
+// faultTransport вносит задержку и потери по профилю. Половина потерь —
+// запрос не дошёл до сервера, половина — сервер его выполнил, но ответ потерялся.
+type faultTransport struct {
+	base     http.RoundTripper
+	profile  *profile
+	rng      *rand.Rand
+	injected *atomic.Int64
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if delay := t.latency(); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	if t.profile.FailureRate == 0 || t.rng.Float64() >= t.profile.FailureRate {
+		return t.base.RoundTrip(req)
+	}
+	t.injected.Add(1)
+
+	if t.rng.Intn(2) == 0 {
+		return nil, errSimulatedFailure
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return nil, errSimulatedFailure
+}
+
+func (t *faultTransport) latency() time.Duration {
+	min, max := time.Duration(t.profile.LatencyMin), time.Duration(t.profile.LatencyMax)
+	if max <= 0 {
+		return 0
+	}
+	return min + time.Duration(t.rng.Int63n(int64(max-min)+1))
+}
+
+// duration читается из JSON строкой вида "250ms"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
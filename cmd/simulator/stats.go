@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/pkg/client"
+)
+
+const (
+	opRegister = "register"
+	opExists   = "exists"
+	opStatus   = "status"
+	opUpdate   = "update"
+)
+
+var operations = []string{opRegister, opExists, opStatus, opUpdate}
+
+// stats собирает задержки и ошибки вызовов API по операциям
+type stats struct {
+	mu      sync.Mutex
+	started time.Time
+	ops     map[string]*opStats
+}
+
+type opStats struct {
+	latencies []time.Duration
+	errors    map[string]int
+}
+
+func newStats() *stats {
+	s := &stats{started: time.Now(), ops: make(map[string]*opStats, len(operations))}
+	for _, op := range operations {
+		s.ops[op] = &opStats{errors: map[string]int{}}
+	}
+	return s
+}
+
+func (s *stats) record(op string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := s.ops[op]
+	o.latencies = append(o.latencies, latency)
+	if err != nil {
+		o.errors[errorClass(err)]++
+	}
+}
+
+// errorClass группирует ошибки для отчёта: код ответа, таймаут или сеть
+func errorClass(err error) string {
+	var apiErr *client.APIError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		return strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(err, errSimulatedFailure):
+		return "simulated"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "network"
+	}
+}
+
+type opSummary struct {
+	Operation string         `json:"operation"`
+	Requests  int            `json:"requests"`
+	Errors    int            `json:"errors"`
+	ErrorRate float64        `json:"error_rate"`
+	P50       time.Duration  `json:"p50_ns"`
+	P95       time.Duration  `json:"p95_ns"`
+	P99       time.Duration  `json:"p99_ns"`
+	Max       time.Duration  `json:"max_ns"`
+	ByClass   map[string]int `json:"errors_by_class,omitempty"`
+}
+
+func (s *stats) summary() []opSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]opSummary, 0, len(operations))
+	for _, op := range operations {
+		o := s.ops[op]
+		sum := opSummary{Operation: op, Requests: len(o.latencies), ByClass: map[string]int{}}
+		for class, n := range o.errors {
+			sum.Errors += n
+			sum.ByClass[class] = n
+		}
+		if sum.Requests > 0 {
+			sorted := append([]time.Duration(nil), o.latencies...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			sum.ErrorRate = float64(sum.Errors) / float64(sum.Requests)
+			sum.P50 = percentile(sorted, 0.50)
+			sum.P95 = percentile(sorted, 0.95)
+			sum.P99 = percentile(sorted, 0.99)
+			sum.Max = sorted[len(sorted)-1]
+		}
+		result = append(result, sum)
+	}
+	return result
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+// progress — короткая строка для периодического вывода во время прогона
+func (s *stats) progress() string {
+	total, failed := 0, 0
+	for _, sum := range s.summary() {
+		total += sum.Requests
+		failed += sum.Errors
+	}
+	elapsed := time.Since(s.started)
+	return fmt.Sprintf("%s elapsed, %d requests (%.1f/s), %d errors",
+		elapsed.Truncate(time.Second), total, float64(total)/elapsed.Seconds(), failed)
+}
+
+func writeTable(w io.Writer, summaries []opSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATION\tREQUESTS\tERRORS\tERROR %\tP50\tP95\tP99\tMAX\tERRORS BY CLASS")
+	for _, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\n",
+			s.Operation, s.Requests, s.Errors, s.ErrorRate*100,
+			formatLatency(s.P50), formatLatency(s.P95), formatLatency(s.P99), formatLatency(s.Max),
+			formatClasses(s.ByClass))
+	}
+	return tw.Flush()
+}
+
+// writeProfiles сводит итог по терминалам в разрезе профилей
+func writeProfiles(w io.Writer, terminals []terminalResult) error {
+	type counts struct{ total, registered, active, exhausted int }
+	byProfile := map[string]*counts{}
+	for _, t := range terminals {
+		c, ok := byProfile[t.Profile]
+		if !ok {
+			c = &counts{}
+			byProfile[t.Profile] = c
+		}
+		c.total++
+		if t.Registered {
+			c.registered++
+		}
+		if t.Active {
+			c.active++
+		}
+		if t.Exhausted {
+			c.exhausted++
+		}
+	}
+
+	names := make([]string, 0, len(byProfile))
+	for name := range byProfile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROFILE\tTERMINALS\tREGISTERED\tACTIVE\tEXHAUSTED")
+	for _, name := range names {
+		c := byProfile[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", name, c.total, c.registered, c.active, c.exhausted)
+	}
+	return tw.Flush()
+}
+
+func formatLatency(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(100 * time.Microsecond).String()
+}
+
+func formatClasses(classes map[string]int) string {
+	if len(classes) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(classes))
+	for class, n := range classes {
+		parts = append(parts, fmt.Sprintf("%s=%d", class, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/pkg/client"
+)
+
+// virtualTerminal ведёт себя как прошивка кассы: при старте ищет себя на
+// сервере и регистрируется, затем в цикле опрашивает статус и пробивает чеки,
+// списывая free_record_balance
+type virtualTerminal struct {
+	index              int
+	profileName        string
+	profile            *profile
+	cashRegisterNumber string
+	// inn и companyName берутся у владельца, иначе сервер отклонит регистрацию
+	// при COMPANY_CHECK=strict
+	inn         string
+	companyName string
+
+	api   *client.Client
+	stats *stats
+	rng   *rand.Rand
+	// skew — насколько часы терминала расходятся с настоящим временем
+	skew time.Duration
+
+	id        int
+	balance   int
+	active    bool
+	exhausted bool
+}
+
+type terminalResult struct {
+	Index              int    `json:"index"`
+	ID                 int    `json:"id,omitempty"`
+	CashRegisterNumber string `json:"cash_register_number"`
+	Profile            string `json:"profile"`
+	ClockSkew          string `json:"clock_skew"`
+	Registered         bool   `json:"registered"`
+	Active             bool   `json:"active"`
+	Balance            int    `json:"free_record_balance"`
+	Exhausted          bool   `json:"exhausted"`
+}
+
+func (t *virtualTerminal) now() time.Time {
+	return time.Now().Add(t.skew)
+}
+
+func (t *virtualTerminal) run(ctx context.Context, interval time.Duration, initialBalance int) {
+	t.balance = initialBalance
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if t.id == 0 {
+			t.register(ctx)
+		} else {
+			t.poll(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// register повторяется на каждом цикле, пока не удастся: ответ на создание
+// мог потеряться, поэтому сначала проверяем, не зарегистрированы ли уже
+func (t *virtualTerminal) register(ctx context.Context) {
+	if id, ok := t.exists(ctx); !ok {
+		return
+	} else if id != 0 {
+		// Терминал остался от прошлого прогона — продолжаем с его баланса
+		t.id = id
+		if terminal, err := t.api.GetTerminal(ctx, id); err == nil {
+			t.balance = terminal.FreeRecordBalance
+			t.active = terminal.IsActive
+		}
+		return
+	}
+
+	now := t.now().Format(time.RFC3339)
+	var terminal *client.Terminal
+	err := t.call(ctx, opRegister, func() (err error) {
+		terminal, err = t.api.CreateTerminal(ctx, &client.TerminalCreateRequest{
+			AssemblyNumber:     fmt.Sprintf("SIM-ASM-%d", t.index),
+			INN:                t.inn,
+			CompanyName:        t.companyName,
+			Address:            fmt.Sprintf("Virtual terminal #%d", t.index),
+			CashRegisterNumber: t.cashRegisterNumber,
+			ModuleNumber:       t.cashRegisterNumber,
+			LastRequestDate:    now,
+			DatabaseUpdateDate: now,
+			FreeRecordBalance:  t.balance,
+		})
+		return err
+	})
+	if err == nil {
+		t.id = terminal.ID
+		t.active = terminal.IsActive
+	}
+}
+
+func (t *virtualTerminal) poll(ctx context.Context) {
+	if _, ok := t.exists(ctx); !ok {
+		return
+	}
+
+	var status *client.TerminalStatusResponse
+	err := t.call(ctx, opStatus, func() (err error) {
+		status, err = t.api.GetTerminalStatus(ctx, t.id)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	t.active = status.IsActive
+	if !t.active {
+		return
+	}
+
+	burned := t.profile.BurnMin
+	if spread := t.profile.BurnMax - t.profile.BurnMin; spread > 0 {
+		burned += t.rng.Intn(spread + 1)
+	}
+	if burned > t.balance {
+		burned = t.balance
+	}
+	balance := t.balance - burned
+	if balance == 0 {
+		t.exhausted = true
+	}
+
+	now := t.now().Format(time.RFC3339)
+	err = t.call(ctx, opUpdate, func() error {
+		_, err := t.api.UpdateTerminal(ctx, t.id, &client.TerminalUpdateRequest{
+			LastRequestDate:    &now,
+			DatabaseUpdateDate: &now,
+			FreeRecordBalance:  &balance,
+		})
+		return err
+	})
+	if err == nil {
+		t.balance = balance
+	}
+}
+
+// exists возвращает ID терминала (0 — не найден) и false, если запрос не прошёл
+func (t *virtualTerminal) exists(ctx context.Context) (int, bool) {
+	var resp *client.TerminalExistsResponse
+	err := t.call(ctx, opExists, func() (err error) {
+		resp, err = t.api.TerminalExists(ctx, t.cashRegisterNumber)
+		return err
+	})
+	switch {
+	case err == nil:
+		return resp.ID, true
+	case client.IsNotFound(err):
+		return 0, true
+	}
+	return 0, false
+}
+
+// call замеряет вызов API. 404 на exists — штатный ответ, а не ошибка;
+// вызовы, прерванные остановкой прогона, в статистику не попадают.
+func (t *virtualTerminal) call(ctx context.Context, op string, fn func() error) error {
+	started := time.Now()
+	err := fn()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if op == opExists && client.IsNotFound(err) {
+		t.stats.record(op, time.Since(started), nil)
+	} else {
+		t.stats.record(op, time.Since(started), err)
+	}
+	return err
+}
+
+func (t *virtualTerminal) result() terminalResult {
+	return terminalResult{
+		Index:              t.index,
+		ID:                 t.id,
+		CashRegisterNumber: t.cashRegisterNumber,
+		Profile:            t.profileName,
+		ClockSkew:          t.skew.Round(time.Second).String(),
+		Registered:         t.id != 0,
+		Active:             t.active,
+		Balance:            t.balance,
+		Exhausted:          t.exhausted,
+	}
+}
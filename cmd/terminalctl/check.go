@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/taxid"
+)
+
+type issue struct {
+	Check   string `json:"check"`
+	Entity  string `json:"entity"`
+	ID      int    `json:"id"`
+	Details string `json:"details"`
+}
+
+// checkConsistency ищет расхождения между терминалами, модулями и
+// пользователями, которые схема БД не ловит сама
+func checkConsistency(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	users, err := a.services.User.List(ctx)
+	if err != nil {
+		return err
+	}
+	modules, err := a.services.FiscalModule.List(ctx)
+	if err != nil {
+		return err
+	}
+	terminals, err := a.services.Terminal.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var issues []issue
+	add := func(check, entity string, id int, format string, args ...interface{}) {
+		issues = append(issues, issue{Check: check, Entity: entity, ID: id, Details: fmt.Sprintf(format, args...)})
+	}
+
+	activeUsers := make(map[int]bool, len(users))
+	usersByID := make(map[int]*models.User, len(users))
+	for _, u := range users {
+		activeUsers[u.ID] = u.IsActive
+		usersByID[u.ID] = u
+		if !taxid.Valid(u.INN) {
+			add("invalid_inn", "user", u.ID, "%q is neither a 9-digit INN nor a 14-digit PINFL", u.INN)
+		}
+	}
+
+	modulesByFactory := make(map[string]int, len(modules))
+	for i, m := range modules {
+		modulesByFactory[m.FactoryNumber] = i
+		if _, ok := activeUsers[m.UserID]; !ok {
+			add("orphaned_module", "fiscal_module", m.ID, "owner %d does not exist or is deleted", m.UserID)
+		}
+	}
+
+	bound := make(map[string]bool, len(terminals))
+	moduleNumbers := make(map[string][]int)
+	for _, t := range terminals {
+		bound[t.CashRegisterNumber] = true
+		if t.ModuleNumber != "" {
+			moduleNumbers[t.ModuleNumber] = append(moduleNumbers[t.ModuleNumber], t.ID)
+		}
+
+		userActive, userExists := activeUsers[t.UserID]
+		switch {
+		case !userExists:
+			add("orphaned_terminal", "terminal", t.ID, "owner %d does not exist or is deleted", t.UserID)
+		case t.IsActive && !userActive:
+			add("inactive_owner", "terminal", t.ID, "terminal is active but owner %d is not", t.UserID)
+		}
+
+		if !taxid.Valid(t.INN) {
+			add("invalid_inn", "terminal", t.ID, "%q is neither a 9-digit INN nor a 14-digit PINFL", t.INN)
+		}
+		if owner, ok := usersByID[t.UserID]; ok {
+			if t.INN != owner.INN {
+				add("inn_mismatch", "terminal", t.ID, "terminal INN %s, owner %d INN %s", t.INN, owner.ID, owner.INN)
+			}
+			if owner.CompanyName != "" && !taxid.SameCompany(t.CompanyName, owner.CompanyName) {
+				add("company_mismatch", "terminal", t.ID, "terminal company %q, owner %d company %q", t.CompanyName, owner.ID, owner.CompanyName)
+			}
+		}
+
+		i, ok := modulesByFactory[t.CashRegisterNumber]
+		if !ok {
+			add("missing_module", "terminal", t.ID, "fiscal module %s does not exist or is deleted", t.CashRegisterNumber)
+			continue
+		}
+		module := modules[i]
+		if module.UserID != t.UserID {
+			add("owner_mismatch", "terminal", t.ID, "terminal owner %d, fiscal module %s owner %d", t.UserID, module.FactoryNumber, module.UserID)
+		}
+		if t.IsActive && !module.IsActive {
+			add("inactive_module", "terminal", t.ID, "terminal is active but fiscal module %s is not", module.FactoryNumber)
+		}
+	}
+
+	for _, m := range modules {
+		if m.IsActive && !bound[m.FactoryNumber] {
+			add("unbound_active_module", "fiscal_module", m.ID, "fiscal module %s is active but not bound to a terminal", m.FactoryNumber)
+		}
+	}
+
+	for number, ids := range moduleNumbers {
+		if len(ids) > 1 {
+			for _, id := range ids {
+				add("duplicate_module_number", "terminal", id, "module number %s is used by %d terminals", number, len(ids))
+			}
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Check != issues[j].Check {
+			return issues[i].Check < issues[j].Check
+		}
+		return issues[i].ID < issues[j].ID
+	})
+
+	rows := make([][]string, 0, len(issues))
+	for _, is := range issues {
+		rows = append(rows, []string{is.Check, is.Entity, strconv.Itoa(is.ID), is.Details})
+	}
+	if issues == nil {
+		issues = []issue{}
+	}
+	if err := a.out.print(issues, []string{"CHECK", "ENTITY", "ID", "DETAILS"}, rows); err != nil {
+		return err
+	}
+
+	// Ненулевой код выхода, чтобы проверку можно было ставить в cron и CI
+	if len(issues) > 0 {
+		return fmt.Errorf("%d issues found", len(issues))
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// terminalctl — консольная утилита для операционных задач поверх сервисного слоя.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/idkOybek/newNewTerminal/internal/config"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/internal/service"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/database"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/notify"
+	"github.com/idkOybek/newNewTerminal/pkg/registry"
+)
+
+const usage = `usage: terminalctl [-o table|json] [-log-level level] <command> [flags]
+
+commands:
+  user create-admin     create an administrator
+  user reset-password   set or generate a new password for a user
+  user list             list users
+  user reset-2fa        disable two-factor authentication of a user who lost the device
+  terminal list         list terminals
+  terminal activate     activate a terminal, recording the reason
+  terminal deactivate   deactivate a terminal, recording the reason
+  terminal history      show manual status changes of a terminal
+  module list           list fiscal modules
+  module bind           bind a terminal to another fiscal module
+  module unbind         release a terminal's fiscal module
+  import                bulk import users, modules or terminals from CSV or JSON
+  export                export users, modules or terminals to CSV, JSON or XLSX
+  check                 run database consistency checks
+
+Run 'terminalctl <command> -h' for command flags.`
+
+// app — общие зависимости подкоманд
+type app struct {
+	services *service.Services
+	out      *printer
+}
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"user create-admin":   createAdmin,
+	"user reset-password": resetPassword,
+	"user list":           listUsers,
+	"user reset-2fa":      resetTwoFactor,
+	"terminal list":       listTerminals,
+	"terminal activate":   activateTerminal,
+	"terminal deactivate": deactivateTerminal,
+	"terminal history":    terminalHistory,
+	"module list":         listModules,
+	"module bind":         bindModule,
+	"module unbind":       unbindModule,
+	"import":              importData,
+	"export":              exportData,
+	"check":               checkConsistency,
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "terminalctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	flags := flag.NewFlagSet("terminalctl", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	output := flags.String("o", "table", "output format: table or json")
+	logLevel := flags.String("log-level", "error", "log level of the service layer")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return err
+	}
+	if *output != formatTable && *output != formatJSON {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	cmd, args, err := lookupCommand(flags.Args())
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	log, err := logger.NewLogger(*logLevel)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewPostgresDB(cfg.DB.DatabaseURL, cfg.DB.Pool())
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	companyRegistry, err := registry.Open(cfg.Company.Registry, cfg.Company.RegistryTimeout)
+	if err != nil {
+		return err
+	}
+	breached, err := cfg.Password.Breached()
+	if err != nil {
+		return err
+	}
+
+	a := &app{
+		services: service.NewServices(service.Deps{
+			Repos:               repository.NewRepositories(db, log),
+			Logger:              log,
+			PublicBaseURL:       cfg.Export.PublicBaseURL,
+			UserDeletePolicy:    cfg.UserDeletePolicy,
+			SoftDeleteRetention: cfg.Scheduler.SoftDeleteRetention,
+			Registry:            companyRegistry,
+			CompanyCheck:        cfg.Company.Check,
+			Notifier:            notify.NewLogNotifier(log),
+			Account:             cfg.Account.Policy(),
+			Password:            cfg.Password.Policy(),
+			BreachedPasswords:   breached,
+		}),
+		out: newPrinter(os.Stdout, *output),
+	}
+
+	return cmd(operatorContext(), a, args)
+}
+
+func lookupCommand(args []string) (command, []string, error) {
+	if len(args) == 0 {
+		return nil, nil, errors.New("no command given")
+	}
+	if cmd, ok := commands[args[0]]; ok {
+		return cmd, args[1:], nil
+	}
+	if len(args) > 1 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return cmd, args[2:], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unknown command %q", args[0])
+}
+
+// operatorContext действует от имени администратора, как запрос с админским токеном.
+// Имя оператора попадает в журналы смены статусов и выгрузок.
+func operatorContext() context.Context {
+	name := "terminalctl"
+	if u, err := user.Current(); err == nil {
+		name = "terminalctl:" + u.Username
+	}
+
+	ctx := context.WithValue(context.Background(), "user", &auth.Claims{Username: name, IsAdmin: true})
+	return context.WithValue(ctx, "userRole", true)
+}
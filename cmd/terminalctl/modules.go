@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+)
+
+func listModules(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("module list")
+	userID := fs.Int("user-id", 0, "filter by owner ID")
+	free := fs.Bool("free", false, "only modules not bound to a terminal")
+	var active optionalBool
+	fs.Var(&active, "active", "filter by active flag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	modules, err := a.services.FiscalModule.List(ctx)
+	if err != nil {
+		return err
+	}
+	terminals, err := a.services.Terminal.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	boundTo := make(map[string]int, len(terminals))
+	for _, t := range terminals {
+		boundTo[t.CashRegisterNumber] = t.ID
+	}
+
+	result := make([]*models.FiscalModuleResponse, 0, len(modules))
+	rows := make([][]string, 0, len(modules))
+	for _, m := range modules {
+		terminalID, bound := boundTo[m.FactoryNumber]
+		if (*userID != 0 && m.UserID != *userID) || !active.matches(m.IsActive) || (*free && bound) {
+			continue
+		}
+
+		terminal := "-"
+		if bound {
+			terminal = strconv.Itoa(terminalID)
+		}
+		result = append(result, m)
+		rows = append(rows, []string{
+			strconv.Itoa(m.ID), m.FactoryNumber, m.FiscalNumber, strconv.Itoa(m.UserID), formatBool(m.IsActive), terminal,
+		})
+	}
+
+	return a.out.print(result, []string{"ID", "FACTORY NUMBER", "FISCAL NUMBER", "USER", "ACTIVE", "TERMINAL"}, rows)
+}
+
+func bindModule(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("module bind")
+	terminalID := fs.Int("terminal-id", 0, "terminal ID (required)")
+	factoryNumber := fs.String("factory-number", "", "factory number of the fiscal module (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *terminalID == 0 || *factoryNumber == "" {
+		return errors.New("-terminal-id and -factory-number are required")
+	}
+
+	terminal, err := a.services.Terminal.BindModule(ctx, *terminalID, *factoryNumber)
+	if err != nil {
+		return err
+	}
+	return a.out.message(terminal, fmt.Sprintf("terminal %d bound to fiscal module %s", terminal.ID, terminal.CashRegisterNumber))
+}
+
+func unbindModule(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("module unbind")
+	terminalID := fs.Int("terminal-id", 0, "terminal ID (required)")
+	reason := fs.String("reason", "", "reason recorded in the status history (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *terminalID == 0 || *reason == "" {
+		return errors.New("-terminal-id and -reason are required")
+	}
+
+	if err := a.services.Terminal.UnbindModule(ctx, *terminalID, *reason); err != nil {
+		return err
+	}
+	return a.out.message(map[string]interface{}{"terminal_id": *terminalID, "unbound": true},
+		fmt.Sprintf("fiscal module released; terminal %d deactivated and deleted (restorable)", *terminalID))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+)
+
+var terminalHeaders = []string{"ID", "CASH REGISTER", "MODULE", "COMPANY", "INN", "USER", "ACTIVE", "BALANCE", "LAST REQUEST"}
+
+func terminalRow(t *models.Terminal) []string {
+	return []string{
+		strconv.Itoa(t.ID), t.CashRegisterNumber, t.ModuleNumber, t.CompanyName, t.INN,
+		strconv.Itoa(t.UserID), formatBool(t.IsActive), strconv.Itoa(t.FreeRecordBalance), formatTime(t.LastRequestDate),
+	}
+}
+
+func listTerminals(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("terminal list")
+	userID := fs.Int("user-id", 0, "filter by owner ID")
+	company := fs.String("company", "", "filter by company name substring")
+	staleDays := fs.Int("stale-days", 0, "only terminals without requests for this many days")
+	maxBalance := fs.Int("max-balance", -1, "only terminals with free_record_balance at or below this value")
+	var active optionalBool
+	fs.Var(&active, "active", "filter by active flag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	terminals, err := a.services.Terminal.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	staleBefore := time.Now().AddDate(0, 0, -*staleDays)
+	result := make([]*models.Terminal, 0, len(terminals))
+	rows := make([][]string, 0, len(terminals))
+	for _, t := range terminals {
+		switch {
+		case *userID != 0 && t.UserID != *userID,
+			!active.matches(t.IsActive),
+			!containsFold(t.CompanyName, *company),
+			*staleDays > 0 && t.LastRequestDate.After(staleBefore),
+			*maxBalance >= 0 && t.FreeRecordBalance > *maxBalance:
+			continue
+		}
+		result = append(result, t)
+		rows = append(rows, terminalRow(t))
+	}
+
+	return a.out.print(result, terminalHeaders, rows)
+}
+
+func activateTerminal(ctx context.Context, a *app, args []string) error {
+	return setTerminalStatus(ctx, a, "terminal activate", true, args)
+}
+
+func deactivateTerminal(ctx context.Context, a *app, args []string) error {
+	return setTerminalStatus(ctx, a, "terminal deactivate", false, args)
+}
+
+func setTerminalStatus(ctx context.Context, a *app, name string, active bool, args []string) error {
+	fs := newFlagSet(name)
+	id := fs.Int("id", 0, "terminal ID (required)")
+	reason := fs.String("reason", "", "reason recorded in the status history (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id == 0 || *reason == "" {
+		return errors.New("-id and -reason are required")
+	}
+
+	terminal, err := a.services.Terminal.SetStatus(ctx, *id, active, *reason)
+	if err != nil {
+		return err
+	}
+
+	state := "deactivated"
+	if active {
+		state = "activated"
+	}
+	return a.out.message(terminal, fmt.Sprintf("terminal %d (%s) %s", terminal.ID, terminal.CashRegisterNumber, state))
+}
+
+func terminalHistory(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("terminal history")
+	id := fs.Int("id", 0, "terminal ID (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id == 0 {
+		return errors.New("-id is required")
+	}
+
+	changes, err := a.services.Terminal.StatusHistory(ctx, *id)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(changes))
+	for _, c := range changes {
+		rows = append(rows, []string{formatTime(c.CreatedAt), formatBool(c.IsActive), c.ChangedBy, c.Reason})
+	}
+	if changes == nil {
+		changes = []*models.TerminalStatusChange{}
+	}
+	return a.out.print(changes, []string{"TIME", "ACTIVE", "CHANGED BY", "REASON"}, rows)
+}
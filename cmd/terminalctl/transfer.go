@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	stdcsv "encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/csv"
+	"github.com/idkOybek/newNewTerminal/pkg/xlsx"
+)
+
+const (
+	kindUsers     = "users"
+	kindModules   = "modules"
+	kindTerminals = "terminals"
+)
+
+type importResult struct {
+	Row   int    `json:"row"`
+	ID    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func importData(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("import")
+	kind := fs.String("kind", "", "users, modules or terminals (required)")
+	file := fs.String("file", "", "CSV or JSON file with create requests (required)")
+	dryRun := fs.Bool("dry-run", false, "only parse the file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+
+	var create func(ctx context.Context, i int) (int, error)
+	var count int
+	var err error
+	switch *kind {
+	case kindUsers:
+		var reqs []models.UserCreateRequest
+		err = decodeFile(*file, &reqs)
+		count = len(reqs)
+		create = func(ctx context.Context, i int) (int, error) {
+			user, err := a.services.User.Create(ctx, &reqs[i])
+			if err != nil {
+				return 0, err
+			}
+			return user.ID, nil
+		}
+	case kindModules:
+		var reqs []models.FiscalModuleCreateRequest
+		err = decodeFile(*file, &reqs)
+		count = len(reqs)
+		create = func(ctx context.Context, i int) (int, error) {
+			module, err := a.services.FiscalModule.Create(ctx, &reqs[i])
+			if err != nil {
+				return 0, err
+			}
+			return module.ID, nil
+		}
+	case kindTerminals:
+		var reqs []models.TerminalCreateRequest
+		err = decodeFile(*file, &reqs)
+		count = len(reqs)
+		create = func(ctx context.Context, i int) (int, error) {
+			terminal, err := a.services.Terminal.Create(ctx, &reqs[i])
+			if err != nil {
+				return 0, err
+			}
+			return terminal.ID, nil
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", *kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		return a.out.message(map[string]interface{}{"kind": *kind, "records": count},
+			fmt.Sprintf("%d %s parsed, nothing imported", count, *kind))
+	}
+
+	// Ошибка в одной строке не останавливает импорт: итог показывает, что не прошло
+	results := make([]importResult, 0, count)
+	rows := make([][]string, 0, count)
+	failed := 0
+	for i := 0; i < count; i++ {
+		result := importResult{Row: i + 1}
+		id, err := create(ctx, i)
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		} else {
+			result.ID = id
+		}
+		results = append(results, result)
+		rows = append(rows, []string{strconv.Itoa(result.Row), strconv.Itoa(result.ID), result.Error})
+	}
+
+	if err := a.out.print(results, []string{"ROW", "ID", "ERROR"}, rows); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records failed", failed, count)
+	}
+	return nil
+}
+
+func exportData(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("export")
+	kind := fs.String("kind", "", "users, modules or terminals (required)")
+	file := fs.String("file", "", "output file; the format follows the extension: .csv, .json or .xlsx (required)")
+	password := fs.String("password", "", "encrypt the XLSX file with this password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	if format != models.ReportFormatCSV && format != models.ReportFormatXLSX && format != "json" {
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+	if *password != "" && format != models.ReportFormatXLSX {
+		return errors.New("-password is only supported for XLSX")
+	}
+
+	var data interface{}
+	var err error
+	switch *kind {
+	case kindUsers:
+		data, err = a.services.User.List(ctx)
+	case kindModules:
+		data, err = a.services.FiscalModule.List(ctx)
+	case kindTerminals:
+		data, err = a.services.Terminal.List(ctx)
+	default:
+		return fmt.Errorf("unknown kind %q", *kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	records, err := toRecords(data)
+	if err != nil {
+		return err
+	}
+	if *kind == kindUsers {
+		for _, r := range records {
+			delete(r, "password")
+		}
+	}
+
+	stamp, err := a.services.Export.Audit(ctx, &models.ExportAuditEntry{
+		ExportType: models.ExportTypeCLI,
+		Format:     format,
+		Filename:   filepath.Base(*file),
+		RowCount:   len(records),
+		Filters:    json.RawMessage(fmt.Sprintf(`{"kind":%q}`, *kind)),
+		Encrypted:  *password != "",
+	})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case models.ReportFormatCSV:
+		err = csv.WriteCSV(records, &buf)
+	case models.ReportFormatXLSX:
+		f, buildErr := xlsx.WriteXLSX(records)
+		if buildErr != nil {
+			return buildErr
+		}
+		err = xlsx.Save(f, &buf, xlsx.SaveOptions{Password: *password, Stamp: stamp})
+	default:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(records)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(*file, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return a.out.message(map[string]interface{}{"file": *file, "rows": len(records)},
+		fmt.Sprintf("exported %d %s to %s", len(records), *kind, *file))
+}
+
+// toRecords превращает срез моделей в строки с ключами из json-тегов
+func toRecords(data interface{}) ([]map[string]interface{}, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	records := []map[string]interface{}{}
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// decodeFile читает JSON-массив или CSV с заголовком из json-имён полей в срез структур
+func decodeFile(path string, dst interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return json.NewDecoder(f).Decode(dst)
+	case ".csv":
+		return decodeCSV(f, dst)
+	default:
+		return fmt.Errorf("unsupported import format %q", filepath.Ext(path))
+	}
+}
+
+func decodeCSV(r io.Reader, dst interface{}) error {
+	reader := stdcsv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	slice := reflect.ValueOf(dst).Elem()
+	elemType := slice.Type().Elem()
+	fields := jsonFields(elemType)
+	for _, name := range header {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("unknown CSV column %q", name)
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		elem := reflect.New(elemType).Elem()
+		for i, value := range record {
+			if value == "" {
+				continue
+			}
+			field := elem.Field(fields[header[i]])
+			if err := setField(field, value); err != nil {
+				return fmt.Errorf("line %d, column %q: %w", line, header[i], err)
+			}
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+}
+
+func jsonFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/password"
+)
+
+func createAdmin(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("user create-admin")
+	username := fs.String("username", "", "login of the new administrator (required)")
+	password := fs.String("password", "", "password; generated when empty")
+	inn := fs.String("inn", "", "INN")
+	company := fs.String("company", "", "company name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+
+	generated := *password == ""
+	if generated {
+		var err error
+		if *password, err = generatePassword(); err != nil {
+			return err
+		}
+	}
+
+	user, err := a.services.User.Create(ctx, &models.UserCreateRequest{
+		INN:         *inn,
+		Username:    *username,
+		Password:    *password,
+		CompanyName: *company,
+		IsActive:    true,
+		IsAdmin:     true,
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.out.message(credentialsResult(user, *password, generated),
+		fmt.Sprintf("created admin %s (id %d)%s; the password must be changed at the first login", user.Username, user.ID, passwordNote(*password, generated)))
+}
+
+func resetPassword(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("user reset-password")
+	id := fs.Int("id", 0, "user ID")
+	username := fs.String("username", "", "user login")
+	password := fs.String("password", "", "new password; generated when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	user, err := findUser(ctx, a, *id, *username)
+	if err != nil {
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		if *password, err = generatePassword(); err != nil {
+			return err
+		}
+	}
+
+	user, err = a.services.User.Update(ctx, user.ID, &models.UserUpdateRequest{Password: password})
+	if err != nil {
+		return err
+	}
+
+	return a.out.message(credentialsResult(user, *password, generated),
+		fmt.Sprintf("password of %s (id %d) reset%s; it must be changed at the next login", user.Username, user.ID, passwordNote(*password, generated)))
+}
+
+func resetTwoFactor(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("user reset-2fa")
+	id := fs.Int("id", 0, "user ID")
+	username := fs.String("username", "", "user login")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	user, err := findUser(ctx, a, *id, *username)
+	if err != nil {
+		return err
+	}
+	if err := a.services.User.ResetTwoFactor(ctx, user.ID); err != nil {
+		return err
+	}
+
+	return a.out.message(map[string]interface{}{"id": user.ID, "username": user.Username},
+		fmt.Sprintf("two-factor authentication of %s (id %d) reset", user.Username, user.ID))
+}
+
+func listUsers(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("user list")
+	company := fs.String("company", "", "filter by company name substring")
+	var active, admin optionalBool
+	fs.Var(&active, "active", "filter by active flag")
+	fs.Var(&admin, "admin", "filter by admin flag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	users, err := a.services.User.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := make([]*models.User, 0, len(users))
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		if !active.matches(u.IsActive) || !admin.matches(u.IsAdmin) || !containsFold(u.CompanyName, *company) {
+			continue
+		}
+		result = append(result, u)
+		rows = append(rows, []string{
+			strconv.Itoa(u.ID), u.Username, u.INN, u.CompanyName, formatBool(u.IsActive), formatBool(u.IsAdmin),
+		})
+	}
+
+	return a.out.print(result, []string{"ID", "USERNAME", "INN", "COMPANY", "ACTIVE", "ADMIN"}, rows)
+}
+
+func findUser(ctx context.Context, a *app, id int, username string) (*models.User, error) {
+	if id != 0 {
+		return a.services.User.GetByID(ctx, id)
+	}
+	if username == "" {
+		return nil, errors.New("-id or -username is required")
+	}
+	return a.services.User.GetByUsername(ctx, username)
+}
+
+func credentialsResult(user *models.User, password string, generated bool) map[string]interface{} {
+	result := map[string]interface{}{"id": user.ID, "username": user.Username}
+	if generated {
+		result["password"] = password
+	}
+	return result
+}
+
+func passwordNote(password string, generated bool) string {
+	if !generated {
+		return ""
+	}
+	return ", generated password: " + password
+}
+
+const passwordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789!#%+-=?@_"
+
+// generatePassword повторяет попытку, пока в пароле не будет всех классов
+// символов: так он подходит под любую PASSWORD_REQUIRED_CLASSES
+func generatePassword() (string, error) {
+	all := []password.Class{password.Lower, password.Upper, password.Digit, password.Symbol}
+	for {
+		var b strings.Builder
+		for i := 0; i < 16; i++ {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(passwordAlphabet))))
+			if err != nil {
+				return "", err
+			}
+			b.WriteByte(passwordAlphabet[n.Int64()])
+		}
+		if len(password.Missing(b.String(), all)) == 0 {
+			return b.String(), nil
+		}
+	}
+}
+
+func containsFold(s, substr string) bool {
+	return substr == "" || strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
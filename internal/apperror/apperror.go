@@ -0,0 +1,123 @@
+// Package apperror — доменные ошибки. Репозитории и сервисы возвращают их,
+// а обработчики переводят в HTTP-статус и ErrorResponse в одном месте.
+package apperror
+
+import (
+	"errors"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+)
+
+type Kind string
+
+const (
+	KindBadRequest   Kind = "bad_request"
+	KindUnauthorized Kind = "unauthorized"
+	KindForbidden    Kind = "forbidden"
+	KindNotFound     Kind = "not_found"
+	KindConflict     Kind = "conflict"
+	KindValidation   Kind = "validation"
+	// KindBindingViolation — запрос нарушает связь терминала с фискальным модулем или владельцем
+	KindBindingViolation   Kind = "binding_violation"
+	KindPreconditionFailed Kind = "precondition_failed"
+	KindLocked             Kind = "locked"
+	KindInternal           Kind = "internal"
+)
+
+type Error struct {
+	Kind Kind
+	// Code — машиночитаемый код, который получает клиент
+	Code    string
+	Message string
+	Details []models.ErrorDetail
+	// RetryAfter — через сколько клиенту имеет смысл повторить запрос
+	RetryAfter time.Duration
+	// Err — исходная ошибка (например, sql.ErrNoRows); клиенту не показывается
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is сравнивает ошибки по виду и коду, поэтому errors.Is находит
+// ErrTerminalNotFound и после Wrap или WithDetails
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+// Wrap возвращает копию ошибки с причиной err
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithDetails возвращает копию ошибки с добавленными деталями по полям
+func (e *Error) WithDetails(details ...models.ErrorDetail) *Error {
+	c := *e
+	c.Details = append(append([]models.ErrorDetail(nil), e.Details...), details...)
+	return &c
+}
+
+// WithRetryAfter возвращает копию ошибки с подсказкой, когда повторить запрос
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	c := *e
+	c.RetryAfter = d
+	return &c
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func BadRequest(code, message string) *Error { return New(KindBadRequest, code, message) }
+
+func Unauthorized(code, message string) *Error { return New(KindUnauthorized, code, message) }
+
+func Forbidden(code, message string) *Error { return New(KindForbidden, code, message) }
+
+func NotFound(code, message string) *Error { return New(KindNotFound, code, message) }
+
+func Conflict(code, message string) *Error { return New(KindConflict, code, message) }
+
+func Validation(code, message string, details ...models.ErrorDetail) *Error {
+	return New(KindValidation, code, message).WithDetails(details...)
+}
+
+func BindingViolation(code, message string) *Error { return New(KindBindingViolation, code, message) }
+
+func PreconditionFailed(code, message string) *Error {
+	return New(KindPreconditionFailed, code, message)
+}
+
+func Locked(code, message string) *Error { return New(KindLocked, code, message) }
+
+// Invalid — ошибка валидации одного поля
+func Invalid(field, code, message string) *Error {
+	return Validation(CodeValidationFailed, message, models.ErrorDetail{Field: field, Code: code, Message: message})
+}
+
+// As достаёт доменную ошибку из цепочки
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// KindOf возвращает вид ошибки; всё, что не доменная ошибка, считается внутренней
+func KindOf(err error) Kind {
+	if e, ok := As(err); ok {
+		return e.Kind
+	}
+	return KindInternal
+}
@@ -0,0 +1,39 @@
+package apperror
+
+const CodeValidationFailed = "validation_failed"
+
+// Ошибки, общие для репозиториев и сервисов
+var (
+	ErrUserNotFound           = NotFound("user_not_found", "user not found")
+	ErrFiscalModuleNotFound   = NotFound("fiscal_module_not_found", "fiscal module not found")
+	ErrTerminalNotFound       = NotFound("terminal_not_found", "terminal not found")
+	ErrReportScheduleNotFound = NotFound("report_schedule_not_found", "report schedule not found")
+
+	ErrUsernameTaken             = Conflict("username_taken", "username is already taken")
+	ErrEmailTaken                = Conflict("email_taken", "email is already used by another account")
+	ErrFiscalNumberTaken         = Conflict("fiscal_number_taken", "fiscal number is already registered")
+	ErrFactoryNumberTaken        = Conflict("factory_number_taken", "factory number is already registered")
+	ErrCashRegisterNumberTaken   = Conflict("cash_register_number_taken", "a terminal with this cash register number already exists")
+	ErrReferencedRecordNotFound  = BindingViolation("referenced_record_not_found", "referenced record does not exist")
+	ErrInvalidBinding            = BindingViolation("invalid_binding", "invalid terminal-fiscal module binding")
+	ErrFiscalModuleNotRegistered = BindingViolation("fiscal_module_not_registered", "no fiscal module found with the given factory number")
+
+	ErrVersionMismatch = PreconditionFailed("version_mismatch", "the record was modified by someone else; reload it and retry")
+
+	ErrUnauthenticated    = Unauthorized("unauthenticated", "user is not authenticated")
+	ErrInvalidCredentials = Unauthorized("invalid_credentials", "invalid username or password")
+	ErrAccountLocked      = Locked("account_locked", "account is temporarily locked after repeated failed logins")
+
+	ErrInvalidChallenge        = Unauthorized("invalid_challenge", "login challenge is invalid or expired; log in again")
+	ErrInvalidTwoFactorCode    = Unauthorized("invalid_two_factor_code", "invalid two-factor code")
+	ErrTwoFactorRequired       = Forbidden("two_factor_required", "two-factor authentication is mandatory for this account")
+	ErrTwoFactorNotEnabled     = Conflict("two_factor_not_enabled", "two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = Conflict("two_factor_already_enabled", "two-factor authentication is already enabled; disable it first")
+	ErrTwoFactorNotPending     = Conflict("two_factor_not_pending", "start two-factor enrollment first")
+
+	ErrInvalidUserToken     = BadRequest("invalid_token", "the link is invalid, expired or has already been used")
+	ErrEmailMissing         = Conflict("email_missing", "the account has no email address")
+	ErrEmailAlreadyVerified = Conflict("email_already_verified", "email is already verified")
+
+	ErrWrongPassword = Forbidden("wrong_password", "current password is incorrect")
+)
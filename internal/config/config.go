@@ -1,28 +1,453 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/database"
+	"github.com/idkOybek/newNewTerminal/pkg/mail"
+	"github.com/idkOybek/newNewTerminal/pkg/password"
+	"github.com/idkOybek/newNewTerminal/pkg/ratelimit"
 	"github.com/spf13/viper"
 )
 
+// Режимы сверки схемы БД при старте
+const (
+	SchemaCheckOff    = "off"
+	SchemaCheckWarn   = "warn"
+	SchemaCheckStrict = "strict"
+)
+
+// Config собирается из переменных окружения и необязательного .env. Разделы
+// встроены с squash, поэтому имена переменных остаются плоскими.
+//
+// Теги:
+//   - secret: "true" — Redacted скрывает значение целиком, "url" — только пароль
+//     в адресе. Секрет можно передать файлом через <KEY>_FILE.
+//   - reload: "true" — изменение применяется без перезапуска (см. Reloader).
 type Config struct {
-	ServerPort  string `mapstructure:"SERVER_PORT"`
-	DatabaseURL string `mapstructure:"DATABASE_URL"`
-	JWTSecret   string `mapstructure:"JWT_SECRET"`
-	LogLevel    string `mapstructure:"LOG_LEVEL"`
+	LogLevel string `mapstructure:"LOG_LEVEL" reload:"true"`
+
+	HTTP      HTTPConfig      `mapstructure:",squash"`
+	CORS      CORSConfig      `mapstructure:",squash"`
+	DB        DBConfig        `mapstructure:",squash"`
+	JWT       JWTConfig       `mapstructure:",squash"`
+	SMTP      SMTPConfig      `mapstructure:",squash"`
+	Export    ExportConfig    `mapstructure:",squash"`
+	Scheduler SchedulerConfig `mapstructure:",squash"`
+	Company   CompanyConfig   `mapstructure:",squash"`
+	Metrics   MetricsConfig   `mapstructure:",squash"`
+	Tracing   TracingConfig   `mapstructure:",squash"`
+	RateLimit RateLimitConfig `mapstructure:",squash"`
+	Lockout   LockoutConfig   `mapstructure:",squash"`
+	TwoFactor TwoFactorConfig `mapstructure:",squash"`
+	Account   AccountConfig   `mapstructure:",squash"`
+	Password  PasswordConfig  `mapstructure:",squash"`
+
+	// USER_DELETE_POLICY: restrict, deactivate или cascade
+	UserDeletePolicy models.UserDeletePolicy `mapstructure:"USER_DELETE_POLICY"`
+	// IDEMPOTENCY_TTL: сколько хранить ответы на POST с Idempotency-Key, 0 — заголовок игнорируется
+	IdempotencyTTL time.Duration `mapstructure:"IDEMPOTENCY_TTL"`
+}
+
+type HTTPConfig struct {
+	ServerPort        string        `mapstructure:"SERVER_PORT"`
+	ReadTimeout       time.Duration `mapstructure:"HTTP_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `mapstructure:"HTTP_READ_HEADER_TIMEOUT"`
+	// HTTP_WRITE_TIMEOUT должен покрывать самые долгие выгрузки и pprof-профиль (30s)
+	WriteTimeout time.Duration `mapstructure:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout  time.Duration `mapstructure:"HTTP_IDLE_TIMEOUT"`
+
+	// SHUTDOWN_DRAIN_DELAY: сколько /readyz отвечает 503 перед остановкой сервера;
+	// должно быть больше периода readiness-пробы
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+	// SHUTDOWN_TIMEOUT: сколько ждать завершения текущих запросов
+	ShutdownTimeout time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+
+	// TRUST_PROXY_HEADERS: брать адрес клиента из X-Forwarded-For/X-Real-IP.
+	// Включать только за прокси, который перезаписывает эти заголовки
+	TrustProxyHeaders bool `mapstructure:"TRUST_PROXY_HEADERS"`
+}
+
+type CORSConfig struct {
+	// CORS_ALLOWED_ORIGINS: через запятую, "*" — любой источник
+	AllowedOrigins []string `mapstructure:"CORS_ALLOWED_ORIGINS" reload:"true"`
+}
+
+type DBConfig struct {
+	DatabaseURL string `mapstructure:"DATABASE_URL" secret:"url"`
+
+	MaxOpenConns    int           `mapstructure:"DB_MAX_OPEN_CONNS" reload:"true"`
+	MaxIdleConns    int           `mapstructure:"DB_MAX_IDLE_CONNS" reload:"true"`
+	ConnMaxLifetime time.Duration `mapstructure:"DB_CONN_MAX_LIFETIME" reload:"true"`
+	ConnMaxIdleTime time.Duration `mapstructure:"DB_CONN_MAX_IDLE_TIME" reload:"true"`
+
+	// MIGRATE_ON_START применяет встроенные миграции перед запуском сервера
+	MigrateOnStart bool `mapstructure:"MIGRATE_ON_START"`
+	// SCHEMA_CHECK: off, warn (только лог) или strict (сервер не стартует)
+	SchemaCheck string `mapstructure:"SCHEMA_CHECK"`
+}
+
+type JWTConfig struct {
+	// JWT_SECRET подписывает новые токены
+	Secret string `mapstructure:"JWT_SECRET" secret:"true" reload:"true"`
+	// JWT_PREVIOUS_SECRETS: прежние ключи через запятую. Токены, подписанные ими,
+	// принимаются до истечения — так ключ меняется без разлогинивания всех
+	PreviousSecrets []string      `mapstructure:"JWT_PREVIOUS_SECRETS" secret:"true" reload:"true"`
+	TTL             time.Duration `mapstructure:"JWT_TTL" reload:"true"`
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"SMTP_HOST"`
+	Port     string `mapstructure:"SMTP_PORT"`
+	Username string `mapstructure:"SMTP_USERNAME"`
+	Password string `mapstructure:"SMTP_PASSWORD" secret:"true"`
+	From     string `mapstructure:"SMTP_FROM"`
+}
+
+type ExportConfig struct {
+	// PUBLIC_BASE_URL — внешний адрес API, на который ведут QR-коды в документах
+	PublicBaseURL string `mapstructure:"PUBLIC_BASE_URL"`
+	ReportsDir    string `mapstructure:"REPORTS_DIR"`
+}
+
+type SchedulerConfig struct {
+	ReportsInterval          time.Duration `mapstructure:"REPORTS_INTERVAL"`
+	RetentionInterval        time.Duration `mapstructure:"RETENTION_INTERVAL"`
+	IdempotencyPurgeInterval time.Duration `mapstructure:"IDEMPOTENCY_PURGE_INTERVAL"`
+	RateLimitPurgeInterval   time.Duration `mapstructure:"RATE_LIMIT_PURGE_INTERVAL"`
+	UserTokenPurgeInterval   time.Duration `mapstructure:"USER_TOKEN_PURGE_INTERVAL"`
+	// CONFIG_RELOAD_INTERVAL: как часто перечитывать конфигурацию (в том числе
+	// файлы *_FILE), 0 — только по SIGHUP
+	ConfigReloadInterval time.Duration `mapstructure:"CONFIG_RELOAD_INTERVAL"`
+
+	// SOFT_DELETE_RETENTION: сколько хранить удалённые записи, 0 — бессрочно
+	SoftDeleteRetention time.Duration `mapstructure:"SOFT_DELETE_RETENTION"`
+}
+
+type CompanyConfig struct {
+	// COMPANY_REGISTRY: адрес реестра налогоплательщиков (http/https) или путь к JSON-файлу
+	Registry        string        `mapstructure:"COMPANY_REGISTRY" secret:"url"`
+	RegistryTimeout time.Duration `mapstructure:"COMPANY_REGISTRY_TIMEOUT"`
+	// COMPANY_CHECK: off, warn (только лог) или strict (запрос отклоняется)
+	Check models.CompanyCheckMode `mapstructure:"COMPANY_CHECK"`
+}
+
+type MetricsConfig struct {
+	// METRICS_ADDR: отдельный адрес для /metrics, чтобы метрики не торчали наружу
+	// вместе с API; пустая строка — /metrics на основном порту
+	Addr string `mapstructure:"METRICS_ADDR"`
+	// METRICS_INTERVAL: как часто пересчитывать сводку по парку
+	Interval time.Duration `mapstructure:"METRICS_INTERVAL"`
+	// TERMINAL_STALE_AFTER: сколько терминал может молчать, прежде чем считаться устаревшим
+	TerminalStaleAfter time.Duration `mapstructure:"TERMINAL_STALE_AFTER"`
+}
+
+type TracingConfig struct {
+	// TRACING_EXPORTER: off, stdout или otlp (адрес коллектора — OTEL_EXPORTER_OTLP_ENDPOINT)
+	Exporter    string  `mapstructure:"TRACING_EXPORTER"`
+	SampleRatio float64 `mapstructure:"TRACING_SAMPLE_RATIO"`
+}
+
+// RateLimitConfig — лимиты запросов по группам маршрутов в формате
+// "ip:20/1m,user:100/1m" (ключ ip, user или device); пустая строка — без лимита
+type RateLimitConfig struct {
+	// RATE_LIMIT_STORE: memory (счётчики у каждой реплики свои) или postgres (общие)
+	Store string `mapstructure:"RATE_LIMIT_STORE"`
+	// RATE_LIMIT_AUTH: вход и регистрация
+	Auth string `mapstructure:"RATE_LIMIT_AUTH"`
+	// RATE_LIMIT_TERMINAL_STATUS: проверка и статус терминала
+	TerminalStatus string `mapstructure:"RATE_LIMIT_TERMINAL_STATUS"`
+	// RATE_LIMIT_API: остальные запросы после аутентификации
+	API string `mapstructure:"RATE_LIMIT_API"`
+}
+
+type LockoutConfig struct {
+	// LOGIN_LOCKOUT_THRESHOLD: после скольких неудачных входов подряд блокировать, 0 — не блокировать
+	Threshold int `mapstructure:"LOGIN_LOCKOUT_THRESHOLD"`
+	// LOGIN_LOCKOUT_BASE: длительность первой блокировки; каждая следующая вдвое дольше
+	Base time.Duration `mapstructure:"LOGIN_LOCKOUT_BASE"`
+	// LOGIN_LOCKOUT_MAX: предел длительности блокировки
+	Max time.Duration `mapstructure:"LOGIN_LOCKOUT_MAX"`
+}
+
+type TwoFactorConfig struct {
+	// TOTP_ISSUER — название сервиса в приложении-аутентификаторе
+	Issuer string `mapstructure:"TOTP_ISSUER"`
+	// MFA_CHALLENGE_TTL: сколько действует токен между вводом пароля и кода
+	ChallengeTTL time.Duration `mapstructure:"MFA_CHALLENGE_TTL"`
+	// MFA_REQUIRED_FOR_ADMINS: администратор не получит токен, пока не подключит второй фактор
+	RequiredForAdmins bool `mapstructure:"MFA_REQUIRED_FOR_ADMINS"`
+}
+
+type AccountConfig struct {
+	// NOTIFIER: smtp (письма через SMTP_*), file (в каталог NOTIFY_DIR) или log.
+	// file и log — только для разработки: ссылки с токенами остаются на диске или в логе
+	Notifier  string `mapstructure:"NOTIFIER"`
+	NotifyDir string `mapstructure:"NOTIFY_DIR"`
+	// PASSWORD_RESET_TTL и EMAIL_VERIFICATION_TTL: сколько действуют ссылки из писем
+	PasswordResetTTL     time.Duration `mapstructure:"PASSWORD_RESET_TTL"`
+	EmailVerificationTTL time.Duration `mapstructure:"EMAIL_VERIFICATION_TTL"`
+	// PASSWORD_RESET_URL и EMAIL_VERIFICATION_URL: страницы клиента, к которым
+	// добавляется ?token=; пусто — в письме только токен
+	PasswordResetURL     string `mapstructure:"PASSWORD_RESET_URL"`
+	EmailVerificationURL string `mapstructure:"EMAIL_VERIFICATION_URL"`
+}
+
+type PasswordConfig struct {
+	// PASSWORD_MIN_LENGTH: не больше 72 — дальше bcrypt пароль не различает
+	MinLength int `mapstructure:"PASSWORD_MIN_LENGTH"`
+	// PASSWORD_REQUIRED_CLASSES: через запятую lower, upper, digit, symbol; пусто — без требований
+	RequiredClasses string `mapstructure:"PASSWORD_REQUIRED_CLASSES"`
+	// PASSWORD_BREACHED_LIST: файл утёкших паролей, по одному в строке (или SHA-1,
+	// как в выгрузке Have I Been Pwned); пусто — без проверки
+	BreachedList string `mapstructure:"PASSWORD_BREACHED_LIST"`
+	// PASSWORD_HISTORY: сколько последних паролей, включая текущий, нельзя повторить; 0 — можно
+	History int `mapstructure:"PASSWORD_HISTORY"`
+	// PASSWORD_CHANGE_TTL: сколько действует токен для смены пароля, заданного администратором
+	ChangeTTL time.Duration `mapstructure:"PASSWORD_CHANGE_TTL"`
+}
+
+var defaults = map[string]interface{}{
+	"LOG_LEVEL": "info",
+
+	"SERVER_PORT":              "8080",
+	"HTTP_READ_TIMEOUT":        "30s",
+	"HTTP_READ_HEADER_TIMEOUT": "10s",
+	"HTTP_WRITE_TIMEOUT":       "2m",
+	"HTTP_IDLE_TIMEOUT":        "2m",
+	"SHUTDOWN_DRAIN_DELAY":     "5s",
+	"SHUTDOWN_TIMEOUT":         "5s",
+	"TRUST_PROXY_HEADERS":      false,
+
+	"CORS_ALLOWED_ORIGINS": "*",
+
+	"DATABASE_URL":          "",
+	"DB_MAX_OPEN_CONNS":     25,
+	"DB_MAX_IDLE_CONNS":     5,
+	"DB_CONN_MAX_LIFETIME":  "30m",
+	"DB_CONN_MAX_IDLE_TIME": "5m",
+	"MIGRATE_ON_START":      false,
+	"SCHEMA_CHECK":          SchemaCheckWarn,
+
+	"JWT_SECRET":           "",
+	"JWT_PREVIOUS_SECRETS": "",
+	"JWT_TTL":              "24h",
+
+	"SMTP_HOST":     "",
+	"SMTP_PORT":     "587",
+	"SMTP_USERNAME": "",
+	"SMTP_PASSWORD": "",
+	"SMTP_FROM":     "",
+
+	"PUBLIC_BASE_URL": "https://txkm-vipos.uz",
+	"REPORTS_DIR":     "./reports",
+
+	"REPORTS_INTERVAL":           "1m",
+	"RETENTION_INTERVAL":         "1h",
+	"IDEMPOTENCY_PURGE_INTERVAL": "1h",
+	"RATE_LIMIT_PURGE_INTERVAL":  "10m",
+	"USER_TOKEN_PURGE_INTERVAL":  "1h",
+	"CONFIG_RELOAD_INTERVAL":     "1m",
+	"SOFT_DELETE_RETENTION":      "2160h",
+
+	"COMPANY_REGISTRY":         "",
+	"COMPANY_REGISTRY_TIMEOUT": "5s",
+	"COMPANY_CHECK":            "warn",
+
+	"METRICS_ADDR":         ":9090",
+	"METRICS_INTERVAL":     "1m",
+	"TERMINAL_STALE_AFTER": "168h",
+
+	"TRACING_EXPORTER":     "off",
+	"TRACING_SAMPLE_RATIO": 1.0,
+
+	"RATE_LIMIT_STORE":           "memory",
+	"RATE_LIMIT_AUTH":            "ip:20/1m",
+	"RATE_LIMIT_TERMINAL_STATUS": "ip:600/1m,device:60/1m",
+	"RATE_LIMIT_API":             "user:600/1m",
+
+	"LOGIN_LOCKOUT_THRESHOLD": 5,
+	"LOGIN_LOCKOUT_BASE":      "1m",
+	"LOGIN_LOCKOUT_MAX":       "1h",
+
+	"TOTP_ISSUER":             "Terminal Backend",
+	"MFA_CHALLENGE_TTL":       "5m",
+	"MFA_REQUIRED_FOR_ADMINS": true,
+
+	"NOTIFIER":               "log",
+	"NOTIFY_DIR":             "./notifications",
+	"PASSWORD_RESET_TTL":     "1h",
+	"EMAIL_VERIFICATION_TTL": "48h",
+	"PASSWORD_RESET_URL":     "",
+	"EMAIL_VERIFICATION_URL": "",
+
+	"PASSWORD_MIN_LENGTH":       8,
+	"PASSWORD_REQUIRED_CLASSES": "lower,upper,digit",
+	"PASSWORD_BREACHED_LIST":    "",
+	"PASSWORD_HISTORY":          5,
+	"PASSWORD_CHANGE_TTL":       "10m",
+
+	"USER_DELETE_POLICY": "restrict",
+	"IDEMPOTENCY_TTL":    "24h",
+}
+
+// LoadConfig читает окружение и .env, если он есть, подставляет секреты из
+// *_FILE и проверяет результат. Каждый вызов читает всё заново.
+func LoadConfig() (Config, error) {
+	v := viper.New()
+	v.AddConfigPath(".")
+	v.SetConfigName(".env")
+	v.SetConfigType("env")
+
+	// Значения по умолчанию нужны ещё и для того, чтобы viper подхватывал
+	// из окружения ключи, которых нет в .env
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	v.AutomaticEnv()
+
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return Config{}, fmt.Errorf("failed to read .env: %w", err)
+		}
+	}
+
+	if err := readSecretFiles(v); err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// readSecretFiles подставляет содержимое файла из <KEY>_FILE вместо значения
+// секрета — так передаются docker/kubernetes secrets
+func readSecretFiles(v *viper.Viper) error {
+	var errs ValidationError
+	for _, key := range secretKeys() {
+		path := v.GetString(key + "_FILE")
+		if path == "" {
+			continue
+		}
+		if v.IsSet(key) && v.GetString(key) != "" {
+			errs = append(errs, fmt.Sprintf("%s and %s_FILE are both set", key, key))
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s_FILE: %v", key, err))
+			continue
+		}
+		v.Set(key, strings.TrimRight(string(content), "\r\n"))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c DBConfig) Pool() database.Pool {
+	return database.Pool{
+		MaxOpenConns:    c.MaxOpenConns,
+		MaxIdleConns:    c.MaxIdleConns,
+		ConnMaxLifetime: c.ConnMaxLifetime,
+		ConnMaxIdleTime: c.ConnMaxIdleTime,
+	}
 }
 
-func LoadConfig() (config Config, err error) {
-	viper.AddConfigPath(".")
-	viper.SetConfigName(".env")
-	viper.SetConfigType("env")
+func (c JWTConfig) Keys() auth.Keys {
+	return auth.Keys{
+		Secret:   c.Secret,
+		Previous: c.PreviousSecrets,
+		TTL:      c.TTL,
+	}
+}
 
-	viper.AutomaticEnv()
+// Правила уже проверены в Validate, поэтому ошибку разбора можно не возвращать
 
-	err = viper.ReadInConfig()
-	if err != nil {
-		return
+func (c RateLimitConfig) AuthRules() []ratelimit.Rule {
+	rules, _ := ratelimit.ParseRules(c.Auth)
+	return rules
+}
+
+func (c RateLimitConfig) TerminalStatusRules() []ratelimit.Rule {
+	rules, _ := ratelimit.ParseRules(c.TerminalStatus)
+	return rules
+}
+
+func (c RateLimitConfig) APIRules() []ratelimit.Rule {
+	rules, _ := ratelimit.ParseRules(c.API)
+	return rules
+}
+
+func (c LockoutConfig) Policy() models.LockoutPolicy {
+	return models.LockoutPolicy{
+		Threshold: c.Threshold,
+		Base:      c.Base,
+		Max:       c.Max,
 	}
+}
 
-	err = viper.Unmarshal(&config)
-	return
+func (c TwoFactorConfig) Policy() models.TwoFactorPolicy {
+	return models.TwoFactorPolicy{
+		Issuer:            c.Issuer,
+		ChallengeTTL:      c.ChallengeTTL,
+		RequiredForAdmins: c.RequiredForAdmins,
+	}
+}
+
+func (c AccountConfig) Policy() models.AccountPolicy {
+	return models.AccountPolicy{
+		PasswordResetTTL:     c.PasswordResetTTL,
+		EmailVerificationTTL: c.EmailVerificationTTL,
+		PasswordResetURL:     c.PasswordResetURL,
+		EmailVerificationURL: c.EmailVerificationURL,
+	}
+}
+
+// Классы уже проверены в Validate
+func (c PasswordConfig) Policy() models.PasswordPolicy {
+	classes, _ := password.ParseClasses(c.RequiredClasses)
+	names := make([]string, 0, len(classes))
+	for _, class := range classes {
+		names = append(names, string(class))
+	}
+	return models.PasswordPolicy{
+		MinLength:       c.MinLength,
+		RequiredClasses: names,
+		History:         c.History,
+		ChangeTTL:       c.ChangeTTL,
+	}
+}
+
+// Breached загружает PASSWORD_BREACHED_LIST; nil, если список не задан
+func (c PasswordConfig) Breached() (*password.List, error) {
+	if c.BreachedList == "" {
+		return nil, nil
+	}
+	return password.LoadList(c.BreachedList)
+}
+
+func (c SMTPConfig) Mail() mail.Config {
+	return mail.Config{
+		Host:     c.Host,
+		Port:     c.Port,
+		Username: c.Username,
+		Password: c.Password,
+		From:     c.From,
+	}
 }
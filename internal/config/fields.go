@@ -0,0 +1,40 @@
+package config
+
+import "reflect"
+
+// field — одна настройка: имя переменной окружения, теги и значение
+type field struct {
+	key   string
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+// fields обходит Config вместе со встроенными разделами в порядке объявления.
+// Для reflect.ValueOf(&cfg).Elem() значения можно менять.
+func fields(v reflect.Value) []field {
+	var result []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("mapstructure")
+		if key == ",squash" {
+			result = append(result, fields(v.Field(i))...)
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		result = append(result, field{key: key, tag: sf.Tag, value: v.Field(i)})
+	}
+	return result
+}
+
+func secretKeys() []string {
+	var keys []string
+	for _, f := range fields(reflect.ValueOf(Config{})) {
+		if f.tag.Get("secret") != "" {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
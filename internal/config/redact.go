@@ -0,0 +1,47 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// dsnPassword — пароль в DSN вида "host=... password=secret"
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('[^']*'|\S+)`)
+
+// Redacted возвращает действующую конфигурацию по именам переменных окружения
+// со скрытыми секретами — для просмотра администратором
+func (c Config) Redacted() map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, f := range fields(reflect.ValueOf(c)) {
+		value := f.value.Interface()
+		secret := f.tag.Get("secret")
+
+		switch v := value.(type) {
+		case string:
+			if v != "" && secret == "true" {
+				value = redacted
+			} else if v != "" && secret == "url" {
+				value = redactURL(v)
+			}
+		case []string:
+			if len(v) > 0 && secret != "" {
+				value = redacted
+			}
+		case time.Duration:
+			value = v.String()
+		}
+		values[f.key] = value
+	}
+	return values
+}
+
+func redactURL(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(s, "${1}"+redacted)
+}
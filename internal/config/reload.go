@@ -0,0 +1,91 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+// Reloader перечитывает конфигурацию и применяет изменения настроек с тегом
+// reload. Остальные изменения только логируются: они вступят в силу после
+// перезапуска. Ошибочная конфигурация не применяется, действующая остаётся.
+type Reloader struct {
+	mu        sync.Mutex
+	current   Config
+	listeners []func(prev, next Config)
+	// pending — изменения, ждущие перезапуска; о них пишем в лог один раз
+	pending []string
+	load    func() (Config, error)
+	logger  *logger.Logger
+}
+
+func NewReloader(cfg Config, logger *logger.Logger) *Reloader {
+	return &Reloader{
+		current: cfg,
+		load:    LoadConfig,
+		logger:  logger,
+	}
+}
+
+// OnReload регистрирует получателя изменений; вызывается только если
+// изменилась хотя бы одна настройка с тегом reload
+func (r *Reloader) OnReload(fn func(prev, next Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Current — действующая конфигурация с учётом применённых перезагрузок
+func (r *Reloader) Current() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload подходит как задача планировщика и как обработчик SIGHUP
+func (r *Reloader) Reload(ctx context.Context, _ time.Time) error {
+	next, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.current
+	merged := old
+	var applied, pending []string
+
+	oldFields := fields(reflect.ValueOf(old))
+	nextFields := fields(reflect.ValueOf(next))
+	mergedFields := fields(reflect.ValueOf(&merged).Elem())
+	for i, f := range nextFields {
+		if reflect.DeepEqual(f.value.Interface(), oldFields[i].value.Interface()) {
+			continue
+		}
+		if f.tag.Get("reload") == "true" {
+			mergedFields[i].value.Set(f.value)
+			applied = append(applied, f.key)
+		} else {
+			pending = append(pending, f.key)
+		}
+	}
+
+	if len(pending) > 0 && !reflect.DeepEqual(pending, r.pending) {
+		r.logger.Ctx(ctx).Warnw("Configuration changes take effect after a restart", "keys", pending)
+	}
+	r.pending = pending
+	if len(applied) == 0 {
+		return nil
+	}
+
+	r.current = merged
+	for _, fn := range r.listeners {
+		fn(old, merged)
+	}
+	r.logger.Ctx(ctx).Infow("Configuration reloaded", "keys", applied)
+	return nil
+}
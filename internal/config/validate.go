@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/idkOybek/newNewTerminal/pkg/password"
+	"github.com/idkOybek/newNewTerminal/pkg/ratelimit"
+	"go.uber.org/zap/zapcore"
+)
+
+// ValidationError перечисляет все ошибки конфигурации сразу, а не по одной за запуск
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
+}
+
+func (c Config) Validate() error {
+	var errs ValidationError
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	_, err := zapcore.ParseLevel(c.LogLevel)
+	check(err == nil, "LOG_LEVEL %q is not a log level", c.LogLevel)
+
+	port, err := strconv.Atoi(c.HTTP.ServerPort)
+	check(err == nil && port > 0 && port < 65536, "SERVER_PORT %q is not a port number", c.HTTP.ServerPort)
+	check(c.HTTP.ReadTimeout >= 0, "HTTP_READ_TIMEOUT must not be negative")
+	check(c.HTTP.ReadHeaderTimeout >= 0, "HTTP_READ_HEADER_TIMEOUT must not be negative")
+	check(c.HTTP.WriteTimeout >= 0, "HTTP_WRITE_TIMEOUT must not be negative")
+	check(c.HTTP.IdleTimeout >= 0, "HTTP_IDLE_TIMEOUT must not be negative")
+	check(c.HTTP.ShutdownDrainDelay >= 0, "SHUTDOWN_DRAIN_DELAY must not be negative")
+	check(c.HTTP.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+
+	check(len(c.CORS.AllowedOrigins) > 0, "CORS_ALLOWED_ORIGINS is required, use * to allow any origin")
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(validOrigin(origin), "CORS_ALLOWED_ORIGINS: %q is not an origin like https://example.com", origin)
+	}
+
+	check(c.DB.DatabaseURL != "", "DATABASE_URL is required")
+	check(c.DB.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+	check(c.DB.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+	check(c.DB.MaxOpenConns == 0 || c.DB.MaxIdleConns <= c.DB.MaxOpenConns, "DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
+	check(c.DB.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+	check(c.DB.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(oneOf(c.DB.SchemaCheck, SchemaCheckOff, SchemaCheckWarn, SchemaCheckStrict), "SCHEMA_CHECK %q must be off, warn or strict", c.DB.SchemaCheck)
+
+	check(c.JWT.Secret != "", "JWT_SECRET is required")
+	check(c.JWT.TTL > 0, "JWT_TTL must be positive")
+
+	check(c.Scheduler.ReportsInterval > 0, "REPORTS_INTERVAL must be positive")
+	check(c.Scheduler.RetentionInterval > 0, "RETENTION_INTERVAL must be positive")
+	check(c.Scheduler.IdempotencyPurgeInterval > 0, "IDEMPOTENCY_PURGE_INTERVAL must be positive")
+	check(c.Scheduler.RateLimitPurgeInterval > 0, "RATE_LIMIT_PURGE_INTERVAL must be positive")
+	check(c.Scheduler.UserTokenPurgeInterval > 0, "USER_TOKEN_PURGE_INTERVAL must be positive")
+	check(c.Scheduler.ConfigReloadInterval >= 0, "CONFIG_RELOAD_INTERVAL must not be negative")
+	check(c.Scheduler.SoftDeleteRetention >= 0, "SOFT_DELETE_RETENTION must not be negative")
+
+	check(c.Company.RegistryTimeout > 0, "COMPANY_REGISTRY_TIMEOUT must be positive")
+	check(c.Company.Check.Valid(), "COMPANY_CHECK %q must be off, warn or strict", c.Company.Check)
+
+	check(c.Metrics.Interval > 0, "METRICS_INTERVAL must be positive")
+	check(c.Metrics.TerminalStaleAfter >= 0, "TERMINAL_STALE_AFTER must not be negative")
+
+	check(oneOf(c.Tracing.Exporter, "off", "stdout", "otlp"), "TRACING_EXPORTER %q must be off, stdout or otlp", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+
+	check(oneOf(c.RateLimit.Store, "memory", "postgres"), "RATE_LIMIT_STORE %q must be memory or postgres", c.RateLimit.Store)
+	for key, spec := range map[string]string{
+		"RATE_LIMIT_AUTH":            c.RateLimit.Auth,
+		"RATE_LIMIT_TERMINAL_STATUS": c.RateLimit.TerminalStatus,
+		"RATE_LIMIT_API":             c.RateLimit.API,
+	} {
+		_, err := ratelimit.ParseRules(spec)
+		check(err == nil, "%s: %v", key, err)
+	}
+
+	check(c.Lockout.Threshold >= 0, "LOGIN_LOCKOUT_THRESHOLD must not be negative")
+	check(c.Lockout.Threshold == 0 || c.Lockout.Base > 0, "LOGIN_LOCKOUT_BASE must be positive")
+	check(c.Lockout.Threshold == 0 || c.Lockout.Max >= c.Lockout.Base, "LOGIN_LOCKOUT_MAX must not be less than LOGIN_LOCKOUT_BASE")
+
+	check(c.TwoFactor.Issuer != "" && !strings.Contains(c.TwoFactor.Issuer, ":"), "TOTP_ISSUER is required and must not contain a colon")
+	check(c.TwoFactor.ChallengeTTL > 0, "MFA_CHALLENGE_TTL must be positive")
+
+	check(oneOf(c.Account.Notifier, "smtp", "file", "log"), "NOTIFIER %q must be smtp, file or log", c.Account.Notifier)
+	check(c.Account.Notifier != "smtp" || (c.SMTP.Host != "" && c.SMTP.From != ""), "NOTIFIER=smtp requires SMTP_HOST and SMTP_FROM")
+	check(c.Account.Notifier != "file" || c.Account.NotifyDir != "", "NOTIFY_DIR is required for NOTIFIER=file")
+	check(c.Account.PasswordResetTTL > 0, "PASSWORD_RESET_TTL must be positive")
+	check(c.Account.EmailVerificationTTL > 0, "EMAIL_VERIFICATION_TTL must be positive")
+	for key, link := range map[string]string{
+		"PASSWORD_RESET_URL":     c.Account.PasswordResetURL,
+		"EMAIL_VERIFICATION_URL": c.Account.EmailVerificationURL,
+	} {
+		check(link == "" || validLink(link), "%s %q is not an http(s) URL", key, link)
+	}
+
+	check(c.Password.MinLength >= 1 && c.Password.MinLength <= 72, "PASSWORD_MIN_LENGTH must be between 1 and 72")
+	_, err = password.ParseClasses(c.Password.RequiredClasses)
+	check(err == nil, "PASSWORD_REQUIRED_CLASSES: %v", err)
+	check(c.Password.History >= 0, "PASSWORD_HISTORY must not be negative")
+	check(c.Password.ChangeTTL > 0, "PASSWORD_CHANGE_TTL must be positive")
+
+	check(c.UserDeletePolicy.Valid(), "USER_DELETE_POLICY %q must be restrict, deactivate or cascade", c.UserDeletePolicy)
+	check(c.IdempotencyTTL >= 0, "IDEMPOTENCY_TTL must not be negative")
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && (u.Path == "" || u.Path == "/")
+}
+
+func validLink(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
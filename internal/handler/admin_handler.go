@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/pprof"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+// AdminHandler — диагностика работающего сервера: уровень логирования,
+// pprof, дамп горутин и действующая конфигурация. Только для администраторов.
+type AdminHandler struct {
+	config func() map[string]interface{}
+	logger *logger.Logger
+}
+
+// NewAdminHandler: config возвращает действующую конфигурацию, уже очищенную
+// от секретов (config.Config.Redacted)
+func NewAdminHandler(config func() map[string]interface{}, logger *logger.Logger) *AdminHandler {
+	return &AdminHandler{
+		config: config,
+		logger: logger,
+	}
+}
+
+// @Security Bearer
+// @Summary Get the log level
+// @Description Current log level; revert_to and expires_at are set while a temporary level is active
+// @Tags admin
+// @Produce  json
+// @Success 200 {object} models.LogLevelResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/log-level [get]
+func (h *AdminHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	RespondWithJSON(w, http.StatusOK, h.logLevel())
+}
+
+// @Security Bearer
+// @Summary Change the log level
+// @Description Change the log level without a restart. With ttl the level reverts to the previous one when it expires.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param level body models.LogLevelRequest true "New log level"
+// @Success 200 {object} models.LogLevelResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Router /admin/log-level [put]
+func (h *AdminHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req models.LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		RespondWithAppError(w, r, err, "Failed to change log level")
+		return
+	}
+
+	var err error
+	if req.TTL == "" {
+		err = h.logger.SetLevel(req.Level)
+	} else {
+		ttl, parseErr := time.ParseDuration(req.TTL)
+		if parseErr != nil || ttl <= 0 {
+			RespondWithAppError(w, r, apperror.Invalid("ttl", "duration", `ttl must be a positive duration, e.g. "15m"`), "Failed to change log level")
+			return
+		}
+		err = h.logger.SetLevelFor(req.Level, ttl)
+	}
+	if err != nil {
+		RespondWithAppError(w, r, err, "Failed to change log level")
+		return
+	}
+
+	h.logger.Ctx(r.Context()).Warnw("Log level changed", "level", req.Level, "ttl", req.TTL)
+	RespondWithJSON(w, http.StatusOK, h.logLevel())
+}
+
+// @Security Bearer
+// @Summary Get the effective configuration
+// @Description Configuration the server is running with, keyed by environment variable; secrets are redacted
+// @Tags admin
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/config [get]
+func (h *AdminHandler) Config(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	RespondWithJSON(w, http.StatusOK, h.config())
+}
+
+// @Security Bearer
+// @Summary Dump goroutines
+// @Description Stack traces of all goroutines in plain text
+// @Tags admin
+// @Produce  plain
+// @Success 200 {string} string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/goroutines [get]
+func (h *AdminHandler) Goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := pprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to dump goroutines", "error", err)
+	}
+}
+
+func (h *AdminHandler) logLevel() models.LogLevelResponse {
+	status := h.logger.Level()
+	response := models.LogLevelResponse{
+		Level:    status.Level,
+		RevertTo: status.RevertTo,
+	}
+	if !status.ExpiresAt.IsZero() {
+		response.ExpiresAt = &status.ExpiresAt
+	}
+	return response
+}
+
+// Routes: pprof доступен по /debug/pprof/, например /debug/pprof/heap
+func (h *AdminHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/log-level", h.GetLogLevel)
+	r.Put("/log-level", h.SetLogLevel)
+	r.Get("/config", h.Config)
+	r.Get("/goroutines", h.Goroutines)
+	r.Mount("/debug", middleware.Profiler())
+	return r
+}
@@ -11,39 +11,44 @@ import (
 )
 
 type AuthHandler struct {
-	service *service.AuthService
-	logger  *logger.Logger
+	service  *service.AuthService
+	accounts *service.AccountService
+	logger   *logger.Logger
 }
 
-func NewAuthHandler(service *service.AuthService, logger *logger.Logger) *AuthHandler {
+func NewAuthHandler(service *service.AuthService, accounts *service.AccountService, logger *logger.Logger) *AuthHandler {
 	return &AuthHandler{
-		service: service,
-		logger:  logger,
+		service:  service,
+		accounts: accounts,
+		logger:   logger,
 	}
 }
 
 // @Summary Register a new user
-// @Description Register a new user with the given input
+// @Description Register a new user with the given input. If an email is given, a verification link is sent to it. is_admin and is_active are ignored: the user is created active and without admin rights.
 // @Tags auth
 // @Accept  json
 // @Produce  json
 // @Param user body models.UserCreateRequest true "User registration info"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
 // @Success 201 {object} models.User
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.UserCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
 		return
 	}
 
 	user, err := h.service.Register(r.Context(), &req)
 	if err != nil {
-		h.logger.Error("Failed to register user", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to register user")
+		h.logger.Ctx(r.Context()).Errorw("Failed to register user", "error", err)
+		RespondWithAppError(w, r, err, "Failed to register user")
 		return
 	}
 
@@ -51,37 +56,233 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Login user
-// @Description Authenticate a user and return a token
+// @Description Authenticate a user and return a token. If the password was set by an admin, the response has password_change_required and a challenge_token for /auth/password/change instead. If the account uses two-factor authentication, the response has mfa_required and a challenge_token for /auth/login/2fa instead. An admin who must use two-factor authentication but has not set it up gets mfa_enrollment_required and a challenge_token for /auth/2fa/enroll and /auth/2fa/confirm.
 // @Tags auth
 // @Accept  json
 // @Produce  json
 // @Param credentials body models.UserLoginRequest true "User login credentials"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
 // @Success 200 {object} models.UserLoginResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Header 423 {integer} Retry-After "Seconds until the lockout ends"
 // @Failure 500 {object} models.ErrorResponse
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req models.UserLoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
 		return
 	}
 
+	// Ответ не кешируется и не сохраняется по Idempotency-Key: ни токен,
+	// ни отказ из-за блокировки, который устареет вместе с ней
+	w.Header().Set("Cache-Control", "no-store")
+
 	resp, err := h.service.Login(r.Context(), &req)
 	if err != nil {
-		h.logger.Error("Failed to login user", "error", err)
-		RespondWithError(w, http.StatusUnauthorized, "Invalid username or password")
+		h.logger.Ctx(r.Context()).Errorw("Failed to login user", "error", err)
+		RespondWithAppError(w, r, err, "Failed to login user")
 		return
 	}
 
 	RespondWithJSON(w, http.StatusOK, resp)
 }
 
+// @Summary Complete login with a second factor
+// @Description Second login step for accounts with two-factor authentication: send the challenge_token returned by /auth/login with either a code from the authenticator app or a one-time recovery code
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param credentials body models.LoginTwoFactorRequest true "Challenge token and code"
+// @Success 200 {object} models.UserLoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/login/2fa [post]
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp, err := h.service.LoginTwoFactor(r.Context(), &req)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to complete two-factor login", "error", err)
+		RespondWithAppError(w, r, err, "Failed to login user")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// @Summary Request a password reset
+// @Description Send a single-use password reset link to the verified email of the account with this username or email. The response is the same whether or not such an account exists.
+// @Tags auth
+// @Accept  json
+// @Param request body models.ForgotPasswordRequest true "Username or email"
+// @Success 202
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password/forgot [post]
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	if err := h.accounts.ForgotPassword(r.Context(), &req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to request password reset", "error", err)
+		RespondWithAppError(w, r, err, "Failed to request password reset")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary Reset password
+// @Description Set a new password with the token from the password reset email. The token works once; the login lockout is lifted.
+// @Tags auth
+// @Accept  json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password/reset [post]
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	// Повтор с тем же Idempotency-Key должен снова проверить токен, а не получить сохранённый успех
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := h.accounts.ResetPassword(r.Context(), &req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to reset password", "error", err)
+		RespondWithAppError(w, r, err, "Failed to reset password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Verify email
+// @Description Confirm the user's email with the token from the verification email
+// @Tags auth
+// @Accept  json
+// @Param request body models.VerifyEmailRequest true "Verification token"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/email/verify [post]
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	if err := h.accounts.VerifyEmail(r.Context(), &req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to verify email", "error", err)
+		RespondWithAppError(w, r, err, "Failed to verify email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Change password
+// @Description Change the current user's password. Accepts a regular access token or the challenge_token of a login that returned password_change_required; in the latter case the login continues and the response is the next login step or the access token. With a regular token the response is empty.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Security Bearer
+// @Param request body models.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} models.UserLoginResponse
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/password/change [post]
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp, err := h.service.ChangePassword(r.Context(), &req)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to change password", "error", err)
+		RespondWithAppError(w, r, err, "Failed to change password")
+		return
+	}
+
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// @Summary Resend the verification email
+// @Description Send a new verification link to the current user's unverified email; earlier links stop working
+// @Tags auth
+// @Security Bearer
+// @Success 202
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/email/verify/resend [post]
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if err := h.accounts.ResendVerification(r.Context()); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to resend verification email", "error", err)
+		RespondWithAppError(w, r, err, "Failed to resend verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func (h *AuthHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Post("/register", h.Register)
 	r.Post("/login", h.Login)
+	r.Post("/login/2fa", h.LoginTwoFactor)
+	r.Post("/password/forgot", h.ForgotPassword)
+	r.Post("/password/reset", h.ResetPassword)
+	r.Post("/email/verify", h.VerifyEmail)
 	return r
 }
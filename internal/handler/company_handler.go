@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/newNewTerminal/internal/service"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+type CompanyHandler struct {
+	service *service.CompanyService
+	logger  *logger.Logger
+}
+
+func NewCompanyHandler(service *service.CompanyService, logger *logger.Logger) *CompanyHandler {
+	return &CompanyHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// @Security Bearer
+// @Summary Look up a company in the taxpayer registry
+// @Description Find a company by a 9-digit INN or an individual by a 14-digit PINFL
+// @Tags companies
+// @Accept  json
+// @Produce  json
+// @Param tax_id path string true "INN or PINFL"
+// @Success 200 {object} models.Company
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /companies/{tax_id} [get]
+func (h *CompanyHandler) Lookup(w http.ResponseWriter, r *http.Request) {
+	company, err := h.service.Lookup(r.Context(), chi.URLParam(r, "taxID"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to look up company", "error", err)
+		RespondWithAppError(w, r, err, "Failed to look up company")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, company)
+}
+
+func (h *CompanyHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/{taxID}", h.Lookup)
+	return r
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setETag отдаёт версию записи в заголовке ETag; клиент возвращает его в If-Match
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatchVersion читает If-Match. Отсутствие заголовка и "*" версию не ограничивают (nil).
+// Слабые теги W/"3" принимаются наравне с "3".
+func ifMatchVersion(r *http.Request) (*int, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return nil, true
+	}
+
+	tag, err := strconv.Unquote(strings.TrimPrefix(value, "W/"))
+	if err != nil {
+		return nil, false
+	}
+	version, err := strconv.Atoi(tag)
+	if err != nil || version <= 0 {
+		return nil, false
+	}
+	return &version, true
+}
+
+// applyIfMatch переносит версию из If-Match в запрос на обновление.
+// При некорректном заголовке отвечает 400 и возвращает false.
+func applyIfMatch(w http.ResponseWriter, r *http.Request, version **int) bool {
+	v, ok := ifMatchVersion(r)
+	if !ok {
+		respondBadRequest(w, r, "invalid_if_match", `If-Match must be an ETag returned by the API, e.g. "3"`)
+		return false
+	}
+	if v != nil {
+		*version = v
+	}
+	return true
+}
@@ -1,46 +1,63 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/service"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/pdf"
 	"github.com/idkOybek/newNewTerminal/pkg/xlsx"
 )
 
 type ExportHandler struct {
-	logger      *logger.Logger
-	userService *service.UserService
+	logger          *logger.Logger
+	userService     *service.UserService
+	exportService   *service.ExportService
+	documentService *service.DocumentService
 }
 
-func NewExportHandler(logger *logger.Logger, userService *service.UserService) *ExportHandler {
+func NewExportHandler(logger *logger.Logger, userService *service.UserService, exportService *service.ExportService, documentService *service.DocumentService) *ExportHandler {
 	return &ExportHandler{
-		logger:      logger,
-		userService: userService,
+		logger:          logger,
+		userService:     userService,
+		exportService:   exportService,
+		documentService: documentService,
 	}
 }
 
 // @Security Bearer
 // @Summary Export data to XLSX
-// @Description Export given data to XLSX format
+// @Description Export given data to XLSX format. The file carries the exporting user and time in its header and footer and can be encrypted with a password. Every export is recorded in the audit log.
 // @Tags export
 // @Accept json
 // @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
 // @Param request body models.ExportRequest true "Export request"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
 // @Success 200 {file} string "exported_data.xlsx"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /export [post]
 func (h *ExportHandler) ExportXLSX(w http.ResponseWriter, r *http.Request) {
 	var req models.ExportRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		RespondWithAppError(w, r, err, "Failed to generate XLSX")
 		return
 	}
 
@@ -64,20 +81,182 @@ func (h *ExportHandler) ExportXLSX(w http.ResponseWriter, r *http.Request) {
 	// Создаем XLSX файл
 	xlsxFile, err := xlsx.WriteXLSX(req.Objects)
 	if err != nil {
-		h.logger.Error("Failed to create XLSX", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to generate XLSX")
+		h.logger.Ctx(r.Context()).Errorw("Failed to create XLSX", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate XLSX")
+		return
+	}
+
+	stamp, err := h.exportService.Audit(r.Context(), &models.ExportAuditEntry{
+		ExportType: models.ExportTypeObjects,
+		Format:     models.ReportFormatXLSX,
+		Filename:   filename,
+		RowCount:   len(req.Objects),
+		Encrypted:  req.Password != "",
+		RemoteAddr: r.RemoteAddr,
+	})
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to record export", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate XLSX")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := xlsx.Save(xlsxFile, &buf, xlsx.SaveOptions{Password: req.Password, Stamp: stamp}); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to write XLSX", "error", err)
+		RespondWithAppError(w, r, err, "Failed to send XLSX")
 		return
 	}
 
 	// Устанавливаем заголовки для XLSX файла
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Write(buf.Bytes())
+}
 
-	// Записываем XLSX файл в ответ
-	err = xlsxFile.Write(w)
+// @Security Bearer
+// @Summary Export the whole fleet to a multi-sheet XLSX workbook
+// @Description Export terminals, fiscal modules, users and a summary sheet with counts per company and status. Admin only.
+// @Tags export
+// @Accept json
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param request body models.FleetExportRequest false "Export options"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
+// @Success 200 {file} string "fleet.xlsx"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /export/fleet [post]
+func (h *ExportHandler) ExportFleetXLSX(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeFleetRequest(w, r)
+	if !ok {
+		return
+	}
+
+	xlsxFile, rowCount, err := h.exportService.FleetWorkbook(r.Context())
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to build fleet workbook", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate XLSX")
+		return
+	}
+
+	filename := fmt.Sprintf("fleet_%s.xlsx", time.Now().Format("2006-01-02"))
+	stamp, err := h.exportService.Audit(r.Context(), &models.ExportAuditEntry{
+		ExportType: models.ExportTypeFleet,
+		Format:     models.ReportFormatXLSX,
+		Filename:   filename,
+		RowCount:   rowCount,
+		Encrypted:  req.Password != "",
+		RemoteAddr: r.RemoteAddr,
+	})
 	if err != nil {
-		h.logger.Error("Failed to write XLSX to response", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to send XLSX")
+		h.logger.Ctx(r.Context()).Errorw("Failed to record export", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate XLSX")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := xlsx.Save(xlsxFile, &buf, xlsx.SaveOptions{Password: req.Password, Stamp: stamp}); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to write XLSX", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate XLSX")
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Write(buf.Bytes())
+}
+
+// @Security Bearer
+// @Summary Export the terminal fleet to PDF
+// @Description Render the list of all terminals as a PDF table. Admin only.
+// @Tags export
+// @Accept json
+// @Produce application/pdf
+// @Param request body models.FleetExportRequest false "Export options"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
+// @Success 200 {file} string "terminals.pdf"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /export/fleet/pdf [post]
+func (h *ExportHandler) ExportFleetPDF(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeFleetRequest(w, r)
+	if !ok {
+		return
+	}
+
+	table, err := h.documentService.TerminalsTable(r.Context())
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to build terminals table", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate PDF")
+		return
+	}
+
+	filename := fmt.Sprintf("terminals_%s.pdf", time.Now().Format("2006-01-02"))
+	stamp, err := h.exportService.Audit(r.Context(), &models.ExportAuditEntry{
+		ExportType: models.ExportTypeFleetPDF,
+		Format:     models.ReportFormatPDF,
+		Filename:   filename,
+		RowCount:   len(table.Rows),
+		Encrypted:  req.Password != "",
+		RemoteAddr: r.RemoteAddr,
+	})
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to record export", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate PDF")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.WriteTable(&buf, table, pdf.Options{Password: req.Password, Stamp: stamp}); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to render terminals PDF", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate PDF")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Write(buf.Bytes())
+}
+
+// @Security Bearer
+// @Summary List recorded exports
+// @Description Get the most recent exports with their row counts, filters and requesting users. Admin only.
+// @Tags export
+// @Produce json
+// @Param limit query int false "Maximum number of entries" default(100)
+// @Success 200 {array} models.ExportAuditEntry
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /export/audit [get]
+func (h *ExportHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	entries, err := h.exportService.ListAudit(r.Context(), limit)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to fetch export audit log", "error", err)
+		RespondWithAppError(w, r, err, "Failed to fetch export audit log")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, entries)
+}
+
+// decodeFleetRequest читает необязательное тело с параметрами выгрузки
+func (h *ExportHandler) decodeFleetRequest(w http.ResponseWriter, r *http.Request) (*models.FleetExportRequest, bool) {
+	var req models.FleetExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return nil, false
+	}
+	if err := validation.Struct(&req); err != nil {
+		RespondWithAppError(w, r, err, "Invalid export options")
+		return nil, false
+	}
+	return &req, true
 }
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	customMiddleware "github.com/idkOybek/newNewTerminal/internal/middleware"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/service"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
@@ -30,25 +31,30 @@ func NewFiscalModuleHandler(service *service.FiscalModuleService, logger *logger
 // @Accept  json
 // @Produce  json
 // @Param fiscal_module body models.FiscalModuleCreateRequest true "Create fiscal module request"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
 // @Success 201 {object} models.FiscalModuleResponse
+// @Header 201 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /fiscal-modules [post]
 func (h *FiscalModuleHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req models.FiscalModuleCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
 		return
 	}
 
 	module, err := h.service.Create(r.Context(), &req)
 	if err != nil {
-		h.logger.Error("Failed to create fiscal module", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to create fiscal module")
+		h.logger.Ctx(r.Context()).Errorw("Failed to create fiscal module", "error", err)
+		RespondWithAppError(w, r, err, "Failed to create fiscal module")
 		return
 	}
 
+	setETag(w, module.Version)
 	RespondWithJSON(w, http.StatusCreated, module)
 }
 
@@ -60,24 +66,26 @@ func (h *FiscalModuleHandler) Create(w http.ResponseWriter, r *http.Request) {
 // @Produce  json
 // @Param id path int true "Fiscal Module ID"
 // @Success 200 {object} models.FiscalModuleResponse
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /fiscal-modules/{id} [get]
 func (h *FiscalModuleHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid fiscal module ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid fiscal module ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid fiscal module ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid fiscal module ID")
 		return
 	}
 
 	module, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
-		h.logger.Error("Failed to get fiscal module", "error", err)
-		RespondWithError(w, http.StatusNotFound, "Fiscal module not found")
+		h.logger.Ctx(r.Context()).Errorw("Failed to get fiscal module", "error", err)
+		RespondWithAppError(w, r, err, "Failed to get fiscal module")
 		return
 	}
 
+	setETag(w, module.Version)
 	RespondWithJSON(w, http.StatusOK, module)
 }
 
@@ -89,58 +97,69 @@ func (h *FiscalModuleHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 // @Produce  json
 // @Param id path int true "Fiscal Module ID"
 // @Param fiscal_module body models.FiscalModuleUpdateRequest true "Update fiscal module request"
+// @Param If-Match header string false "ETag from a previous response; 412 if the record has changed since"
 // @Success 200 {object} models.FiscalModuleResponse
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /fiscal-modules/{id} [put]
 func (h *FiscalModuleHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid fiscal module ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid fiscal module ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid fiscal module ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid fiscal module ID")
 		return
 	}
 
 	var req models.FiscalModuleUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+	if !applyIfMatch(w, r, &req.Version) {
 		return
 	}
 
 	module, err := h.service.Update(r.Context(), id, &req)
 	if err != nil {
-		h.logger.Error("Failed to update fiscal module", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to update fiscal module")
+		h.logger.Ctx(r.Context()).Errorw("Failed to update fiscal module", "error", err)
+		RespondWithAppError(w, r, err, "Failed to update fiscal module")
 		return
 	}
 
+	setETag(w, module.Version)
 	RespondWithJSON(w, http.StatusOK, module)
 }
 
 // @Security Bearer
 // @Summary Delete a fiscal module
-// @Description Delete a fiscal module by its ID
+// @Description Soft-delete a fiscal module by its ID. Modules bound to a terminal cannot be deleted. Admin only.
 // @Tags fiscal-modules
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Fiscal Module ID"
 // @Success 204 "No Content"
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /fiscal-modules/{id} [delete]
 func (h *FiscalModuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid fiscal module ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid fiscal module ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid fiscal module ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid fiscal module ID")
 		return
 	}
 
 	if err := h.service.Delete(r.Context(), id); err != nil {
-		h.logger.Error("Failed to delete fiscal module", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to delete fiscal module")
+		h.logger.Ctx(r.Context()).Errorw("Failed to delete fiscal module", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to delete fiscal module")
 		return
 	}
 
@@ -159,20 +178,52 @@ func (h *FiscalModuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
 func (h *FiscalModuleHandler) List(w http.ResponseWriter, r *http.Request) {
 	modules, err := h.service.List(r.Context())
 	if err != nil {
-		h.logger.Error("Failed to fetch fiscal modules", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to fetch fiscal modules")
+		h.logger.Ctx(r.Context()).Errorw("Failed to fetch fiscal modules", "error", err)
+		RespondWithAppError(w, r, err, "Failed to fetch fiscal modules")
 		return
 	}
 
 	RespondWithJSON(w, http.StatusOK, modules)
 }
 
+// @Security Bearer
+// @Summary Restore a deleted fiscal module
+// @Description Restore a soft-deleted fiscal module. Admin only.
+// @Tags fiscal-modules
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Fiscal Module ID"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
+// @Success 204 "No Content"
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /fiscal-modules/{id}/restore [post]
+func (h *FiscalModuleHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid fiscal module ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid fiscal module ID")
+		return
+	}
+
+	if err := h.service.Restore(r.Context(), id); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to restore fiscal module", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to restore fiscal module")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *FiscalModuleHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Post("/", h.Create)
 	r.Get("/{id}", h.GetByID)
 	r.Put("/{id}", h.Update)
-	r.Delete("/{id}", h.Delete)
+	r.With(customMiddleware.AdminMiddleware(h.logger)).Delete("/{id}", h.Delete)
+	r.With(customMiddleware.AdminMiddleware(h.logger)).Post("/{id}/restore", h.Restore)
 	r.Get("/", h.List)
 	return r
 }
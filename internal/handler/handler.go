@@ -2,15 +2,62 @@ package handler
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 )
 
+// statusByKind — HTTP-статус для каждого вида доменной ошибки
+var statusByKind = map[apperror.Kind]int{
+	apperror.KindBadRequest:         http.StatusBadRequest,
+	apperror.KindUnauthorized:       http.StatusUnauthorized,
+	apperror.KindForbidden:          http.StatusForbidden,
+	apperror.KindNotFound:           http.StatusNotFound,
+	apperror.KindConflict:           http.StatusConflict,
+	apperror.KindValidation:         http.StatusUnprocessableEntity,
+	apperror.KindBindingViolation:   http.StatusUnprocessableEntity,
+	apperror.KindPreconditionFailed: http.StatusPreconditionFailed,
+	apperror.KindLocked:             http.StatusLocked,
+}
+
 func RespondWithError(w http.ResponseWriter, code int, message string) {
 	RespondWithJSON(w, code, models.ErrorResponse{Error: message})
 }
 
+// RespondWithAppError — единая точка перевода ошибок в HTTP-ответ. Доменная
+// ошибка отдаёт свой статус, код и детали; любая другая считается внутренней,
+// и клиент видит только fallback, без подробностей.
+func RespondWithAppError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	status := http.StatusInternalServerError
+	resp := models.ErrorResponse{
+		Error:     fallback,
+		Code:      "internal_error",
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+
+	if appErr, ok := apperror.As(err); ok {
+		if code, known := statusByKind[appErr.Kind]; known {
+			status = code
+			resp.Error = appErr.Message
+			resp.Code = appErr.Code
+			resp.Details = appErr.Details
+			if appErr.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(appErr.RetryAfter.Seconds()))))
+			}
+		}
+	}
+
+	RespondWithJSON(w, status, resp)
+}
+
+func respondBadRequest(w http.ResponseWriter, r *http.Request, code, message string) {
+	RespondWithAppError(w, r, apperror.BadRequest(code, message), message)
+}
+
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
 
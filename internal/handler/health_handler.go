@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/service"
+)
+
+// HealthHandler — служебные маршруты для оркестратора. Регистрируются в корне,
+// вне /api и без авторизации.
+type HealthHandler struct {
+	service *service.HealthService
+}
+
+func NewHealthHandler(service *service.HealthService) *HealthHandler {
+	return &HealthHandler{service: service}
+}
+
+// Healthz — liveness: процесс жив и обрабатывает запросы. БД не проверяется,
+// чтобы сбой Postgres не приводил к перезапуску всех экземпляров.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	RespondWithJSON(w, http.StatusOK, models.HealthResponse{Status: models.HealthStatusOK})
+}
+
+// Readyz — readiness: БД доступна, миграции применены, сервер не останавливается
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	response := h.service.Ready(r.Context())
+
+	status := http.StatusOK
+	if response.Status != models.HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	RespondWithJSON(w, status, response)
+}
+
+func (h *HealthHandler) Version(w http.ResponseWriter, r *http.Request) {
+	RespondWithJSON(w, http.StatusOK, h.service.Version(r.Context()))
+}
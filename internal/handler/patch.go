@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// decodePatch разбирает тело PATCH в формате JSON Merge Patch (RFC 7396):
+// заполняет типизированный запрос и возвращает маску переданных полей.
+// При ошибке уже отвечает клиенту и возвращает false.
+func decodePatch(w http.ResponseWriter, r *http.Request, req interface{}) (models.FieldMask, bool) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != mergePatchContentType && mediaType != "application/json") {
+			RespondWithJSON(w, http.StatusUnsupportedMediaType, models.ErrorResponse{
+				Error:     "PATCH accepts " + mergePatchContentType + " or application/json",
+				Code:      "unsupported_media_type",
+				RequestID: middleware.GetReqID(r.Context()),
+			})
+			return nil, false
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		respondBadRequest(w, r, "invalid_payload", "Merge patch must be a JSON object")
+		return nil, false
+	}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(req); err != nil {
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return nil, false
+	}
+
+	mask := make(models.FieldMask, len(fields))
+	for field, raw := range fields {
+		mask[field] = string(bytes.TrimSpace(raw)) != "null"
+	}
+	return mask, true
+}
@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/service"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+type ReportHandler struct {
+	service *service.ReportService
+	logger  *logger.Logger
+}
+
+func NewReportHandler(service *service.ReportService, logger *logger.Logger) *ReportHandler {
+	return &ReportHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// @Security Bearer
+// @Summary Create a report schedule
+// @Description Create a recurring report with a cron expression, filters, format and delivery target. Only admins can use webhook delivery; webhooks to private and loopback addresses are refused
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Param schedule body models.ReportScheduleCreateRequest true "Create report schedule request"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
+// @Success 201 {object} models.ReportSchedule
+// @Header 201 {string} ETag "Version of the record; send it back in If-Match"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/schedules [post]
+func (h *ReportHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req models.ReportScheduleCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	schedule, err := h.service.CreateSchedule(r.Context(), &req)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to create report schedule", "error", err)
+		RespondWithAppError(w, r, err, "Failed to save report schedule")
+		return
+	}
+
+	setETag(w, schedule.Version)
+	RespondWithJSON(w, http.StatusCreated, schedule)
+}
+
+// @Security Bearer
+// @Summary List report schedules
+// @Description List the current user's report schedules (all schedules for admins)
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.ReportSchedule
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/schedules [get]
+func (h *ReportHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.service.ListSchedules(r.Context())
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to fetch report schedules", "error", err)
+		RespondWithAppError(w, r, err, "Failed to fetch report schedules")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, schedules)
+}
+
+// @Security Bearer
+// @Summary Get a report schedule by ID
+// @Description Get details of a report schedule by its ID
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Report schedule ID"
+// @Success 200 {object} models.ReportSchedule
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/schedules/{id} [get]
+func (h *ReportHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid report schedule ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid report schedule ID")
+		return
+	}
+
+	schedule, err := h.service.GetSchedule(r.Context(), id)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to get report schedule", "error", err)
+		RespondWithAppError(w, r, err, "Failed to get report schedule")
+		return
+	}
+
+	setETag(w, schedule.Version)
+	RespondWithJSON(w, http.StatusOK, schedule)
+}
+
+// @Security Bearer
+// @Summary Update a report schedule
+// @Description Update a report schedule by its ID. Only admins can set webhook delivery
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Report schedule ID"
+// @Param schedule body models.ReportScheduleUpdateRequest true "Update report schedule request"
+// @Param If-Match header string false "ETag from a previous response; 412 if the record has changed since"
+// @Success 200 {object} models.ReportSchedule
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/schedules/{id} [put]
+func (h *ReportHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid report schedule ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid report schedule ID")
+		return
+	}
+
+	var req models.ReportScheduleUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+	if !applyIfMatch(w, r, &req.Version) {
+		return
+	}
+
+	schedule, err := h.service.UpdateSchedule(r.Context(), id, &req)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to update report schedule", "error", err)
+		RespondWithAppError(w, r, err, "Failed to save report schedule")
+		return
+	}
+
+	setETag(w, schedule.Version)
+	RespondWithJSON(w, http.StatusOK, schedule)
+}
+
+// @Security Bearer
+// @Summary Delete a report schedule
+// @Description Delete a report schedule and its run history
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Report schedule ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/schedules/{id} [delete]
+func (h *ReportHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid report schedule ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid report schedule ID")
+		return
+	}
+
+	if err := h.service.DeleteSchedule(r.Context(), id); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to delete report schedule", "error", err)
+		RespondWithAppError(w, r, err, "Failed to get report schedule")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Security Bearer
+// @Summary Run a report now
+// @Description Generate and deliver a scheduled report immediately
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Report schedule ID"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
+// @Success 200 {object} models.ReportRun
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/schedules/{id}/run [post]
+func (h *ReportHandler) RunNow(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid report schedule ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid report schedule ID")
+		return
+	}
+
+	run, err := h.service.RunNow(r.Context(), id)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to run report", "error", err)
+		if run != nil {
+			// Запуск сохранён в истории — возвращаем его вместе с ошибкой
+			RespondWithJSON(w, http.StatusInternalServerError, run)
+			return
+		}
+		RespondWithAppError(w, r, err, "Failed to run report")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, run)
+}
+
+// @Security Bearer
+// @Summary List report runs
+// @Description Get the run history of a report schedule
+// @Tags reports
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Report schedule ID"
+// @Success 200 {array} models.ReportRun
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/schedules/{id}/runs [get]
+func (h *ReportHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid report schedule ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid report schedule ID")
+		return
+	}
+
+	runs, err := h.service.ListRuns(r.Context(), id)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to fetch report runs", "error", err)
+		RespondWithAppError(w, r, err, "Failed to get report schedule")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, runs)
+}
+
+func (h *ReportHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/schedules", h.CreateSchedule)
+	r.Get("/schedules", h.ListSchedules)
+	r.Get("/schedules/{id}", h.GetSchedule)
+	r.Put("/schedules/{id}", h.UpdateSchedule)
+	r.Delete("/schedules/{id}", h.DeleteSchedule)
+	r.Post("/schedules/{id}/run", h.RunNow)
+	r.Get("/schedules/{id}/runs", h.ListRuns)
+	return r
+}
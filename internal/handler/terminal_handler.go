@@ -1,24 +1,34 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	customMiddleware "github.com/idkOybek/newNewTerminal/internal/middleware"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/service"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/pdf"
 )
 
 type TerminalHandler struct {
-	service *service.TerminalService
-	logger  *logger.Logger
+	service         *service.TerminalService
+	documentService *service.DocumentService
+	exportService   *service.ExportService
+	logger          *logger.Logger
+	// statusLimits — ограничения частоты для проверок статуса, которые терминалы шлют сами
+	statusLimits []func(http.Handler) http.Handler
 }
 
-func NewTerminalHandler(service *service.TerminalService, logger *logger.Logger) *TerminalHandler {
+func NewTerminalHandler(service *service.TerminalService, documentService *service.DocumentService, exportService *service.ExportService, logger *logger.Logger) *TerminalHandler {
 	if service == nil {
 		log.Println("Error: TerminalService is nil in NewTerminalHandler")
 		return nil
@@ -28,8 +38,10 @@ func NewTerminalHandler(service *service.TerminalService, logger *logger.Logger)
 	}
 
 	return &TerminalHandler{
-		service: service,
-		logger:  logger,
+		service:         service,
+		documentService: documentService,
+		exportService:   exportService,
+		logger:          logger,
 	}
 }
 
@@ -40,27 +52,32 @@ func NewTerminalHandler(service *service.TerminalService, logger *logger.Logger)
 // @Accept  json
 // @Produce  json
 // @Param terminal body models.TerminalCreateRequest true "Create terminal request"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
 // @Success 201 {object} models.Terminal
+// @Header 201 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /terminals [post]
 func (h *TerminalHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req models.TerminalCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
 		return
 	}
 
 	terminal, err := h.service.Create(r.Context(), &req)
 	if err != nil {
-		h.logger.Error("Failed to create terminal", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to create terminal")
+		h.logger.Ctx(r.Context()).Errorw("Failed to create terminal", "error", err)
+		RespondWithAppError(w, r, err, "Failed to create terminal")
 		return
 	}
 
-	h.logger.Info("Terminal created successfully", "id", terminal.ID)
+	h.logger.Ctx(r.Context()).Infow("Terminal created successfully", "id", terminal.ID)
 
+	setETag(w, terminal.Version)
 	RespondWithJSON(w, http.StatusCreated, terminal)
 }
 
@@ -73,20 +90,26 @@ func (h *TerminalHandler) Create(w http.ResponseWriter, r *http.Request) {
 // @Param terminal body models.TerminalExistsRequest true "Cash register number"
 // @Success 200 {object} models.TerminalExistsResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /terminals/exists [Post]
 func (h *TerminalHandler) CheckExists(w http.ResponseWriter, r *http.Request) {
 	var req models.TerminalExistsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		RespondWithAppError(w, r, err, "Failed to check terminal")
 		return
 	}
 
 	response, err := h.service.CheckExists(r.Context(), req.CashRegisterNumber)
 	if err != nil {
-		h.logger.Error("Failed to check terminal existence", "error", err)
-		RespondWithError(w, http.StatusNotFound, "Terminal not found")
+		h.logger.Ctx(r.Context()).Errorw("Failed to check terminal existence", "error", err)
+		RespondWithAppError(w, r, err, "Failed to check terminal")
 		return
 	}
 
@@ -102,21 +125,22 @@ func (h *TerminalHandler) CheckExists(w http.ResponseWriter, r *http.Request) {
 // @Param id path int true "Terminal ID"
 // @Success 200 {object} models.TerminalStatusResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /terminals/status/{id} [get]
 func (h *TerminalHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		h.logger.Error("Invalid terminal ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid terminal ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid terminal ID")
 		return
 	}
 
 	status, err := h.service.GetStatus(r.Context(), id)
 	if err != nil {
-		h.logger.Error("Failed to get terminal status", "error", err)
-		RespondWithError(w, http.StatusNotFound, "Terminal not found")
+		h.logger.Ctx(r.Context()).Errorw("Failed to get terminal status", "error", err)
+		RespondWithAppError(w, r, err, "Failed to get terminal status")
 		return
 	}
 
@@ -131,24 +155,26 @@ func (h *TerminalHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 // @Produce  json
 // @Param id path int true "Terminal ID"
 // @Success 200 {object} models.Terminal
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /terminals/{id} [get]
 func (h *TerminalHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid terminal ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid terminal ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid terminal ID")
 		return
 	}
 
 	terminal, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
-		h.logger.Error("Failed to get terminal", "error", err)
-		RespondWithError(w, http.StatusNotFound, "Terminal not found")
+		h.logger.Ctx(r.Context()).Errorw("Failed to get terminal", "error", err)
+		RespondWithAppError(w, r, err, "Failed to get terminal")
 		return
 	}
 
+	setETag(w, terminal.Version)
 	RespondWithJSON(w, http.StatusOK, terminal)
 }
 
@@ -160,72 +186,131 @@ func (h *TerminalHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 // @Produce  json
 // @Param id path int true "Terminal ID"
 // @Param terminal body models.TerminalUpdateRequest true "Update terminal request"
+// @Param If-Match header string false "ETag from a previous response; 412 if the record has changed since"
 // @Success 200 {object} models.Terminal
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /terminals/{id} [put]
 func (h *TerminalHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid terminal ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid terminal ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid terminal ID")
 		return
 	}
 
 	var req models.TerminalUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+	if !applyIfMatch(w, r, &req.Version) {
 		return
 	}
 
 	// Получаем роль пользователя из контекста
 	isAdmin, ok := r.Context().Value("userRole").(bool)
 	if !ok {
-		h.logger.Error("Failed to get user role from context")
-		RespondWithError(w, http.StatusInternalServerError, "Internal server error")
+		h.logger.Ctx(r.Context()).Errorw("Failed to get user role from context")
+		RespondWithAppError(w, r, apperror.ErrUnauthenticated, "Internal server error")
 		return
 	}
 
 	// Добавим логирование
-	h.logger.Info("User role in handler", "isAdmin", isAdmin)
+	h.logger.Ctx(r.Context()).Infow("User role in handler", "isAdmin", isAdmin)
 
 	// Добавляем роль пользователя в контекст для сервиса
 	ctx := context.WithValue(r.Context(), "userRole", isAdmin)
 
 	terminal, err := h.service.Update(ctx, id, &req)
 	if err != nil {
-		h.logger.Error("Failed to update terminal", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		h.logger.Ctx(r.Context()).Errorw("Failed to update terminal", "error", err)
+		RespondWithAppError(w, r, err, "Failed to update terminal")
+		return
+	}
+
+	setETag(w, terminal.Version)
+	RespondWithJSON(w, http.StatusOK, terminal)
+}
+
+// @Security Bearer
+// @Summary Partially update a terminal
+// @Description Apply a JSON Merge Patch (RFC 7396): only the fields present in the body are written, empty strings and false included. null is rejected because every patchable field is required.
+// @Tags terminals
+// @Accept  json
+// @Accept  application/merge-patch+json
+// @Produce  json
+// @Param id path int true "Terminal ID"
+// @Param terminal body models.TerminalUpdateRequest true "Fields to change"
+// @Param If-Match header string false "ETag from a previous response; 412 if the record has changed since"
+// @Success 200 {object} models.Terminal
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /terminals/{id} [patch]
+func (h *TerminalHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid terminal ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid terminal ID")
+		return
+	}
+
+	var req models.TerminalUpdateRequest
+	mask, ok := decodePatch(w, r, &req)
+	if !ok {
+		return
+	}
+	if !applyIfMatch(w, r, &req.Version) {
 		return
 	}
 
+	terminal, err := h.service.Patch(r.Context(), id, &req, mask)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to patch terminal", "id", id, "fields", mask.Fields(), "error", err)
+		RespondWithAppError(w, r, err, "Failed to update terminal")
+		return
+	}
+
+	setETag(w, terminal.Version)
 	RespondWithJSON(w, http.StatusOK, terminal)
 }
 
 // @Security Bearer
 // @Summary Delete a terminal
-// @Description Delete a terminal by its ID
+// @Description Soft-delete a terminal by its ID. Admin only.
 // @Tags terminals
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Terminal ID"
 // @Success 204 "No Content"
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /terminals/{id} [delete]
 func (h *TerminalHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid terminal ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid terminal ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid terminal ID")
 		return
 	}
 
 	if err := h.service.Delete(r.Context(), id); err != nil {
-		h.logger.Error("Failed to delete terminal", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to delete terminal")
+		h.logger.Ctx(r.Context()).Errorw("Failed to delete terminal", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to delete terminal")
 		return
 	}
 
@@ -244,22 +329,113 @@ func (h *TerminalHandler) Delete(w http.ResponseWriter, r *http.Request) {
 func (h *TerminalHandler) List(w http.ResponseWriter, r *http.Request) {
 	terminals, err := h.service.List(r.Context())
 	if err != nil {
-		h.logger.Error("Failed to fetch terminals", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to fetch terminals")
+		h.logger.Ctx(r.Context()).Errorw("Failed to fetch terminals", "error", err)
+		RespondWithAppError(w, r, err, "Failed to fetch terminals")
 		return
 	}
 
 	RespondWithJSON(w, http.StatusOK, terminals)
 }
 
+// @Security Bearer
+// @Summary Get the activation certificate of a terminal
+// @Description Render the fiscal module activation certificate of a terminal as PDF
+// @Tags terminals
+// @Produce application/pdf
+// @Param id path int true "Terminal ID"
+// @Success 200 {file} string "certificate.pdf"
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /terminals/{id}/certificate [get]
+func (h *TerminalHandler) Certificate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid terminal ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid terminal ID")
+		return
+	}
+
+	certificate, err := h.documentService.ActivationCertificate(r.Context(), id)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to get activation certificate data", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate certificate")
+		return
+	}
+
+	filename := fmt.Sprintf("activation_%d.pdf", id)
+	stamp, err := h.exportService.Audit(r.Context(), &models.ExportAuditEntry{
+		ExportType: models.ExportTypeCertificate,
+		Format:     models.ReportFormatPDF,
+		Filename:   filename,
+		RowCount:   1,
+		Filters:    json.RawMessage(fmt.Sprintf(`{"terminal_id":%d}`, id)),
+		RemoteAddr: r.RemoteAddr,
+	})
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to record export", "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate certificate")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.WriteCertificate(&buf, certificate, pdf.Options{Stamp: stamp}); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to render activation certificate", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to generate certificate")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Write(buf.Bytes())
+}
+
+// @Security Bearer
+// @Summary Restore a deleted terminal
+// @Description Restore a soft-deleted terminal. The terminal can only be restored while its fiscal module is not deleted. Admin only.
+// @Tags terminals
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Terminal ID"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
+// @Success 204 "No Content"
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /terminals/{id}/restore [post]
+func (h *TerminalHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid terminal ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid terminal ID")
+		return
+	}
+
+	if err := h.service.Restore(r.Context(), id); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to restore terminal", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to restore terminal")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LimitStatusChecks добавляет middleware к /exists и /status/{id}; вызывается до Routes
+func (h *TerminalHandler) LimitStatusChecks(middlewares ...func(http.Handler) http.Handler) {
+	h.statusLimits = append(h.statusLimits, middlewares...)
+}
+
 func (h *TerminalHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Post("/", h.Create)
 	r.Get("/{id}", h.GetByID)
 	r.Put("/{id}", h.Update)
-	r.Delete("/{id}", h.Delete)
+	r.Patch("/{id}", h.Patch)
+	r.With(customMiddleware.AdminMiddleware(h.logger)).Delete("/{id}", h.Delete)
+	r.With(customMiddleware.AdminMiddleware(h.logger)).Post("/{id}/restore", h.Restore)
 	r.Get("/", h.List)
-	r.Post("/exists", h.CheckExists)
-	r.Get("/status/{id}", h.GetStatus)
+	r.With(h.statusLimits...).Post("/exists", h.CheckExists)
+	r.With(h.statusLimits...).Get("/status/{id}", h.GetStatus)
+	r.Get("/{id}/certificate", h.Certificate)
 	return r
 }
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	customMiddleware "github.com/idkOybek/newNewTerminal/internal/middleware"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/service"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+// TwoFactorHandler — подключение и отключение второго фактора текущего пользователя
+type TwoFactorHandler struct {
+	service *service.TwoFactorService
+	logger  *logger.Logger
+}
+
+func NewTwoFactorHandler(service *service.TwoFactorService, logger *logger.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// @Security Bearer
+// @Summary Get two-factor status
+// @Description Whether two-factor authentication is enabled or required for the current user and how many recovery codes are left
+// @Tags two-factor
+// @Produce  json
+// @Success 200 {object} models.TwoFactorStatus
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa [get]
+func (h *TwoFactorHandler) Status(w http.ResponseWriter, r *http.Request) {
+	status, err := h.service.Status(r.Context())
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to get two-factor status", "error", err)
+		RespondWithAppError(w, r, err, "Failed to get two-factor status")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, status)
+}
+
+// @Security Bearer
+// @Summary Start two-factor enrollment
+// @Description Generate a new TOTP secret. Scan the QR code (PNG, base64) or enter the secret in an authenticator app, then confirm with a code. Accepts the challenge_token of an admin login that requires enrollment.
+// @Tags two-factor
+// @Produce  json
+// @Success 200 {object} models.TwoFactorEnrollResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/enroll [post]
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.service.Enroll(r.Context())
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to start two-factor enrollment", "error", err)
+		RespondWithAppError(w, r, err, "Failed to start two-factor enrollment")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// @Security Bearer
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication with the first code from the authenticator app. Returns one-time recovery codes, shown only once. When called with an enrollment challenge_token, also returns the access token.
+// @Tags two-factor
+// @Accept  json
+// @Produce  json
+// @Param code body models.TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} models.TwoFactorConfirmResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/confirm [post]
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp, err := h.service.Confirm(r.Context(), &req)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to confirm two-factor enrollment", "error", err)
+		RespondWithAppError(w, r, err, "Failed to confirm two-factor enrollment")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// @Security Bearer
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication with a current code. Not allowed for accounts where it is mandatory.
+// @Tags two-factor
+// @Accept  json
+// @Param code body models.TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/disable [post]
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	if err := h.service.Disable(r.Context(), &req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to disable two-factor authentication", "error", err)
+		RespondWithAppError(w, r, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Security Bearer
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes with new ones; the old codes stop working
+// @Tags two-factor
+// @Accept  json
+// @Produce  json
+// @Param code body models.TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/2fa/recovery-codes [post]
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), &req)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to regenerate recovery codes", "error", err)
+		RespondWithAppError(w, r, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Routes ожидает EnrollmentAuthMiddleware снаружи: подключить второй фактор
+// можно и с токеном входа администратора, остальное — только с токеном доступа
+func (h *TwoFactorHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/enroll", h.Enroll)
+	r.Post("/confirm", h.Confirm)
+	r.Group(func(r chi.Router) {
+		r.Use(customMiddleware.AccessTokenMiddleware(h.logger))
+		r.Get("/", h.Status)
+		r.Post("/disable", h.Disable)
+		r.Post("/recovery-codes", h.RegenerateRecoveryCodes)
+	})
+	return r
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	customMiddleware "github.com/idkOybek/newNewTerminal/internal/middleware"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/service"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
@@ -30,25 +31,30 @@ func NewUserHandler(service *service.UserService, logger *logger.Logger) *UserHa
 // @Accept  json
 // @Produce  json
 // @Param user body models.UserCreateRequest true "Create user request"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
 // @Success 201 {object} models.User
+// @Header 201 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users [post]
 func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req models.UserCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
 		return
 	}
 
 	user, err := h.service.Create(r.Context(), &req)
 	if err != nil {
-		h.logger.Error("Failed to create user", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		h.logger.Ctx(r.Context()).Errorw("Failed to create user", "error", err)
+		RespondWithAppError(w, r, err, "Failed to create user")
 		return
 	}
 
+	setETag(w, user.Version)
 	RespondWithJSON(w, http.StatusCreated, user)
 }
 
@@ -60,87 +66,150 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
 // @Produce  json
 // @Param id path int true "User ID"
 // @Success 200 {object} models.User
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users/{id} [get]
 func (h *UserHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid user ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid user ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid user ID")
 		return
 	}
 
 	user, err := h.service.GetByID(r.Context(), id)
 	if err != nil {
-		h.logger.Error("Failed to get user", "error", err)
-		RespondWithError(w, http.StatusNotFound, "User not found")
+		h.logger.Ctx(r.Context()).Errorw("Failed to get user", "error", err)
+		RespondWithAppError(w, r, err, "Failed to get user")
 		return
 	}
 
+	setETag(w, user.Version)
 	RespondWithJSON(w, http.StatusOK, user)
 }
 
 // @Security Bearer
 // @Summary Update a user
-// @Description Update a user's details by its ID
+// @Description Update a user's details by its ID. Non-admins can change only their own account and cannot change is_admin or is_active. password can only be set by an admin for another user; change your own with POST /auth/password/change. Changing your own email requires current_password; the previous address is notified.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path int true "User ID"
 // @Param user body models.UserUpdateRequest true "Update user request"
+// @Param If-Match header string false "ETag from a previous response; 412 if the record has changed since"
 // @Success 200 {object} models.User
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users/{id} [put]
 func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid user ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid user ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid user ID")
 		return
 	}
 
 	var req models.UserUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request body", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		h.logger.Ctx(r.Context()).Errorw("Failed to decode request body", "error", err)
+		respondBadRequest(w, r, "invalid_payload", "Invalid request payload")
+		return
+	}
+	if !applyIfMatch(w, r, &req.Version) {
 		return
 	}
 
 	user, err := h.service.Update(r.Context(), id, &req)
 	if err != nil {
-		h.logger.Error("Failed to update user", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to update user")
+		h.logger.Ctx(r.Context()).Errorw("Failed to update user", "error", err)
+		RespondWithAppError(w, r, err, "Failed to update user")
+		return
+	}
+
+	setETag(w, user.Version)
+	RespondWithJSON(w, http.StatusOK, user)
+}
+
+// @Security Bearer
+// @Summary Partially update a user
+// @Description Apply a JSON Merge Patch (RFC 7396): only the fields present in the body are written, empty strings and false included. null is rejected because every patchable field is required. Non-admins can change only their own account and cannot change is_admin or is_active. password can only be set by an admin for another user; change your own with POST /auth/password/change. Changing your own email requires current_password; the previous address is notified.
+// @Tags users
+// @Accept  json
+// @Accept  application/merge-patch+json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param user body models.UserUpdateRequest true "Fields to change"
+// @Param If-Match header string false "ETag from a previous response; 412 if the record has changed since"
+// @Success 200 {object} models.User
+// @Header 200 {string} ETag "Version of the record; send it back in If-Match"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id} [patch]
+func (h *UserHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid user ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	var req models.UserUpdateRequest
+	mask, ok := decodePatch(w, r, &req)
+	if !ok {
+		return
+	}
+	if !applyIfMatch(w, r, &req.Version) {
+		return
+	}
+
+	user, err := h.service.Patch(r.Context(), id, &req, mask)
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to patch user", "id", id, "fields", mask.Fields(), "error", err)
+		RespondWithAppError(w, r, err, "Failed to update user")
 		return
 	}
 
+	setETag(w, user.Version)
 	RespondWithJSON(w, http.StatusOK, user)
 }
 
 // @Security Bearer
 // @Summary Delete a user
-// @Description Delete a user by its ID
+// @Description Soft-delete a user by its ID. Depending on the configured policy the user's terminals block the deletion, get deactivated or are deleted together with the user. Admin only.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path int true "User ID"
 // @Success 204 "No Content"
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users/{id} [delete]
 func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Error("Invalid user ID", "error", err)
-		RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		h.logger.Ctx(r.Context()).Errorw("Invalid user ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid user ID")
 		return
 	}
 
 	if err := h.service.Delete(r.Context(), id); err != nil {
-		h.logger.Error("Failed to delete user and associated data", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to delete user and associated data")
+		h.logger.Ctx(r.Context()).Errorw("Failed to delete user and associated data", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to delete user and associated data")
 		return
 	}
 
@@ -159,20 +228,116 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
 	users, err := h.service.List(r.Context())
 	if err != nil {
-		h.logger.Error("Failed to fetch users", "error", err)
-		RespondWithError(w, http.StatusInternalServerError, "Failed to fetch users")
+		h.logger.Ctx(r.Context()).Errorw("Failed to fetch users", "error", err)
+		RespondWithAppError(w, r, err, "Failed to fetch users")
 		return
 	}
 
 	RespondWithJSON(w, http.StatusOK, users)
 }
 
+// @Security Bearer
+// @Summary Restore a deleted user
+// @Description Restore a soft-deleted user together with the terminals and fiscal modules deleted along with it. Admin only.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param Idempotency-Key header string false "Unique key of the request; a retry with the same key replays the stored response instead of running again"
+// @Success 204 "No Content"
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/restore [post]
+func (h *UserHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid user ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	if err := h.service.Restore(r.Context(), id); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to restore user", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to restore user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Security Bearer
+// @Summary Unlock a user
+// @Description Lift the login lockout caused by repeated failed logins and reset the failure counters. Admin only.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/unlock [post]
+func (h *UserHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid user ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	if err := h.service.Unlock(r.Context(), id); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to unlock user", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to unlock user")
+		return
+	}
+
+	h.logger.Ctx(r.Context()).Infow("User unlocked", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Security Bearer
+// @Summary Reset two-factor authentication
+// @Description Disable two-factor authentication of a user who lost the authenticator app and recovery codes. If it is mandatory for the user, they set it up again at the next login. Admin only.
+// @Tags users
+// @Produce  json
+// @Param id path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/2fa/reset [post]
+func (h *UserHandler) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Invalid user ID", "error", err)
+		respondBadRequest(w, r, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	if err := h.service.ResetTwoFactor(r.Context(), id); err != nil {
+		h.logger.Ctx(r.Context()).Errorw("Failed to reset two-factor authentication", "id", id, "error", err)
+		RespondWithAppError(w, r, err, "Failed to reset two-factor authentication")
+		return
+	}
+
+	h.logger.Ctx(r.Context()).Infow("Two-factor authentication reset", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *UserHandler) Routes() chi.Router {
 	r := chi.NewRouter()
 	// r.Post("/", h.Create)
 	r.Get("/{id}", h.GetByID)
 	r.Put("/{id}", h.Update)
-	r.Delete("/{id}", h.Delete)
+	r.Patch("/{id}", h.Patch)
+	r.With(customMiddleware.AdminMiddleware(h.logger)).Delete("/{id}", h.Delete)
+	r.With(customMiddleware.AdminMiddleware(h.logger)).Post("/{id}/restore", h.Restore)
+	r.With(customMiddleware.AdminMiddleware(h.logger)).Post("/{id}/unlock", h.Unlock)
+	r.With(customMiddleware.AdminMiddleware(h.logger)).Post("/{id}/2fa/reset", h.ResetTwoFactor)
 	r.Get("/", h.List)
 	return r
 }
@@ -0,0 +1,149 @@
+// Package metrics собирает метрики Prometheus: HTTP-запросы по шаблонам
+// маршрутов chi, пул соединений database/sql и сводку по парку терминалов.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "terminal_backend"
+
+// unmatchedRoute — метка для запросов мимо маршрутов, чтобы случайные
+// адреса не плодили временные ряды
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	terminals         *prometheus.GaugeVec
+	staleTerminals    prometheus.Gauge
+	fiscalModules     *prometheus.GaugeVec
+	freeRecordBalance *prometheus.GaugeVec
+	fleetUpdated      prometheus.Gauge
+}
+
+// New регистрирует метрики процесса, рантайма Go и пула соединений db
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, chi route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and chi route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		terminals: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "terminals",
+			Help:      "Terminals that are not deleted, by state (active or inactive).",
+		}, []string{"state"}),
+		staleTerminals: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "terminals_stale",
+			Help:      "Active terminals without requests for longer than the stale threshold.",
+		}),
+		fiscalModules: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "fiscal_modules",
+			Help:      "Fiscal modules by state (active, inactive or deleted).",
+		}, []string{"state"}),
+		freeRecordBalance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "free_record_balance",
+			Help:      "Total remaining free records of a company's terminals.",
+		}, []string{"inn", "company"}),
+		fleetUpdated: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "fleet_stats_updated_timestamp_seconds",
+			Help:      "Unix time of the last successful fleet statistics refresh.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "postgres"),
+		m.httpRequests, m.httpDuration,
+		m.terminals, m.staleTerminals, m.fiscalModules, m.freeRecordBalance, m.fleetUpdated,
+	)
+	return m
+}
+
+// Handler отдаёт метрики в формате Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware считает запросы и их длительность. Шаблон маршрута chi
+// известен только после маршрутизации, поэтому метка берётся после next.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		m.httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// SetFleet заменяет бизнес-метрики новой сводкой. Компании, у которых
+// не осталось терминалов, пропадают из метрик.
+func (m *Metrics) SetFleet(stats *models.FleetStats, now time.Time) {
+	m.terminals.WithLabelValues("active").Set(float64(stats.ActiveTerminals))
+	m.terminals.WithLabelValues("inactive").Set(float64(stats.InactiveTerminals))
+	m.staleTerminals.Set(float64(stats.StaleTerminals))
+
+	for _, state := range []string{"active", "inactive", "deleted"} {
+		m.fiscalModules.WithLabelValues(state).Set(float64(stats.ModulesByState[state]))
+	}
+
+	m.freeRecordBalance.Reset()
+	for _, balance := range stats.FreeRecordBalance {
+		m.freeRecordBalance.WithLabelValues(balance.INN, balance.CompanyName).Set(float64(balance.Balance))
+	}
+
+	m.fleetUpdated.Set(float64(now.Unix()))
+}
+
+// FleetCollector возвращает фоновую задачу, которая обновляет бизнес-метрики:
+// запросы к базе выполняются по расписанию, а не при каждом опросе /metrics
+func (m *Metrics) FleetCollector(fleet func(ctx context.Context, now time.Time) (*models.FleetStats, error)) func(ctx context.Context, now time.Time) error {
+	return func(ctx context.Context, now time.Time) error {
+		stats, err := fleet(ctx, now)
+		if err != nil {
+			return err
+		}
+		m.SetFleet(stats, now)
+		return nil
+	}
+}
@@ -6,53 +6,99 @@ import (
 	"strings"
 
 	"github.com/idkOybek/newNewTerminal/pkg/auth"
-	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	log "github.com/idkOybek/newNewTerminal/pkg/logger"
 )
 
-func AuthMiddleware(logger *logger.Logger) func(next http.Handler) http.Handler {
+func AuthMiddleware(tokens *auth.Manager, logger *log.Logger) func(next http.Handler) http.Handler {
+	return authenticate(tokens, logger, "")
+}
+
+// EnrollmentAuthMiddleware пропускает и обычный токен, и токен входа администратора,
+// которому сначала нужно подключить второй фактор
+func EnrollmentAuthMiddleware(tokens *auth.Manager, logger *log.Logger) func(next http.Handler) http.Handler {
+	return authenticate(tokens, logger, "", auth.PurposeMFAEnroll)
+}
+
+// PasswordChangeAuthMiddleware пропускает и обычный токен, и токен входа
+// пользователя, которому нужно сменить пароль, заданный администратором
+func PasswordChangeAuthMiddleware(tokens *auth.Manager, logger *log.Logger) func(next http.Handler) http.Handler {
+	return authenticate(tokens, logger, "", auth.PurposePasswordChange)
+}
+
+// authenticate принимает токены с назначениями из purposes; "" — обычный токен доступа
+func authenticate(tokens *auth.Manager, logger *log.Logger, purposes ...string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				logger.Error("Authorization header is missing")
-				http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+				logger.Ctx(r.Context()).Warnw("Authorization header is missing")
+				respondError(w, r, http.StatusUnauthorized, "authorization_required", "Authorization header is required")
 				return
 			}
 
 			bearerToken := strings.Split(authHeader, " ")
 			if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
-				logger.Error("Invalid authorization header format")
-				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+				logger.Ctx(r.Context()).Warnw("Invalid authorization header format")
+				respondError(w, r, http.StatusUnauthorized, "invalid_authorization_header", "Invalid authorization header format")
 				return
 			}
 
 			token := bearerToken[1]
-			claims, err := auth.ValidateToken(token)
+			claims, err := tokens.ValidateToken(token)
 			if err != nil {
-				logger.Error("Invalid token", "error", err)
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				logger.Ctx(r.Context()).Warnw("Invalid token", "error", err)
+				respondError(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token")
+				return
+			}
+			if !allowedPurpose(claims.Purpose, purposes) {
+				logger.Ctx(r.Context()).Warnw("Token is not an access token", "purpose", claims.Purpose)
+				respondError(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token")
 				return
 			}
 
 			// Добавляем информацию о роли пользователя в контекст
 			ctx := context.WithValue(r.Context(), "user", claims)
 			ctx = context.WithValue(ctx, "userRole", claims.IsAdmin)
-
-			// Добавим логирование
-			logger.Info("User role in middleware", "isAdmin", claims.IsAdmin)
+			ctx = log.WithFields(ctx, "user_id", claims.UserID)
+			logger.Ctx(ctx).Debugw("User role in middleware", "isAdmin", claims.IsAdmin)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func AdminMiddleware(logger *logger.Logger) func(next http.Handler) http.Handler {
+func allowedPurpose(purpose string, allowed []string) bool {
+	for _, p := range allowed {
+		if purpose == p {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessTokenMiddleware ставится после EnrollmentAuthMiddleware на маршруты,
+// которым нужен полноценный вход, а не токен подключения второго фактора
+func AccessTokenMiddleware(logger *log.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("user").(*auth.Claims)
+			if !ok || claims.Purpose != "" {
+				logger.Ctx(r.Context()).Warnw("Access token required")
+				respondError(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func AdminMiddleware(logger *log.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			claims, ok := r.Context().Value("user").(*auth.Claims)
 			if !ok || !claims.IsAdmin {
-				logger.Error("User is not authorized as admin")
-				http.Error(w, "Admin access required", http.StatusForbidden)
+				logger.Ctx(r.Context()).Warnw("User is not authorized as admin")
+				respondError(w, r, http.StatusForbidden, "admin_required", "Admin access required")
 				return
 			}
 			next.ServeHTTP(w, r)
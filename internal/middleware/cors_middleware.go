@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-chi/cors"
+)
+
+// CORS проверяет Origin по списку, который можно заменить на лету через SetOrigins
+type CORS struct {
+	origins atomic.Pointer[[]string]
+}
+
+func NewCORS(origins []string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(origins)
+	return c
+}
+
+func (c *CORS) SetOrigins(origins []string) {
+	c.origins.Store(&origins)
+}
+
+func (c *CORS) Handler() func(next http.Handler) http.Handler {
+	return cors.Handler(cors.Options{
+		AllowOriginFunc: c.allowed,
+		AllowedMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:  []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", IdempotencyKeyHeader, RequestIDHeader, DeviceIDHeader},
+		ExposedHeaders: []string{
+			"Link", "ETag", IdempotentReplayedHeader, RequestIDHeader,
+			"Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+		},
+		AllowCredentials: false,
+		MaxAge:           300,
+	})
+}
+
+func (c *CORS) allowed(_ *http.Request, origin string) bool {
+	for _, allowed := range *c.origins.Load() {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader помечает ответ, повторённый из сохранённого
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// replayedHeaders — заголовки ответа, которые сохраняются вместе с телом
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "ETag", "Location"}
+
+type IdempotencyStore interface {
+	Begin(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *models.IdempotencyRecord) error
+	Release(ctx context.Context, scope, key string) error
+}
+
+// Idempotency повторяет сохранённый ответ на POST с уже встречавшимся
+// заголовком Idempotency-Key. Тот же ключ с другим телом или на другом
+// адресе — 409. Ответы 5xx и ответы с Cache-Control: no-store (например,
+// с токеном) не сохраняются: повтор выполнится заново.
+func Idempotency(store IdempotencyStore, log *logger.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validIdempotencyKey(key) {
+				respondError(w, r, http.StatusBadRequest, "invalid_idempotency_key",
+					fmt.Sprintf("Idempotency-Key must be 1-%d printable ASCII characters", maxIdempotencyKeyLength))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				respondError(w, r, http.StatusBadRequest, "invalid_payload", "Invalid request payload")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			record := &models.IdempotencyRecord{
+				Scope:       idempotencyScope(r),
+				Key:         key,
+				Method:      r.Method,
+				Path:        r.URL.RequestURI(),
+				RequestHash: requestHash(body),
+			}
+			stored, err := store.Begin(r.Context(), record)
+			if err != nil {
+				if appErr, ok := apperror.As(err); ok && appErr.Kind == apperror.KindConflict {
+					if appErr.Code == "idempotency_key_in_progress" {
+						w.Header().Set("Retry-After", "1")
+					}
+					respondError(w, r, http.StatusConflict, appErr.Code, appErr.Message)
+					return
+				}
+				log.Errorw("Failed to reserve idempotency key", "key", key, "error", err)
+				respondError(w, r, http.StatusInternalServerError, "internal_error", "Failed to process idempotency key")
+				return
+			}
+			if stored != nil {
+				replay(w, stored)
+				return
+			}
+
+			// Ключ освобождается при любом исходе, кроме сохранённого ответа,
+			// в том числе при панике. Клиент к этому моменту мог уже отключиться,
+			// поэтому контекст запроса не используется.
+			ctx := context.WithoutCancel(r.Context())
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.Release(ctx, record.Scope, record.Key); err != nil {
+						log.Errorw("Failed to release idempotency key", "key", key, "error", err)
+					}
+				}
+			}()
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError || strings.Contains(rec.Header().Get("Cache-Control"), "no-store") {
+				return
+			}
+
+			record.StatusCode = rec.status
+			record.Body = rec.body.Bytes()
+			record.Headers = make(map[string]string)
+			for _, name := range replayedHeaders {
+				if value := rec.Header().Get(name); value != "" {
+					record.Headers[name] = value
+				}
+			}
+			if err := store.Complete(ctx, record); err != nil {
+				log.Errorw("Failed to store idempotent response", "key", key, "error", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, record *models.IdempotencyRecord) {
+	for name, value := range record.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// idempotencyScope разделяет ключи пользователей: одинаковые ключи
+// разных пользователей — разные запросы. Анонимные ключи разделяются по
+// адресу клиента и маршруту, иначе клиент с чужим ключом получил бы чужой
+// сохранённый ответ; хеш укладывается в длину столбца scope.
+func idempotencyScope(r *http.Request) string {
+	if claims, ok := r.Context().Value("user").(*auth.Claims); ok {
+		return fmt.Sprintf("user:%d", claims.UserID)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	sum := sha256.Sum256([]byte(host + " " + r.Method + " " + r.URL.Path))
+	return "anonymous:" + hex.EncodeToString(sum[:16])
+}
+
+// requestHash считает хеш тела. JSON приводится к каноническому виду,
+// чтобы повтор с другими пробелами или порядком полей не считался другим запросом.
+func requestHash(body []byte) string {
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		if canonical, err := json.Marshal(payload); err == nil {
+			body = canonical
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func respondError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	response, _ := json.Marshal(models.ErrorResponse{
+		Error:     message,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// responseRecorder передаёт ответ клиенту и одновременно запоминает его
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
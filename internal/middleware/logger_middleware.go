@@ -4,21 +4,29 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
 )
 
+// LoggerMiddleware пишет одну строку access-лога на запрос. Поля запроса
+// (request_id, user_id, маршрут, номер кассы) добавляет logger.Ctx.
 func LoggerMiddleware(log *logger.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
-			// Call the next handler
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(ww, r)
 
-			// Log the request
-			log.Infow("HTTP request",
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			log.Ctx(r.Context()).Infow("HTTP request",
 				"method", r.Method,
 				"path", r.URL.Path,
+				"status", status,
+				"bytes", ww.BytesWritten(),
 				"duration", time.Since(start),
 				"remote_addr", r.RemoteAddr,
 			)
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	log "github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/ratelimit"
+)
+
+// DeviceIDHeader — идентификатор устройства, если его нет в пути запроса
+const DeviceIDHeader = "X-Device-ID"
+
+const maxDeviceIDLength = 128
+
+// RateLimit ограничивает запросы группы маршрутов group по правилам rules.
+// Правило, для которого у запроса нет ключа (например, user до входа), пропускается.
+// Если хранилище счётчиков недоступно, запрос пропускается: лимит не должен
+// останавливать сервис.
+func RateLimit(limiter *ratelimit.Limiter, group string, rules []ratelimit.Rule, logger *log.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(rules) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+
+			for _, rule := range rules {
+				subject := rateLimitSubject(r, rule.By)
+				if subject == "" {
+					continue
+				}
+
+				result, err := limiter.Allow(r.Context(), group+":"+rule.By+":"+subject, rule.Limit, now)
+				if err != nil {
+					logger.Ctx(r.Context()).Errorw("Failed to check rate limit", "group", group, "by", rule.By, "error", err)
+					continue
+				}
+
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.Reset.Unix(), 10))
+
+				if !result.Allowed {
+					retryAfter := int(math.Ceil(result.Reset.Sub(now).Seconds()))
+					w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+					logger.Ctx(r.Context()).Warnw("Rate limit exceeded", "group", group, "by", rule.By, "limit", rule.Limit.String())
+					respondError(w, r, http.StatusTooManyRequests, "rate_limited", "Too many requests, retry later")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitSubject(r *http.Request, by string) string {
+	switch by {
+	case ratelimit.ByIP:
+		// RemoteAddr заменяется на адрес клиента из X-Forwarded-For только
+		// при TRUST_PROXY_HEADERS, иначе клиент мог бы подставить любой адрес
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	case ratelimit.ByUser:
+		if claims, ok := r.Context().Value("user").(*auth.Claims); ok {
+			return strconv.Itoa(claims.UserID)
+		}
+	case ratelimit.ByDevice:
+		device := chi.URLParam(r, "id")
+		if device == "" {
+			device = r.Header.Get(DeviceIDHeader)
+		}
+		if len(device) > maxDeviceIDLength {
+			device = device[:maxDeviceIDLength]
+		}
+		return device
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Назначения одноразовых токенов пользователя
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+)
+
+// UserToken — одноразовый токен из письма. Хранится только хеш, сам токен
+// знает лишь получатель письма.
+type UserToken struct {
+	ID        int
+	UserID    int
+	Purpose   string
+	TokenHash string
+	// Email — адрес, на который отправлен токен подтверждения
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// AccountPolicy — сроки действия токенов и адреса страниц, на которые ведут письма
+type AccountPolicy struct {
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	// PasswordResetURL и EmailVerificationURL — страницы клиента; токен
+	// добавляется параметром token. Пусто — в письме только сам токен.
+	PasswordResetURL     string
+	EmailVerificationURL string
+}
+
+// ForgotPasswordRequest: Login — имя пользователя или подтверждённый email
+type ForgotPasswordRequest struct {
+	Login string `json:"login" validate:"required,max=255" example:"owner@example.uz"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required,max=128"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required,max=128"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type LogLevelRequest struct {
+	Level string `json:"level" validate:"required,oneof=debug info warn error" example:"debug"`
+	// TTL — длительность в формате Go ("15m", "1h"); пусто — уровень меняется насовсем
+	TTL string `json:"ttl,omitempty" example:"15m"`
+}
+
+type LogLevelResponse struct {
+	Level string `json:"level"`
+	// RevertTo и ExpiresAt заполнены, пока действует временный уровень
+	RevertTo  string     `json:"revert_to,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
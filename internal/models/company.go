@@ -0,0 +1,30 @@
+package models
+
+// Company — запись реестра налогоплательщиков
+type Company struct {
+	TaxID string `json:"tax_id"`
+	// Kind — inn для юридических лиц, pinfl для физических
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+}
+
+// CompanyCheckMode определяет реакцию на расхождения ИНН и названий компаний
+// с реестром и с владельцем терминала
+type CompanyCheckMode string
+
+const (
+	CompanyCheckOff CompanyCheckMode = "off"
+	// CompanyCheckWarn только пишет расхождения в лог
+	CompanyCheckWarn CompanyCheckMode = "warn"
+	// CompanyCheckStrict отклоняет запросы с расхождениями
+	CompanyCheckStrict CompanyCheckMode = "strict"
+)
+
+func (m CompanyCheckMode) Valid() bool {
+	switch m {
+	case CompanyCheckOff, CompanyCheckWarn, CompanyCheckStrict:
+		return true
+	}
+	return false
+}
@@ -2,4 +2,15 @@ package models
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Code — машиночитаемый код ошибки, например terminal_not_found
+	Code      string        `json:"code,omitempty"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// ErrorDetail описывает проблему с конкретным полем запроса
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
@@ -1,6 +1,11 @@
 package models
 
 type ExportRequest struct {
-	Filename string                   `json:"filename"`
-	Objects  []map[string]interface{} `json:"objects"`
+	Filename string                   `json:"filename" validate:"max=200,excludesall=/\\"`
+	Objects  []map[string]interface{} `json:"objects" validate:"required,min=1"`
+	Password string                   `json:"password,omitempty" validate:"max=255"`
+}
+
+type FleetExportRequest struct {
+	Password string `json:"password,omitempty" validate:"max=255"`
 }
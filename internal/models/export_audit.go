@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ExportTypeObjects     = "objects"
+	ExportTypeFleet       = "fleet"
+	ExportTypeFleetPDF    = "fleet_pdf"
+	ExportTypeCertificate = "certificate"
+	ExportTypeScheduled   = "scheduled_report"
+	ExportTypeCLI         = "cli"
+)
+
+// ExportAuditEntry — запись о выгрузке данных, по которой можно найти
+// источник утёкшего файла
+type ExportAuditEntry struct {
+	ID         int             `json:"id" db:"id"`
+	UserID     int             `json:"user_id" db:"user_id"`
+	Username   string          `json:"username" db:"username"`
+	ExportType string          `json:"export_type" db:"export_type"`
+	Format     string          `json:"format" db:"format"`
+	Filename   string          `json:"filename" db:"filename"`
+	RowCount   int             `json:"row_count" db:"row_count"`
+	Filters    json.RawMessage `json:"filters" db:"filters" swaggertype:"object"`
+	Encrypted  bool            `json:"encrypted" db:"encrypted"`
+	RemoteAddr string          `json:"remote_addr" db:"remote_addr"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
@@ -10,20 +10,23 @@ type FiscalModule struct {
 	IsActive      bool      `json:"is_active" db:"is_active"`
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+	Version       int       `json:"version" db:"version"`
 }
 
 type FiscalModuleCreateRequest struct {
-	FiscalNumber  string `json:"fiscal_number"`
-	FactoryNumber string `json:"factory_number"`
-	UserID        int    `json:"user_id"`
+	FiscalNumber  string `json:"fiscal_number" validate:"notblank,max=255"`
+	FactoryNumber string `json:"factory_number" validate:"notblank,max=255"`
+	UserID        int    `json:"user_id" validate:"required,gt=0"`
 	IsActive      bool   `json:"is_active"`
 }
 
 type FiscalModuleUpdateRequest struct {
-	FiscalNumber  *string `json:"fiscal_number,omitempty"`
-	FactoryNumber *string `json:"factory_number,omitempty"`
-	UserID        *int    `json:"user_id,omitempty"`
+	FiscalNumber  *string `json:"fiscal_number,omitempty" validate:"omitempty,notblank,max=255"`
+	FactoryNumber *string `json:"factory_number,omitempty" validate:"omitempty,notblank,max=255"`
+	UserID        *int    `json:"user_id,omitempty" validate:"omitempty,gt=0"`
 	IsActive      *bool   `json:"is_active,omitempty"`
+	// Version — ожидаемая версия записи; заголовок If-Match имеет приоритет
+	Version *int `json:"version,omitempty" validate:"omitempty,gt=0"`
 }
 
 type FiscalModuleResponse struct {
@@ -32,4 +35,5 @@ type FiscalModuleResponse struct {
 	FactoryNumber string `json:"factory_number"`
 	UserID        int    `json:"user_id"`
 	IsActive      bool   `json:"is_active"`
+	Version       int    `json:"version"`
 }
@@ -0,0 +1,30 @@
+package models
+
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthResponse — ответ /healthz и /readyz; Checks заполняется только для /readyz
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type VersionInfo struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"`
+	// SchemaVersion — текущая версия схемы БД: -1 — миграции не применялись,
+	// null — БД недоступна
+	SchemaVersion *int64 `json:"schema_version"`
+	// LatestSchemaVersion — последняя миграция, встроенная в бинарник
+	LatestSchemaVersion int64 `json:"latest_schema_version"`
+	SchemaDirty         bool  `json:"schema_dirty,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyRecord — POST-запрос с заголовком Idempotency-Key и ответ на него
+type IdempotencyRecord struct {
+	// Scope — чей это ключ: "user:<id>" или "anonymous:<хеш адреса и маршрута>"; ключи разных пользователей не пересекаются
+	Scope       string
+	Key         string
+	Method      string
+	Path        string
+	RequestHash string
+	// StatusCode 0 — первый запрос с этим ключом ещё выполняется
+	StatusCode int
+	Headers    map[string]string
+	Body       []byte
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// PasswordPolicy — требования к новым паролям. Список утёкших паролей
+// передаётся сервисам отдельно: он загружается из файла.
+type PasswordPolicy struct {
+	MinLength int
+	// RequiredClasses — классы символов, которые должны встретиться: lower, upper, digit, symbol
+	RequiredClasses []string
+	// History — сколько последних паролей, включая текущий, нельзя повторить; 0 — можно
+	History int
+	// ChangeTTL — сколько действует токен для смены пароля, заданного администратором
+	ChangeTTL time.Duration
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=72"`
+	NewPassword     string `json:"new_password" validate:"required,max=72"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "sort"
+
+// FieldMask — поля (имена из JSON), явно переданные в PATCH-запросе.
+// Значение false означает, что поле передано как null.
+type FieldMask map[string]bool
+
+// Has сообщает, передано ли поле, в том числе как null
+func (m FieldMask) Has(field string) bool {
+	_, ok := m[field]
+	return ok
+}
+
+// Null сообщает, что поле передано как null
+func (m FieldMask) Null(field string) bool {
+	present, ok := m[field]
+	return ok && !present
+}
+
+// Fields возвращает поля маски в алфавитном порядке
+func (m FieldMask) Fields() []string {
+	fields := make([]string, 0, len(m))
+	for field := range m {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Changes — новые значения столбцов для частичного обновления: ровно те
+// столбцы, которые нужно записать, включая пустые строки и false
+type Changes map[string]interface{}
+
+// Columns возвращает столбцы в алфавитном порядке, чтобы SQL был детерминированным
+func (c Changes) Columns() []string {
+	columns := make([]string, 0, len(c))
+	for column := range c {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	ReportTypeTerminals         = "terminals"
+	ReportTypeInactiveTerminals = "inactive_terminals"
+	ReportTypeLowBalance        = "low_balance"
+
+	ReportFormatXLSX = "xlsx"
+	ReportFormatCSV  = "csv"
+	ReportFormatPDF  = "pdf"
+
+	DeliveryTypeDirectory = "directory"
+	DeliveryTypeEmail     = "email"
+	DeliveryTypeWebhook   = "webhook"
+
+	ReportRunStatusRunning = "running"
+	ReportRunStatusSuccess = "success"
+	ReportRunStatusFailed  = "failed"
+)
+
+type ReportFilters struct {
+	UserID               *int   `json:"user_id,omitempty" validate:"omitempty,gt=0"`
+	CompanyName          string `json:"company_name,omitempty" validate:"max=255"`
+	IsActive             *bool  `json:"is_active,omitempty"`
+	InactiveDays         *int   `json:"inactive_days,omitempty" validate:"omitempty,gt=0"`
+	MaxFreeRecordBalance *int   `json:"max_free_record_balance,omitempty" validate:"omitempty,gte=0"`
+}
+
+func (f ReportFilters) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+func (f *ReportFilters) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*f = ReportFilters{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	default:
+		return errors.New("unsupported type for report filters")
+	}
+}
+
+type ReportSchedule struct {
+	ID             int           `json:"id" db:"id"`
+	UserID         int           `json:"user_id" db:"user_id"`
+	Name           string        `json:"name" db:"name"`
+	ReportType     string        `json:"report_type" db:"report_type"`
+	CronExpr       string        `json:"cron_expr" db:"cron_expr"`
+	Filters        ReportFilters `json:"filters" db:"filters"`
+	Format         string        `json:"format" db:"format"`
+	DeliveryType   string        `json:"delivery_type" db:"delivery_type"`
+	DeliveryTarget string        `json:"delivery_target" db:"delivery_target"`
+	IsActive       bool          `json:"is_active" db:"is_active"`
+	FilePassword   string        `json:"-" db:"file_password"`
+	LastRunAt      *time.Time    `json:"last_run_at" db:"last_run_at"`
+	NextRunAt      *time.Time    `json:"next_run_at" db:"next_run_at"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at" db:"updated_at"`
+	Version        int           `json:"version" db:"version"`
+}
+
+type ReportScheduleCreateRequest struct {
+	Name           string        `json:"name" validate:"notblank,max=255"`
+	ReportType     string        `json:"report_type" validate:"required,oneof=terminals inactive_terminals low_balance"`
+	CronExpr       string        `json:"cron_expr" validate:"required,cron"`
+	Filters        ReportFilters `json:"filters"`
+	Format         string        `json:"format" validate:"omitempty,oneof=xlsx csv pdf"`
+	DeliveryType   string        `json:"delivery_type" validate:"required,oneof=directory email webhook"`
+	DeliveryTarget string        `json:"delivery_target" validate:"required_unless=DeliveryType directory"`
+	IsActive       bool          `json:"is_active"`
+	FilePassword   string        `json:"file_password,omitempty" validate:"excluded_if=Format csv,max=255"`
+}
+
+type ReportScheduleUpdateRequest struct {
+	Name           *string        `json:"name,omitempty" validate:"omitempty,notblank,max=255"`
+	ReportType     *string        `json:"report_type,omitempty" validate:"omitempty,oneof=terminals inactive_terminals low_balance"`
+	CronExpr       *string        `json:"cron_expr,omitempty" validate:"omitempty,cron"`
+	Filters        *ReportFilters `json:"filters,omitempty"`
+	Format         *string        `json:"format,omitempty" validate:"omitempty,oneof=xlsx csv pdf"`
+	DeliveryType   *string        `json:"delivery_type,omitempty" validate:"omitempty,oneof=directory email webhook"`
+	DeliveryTarget *string        `json:"delivery_target,omitempty"`
+	IsActive       *bool          `json:"is_active,omitempty"`
+	FilePassword   *string        `json:"file_password,omitempty" validate:"omitempty,max=255"`
+	// Version — ожидаемая версия записи; заголовок If-Match имеет приоритет
+	Version *int `json:"version,omitempty" validate:"omitempty,gt=0"`
+}
+
+type ReportRun struct {
+	ID         int        `json:"id" db:"id"`
+	ScheduleID int        `json:"schedule_id" db:"schedule_id"`
+	Status     string     `json:"status" db:"status"`
+	RowCount   int        `json:"row_count" db:"row_count"`
+	Location   string     `json:"location" db:"location"`
+	Error      string     `json:"error" db:"error"`
+	StartedAt  time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt *time.Time `json:"finished_at" db:"finished_at"`
+}
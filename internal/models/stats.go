@@ -0,0 +1,19 @@
+package models
+
+// FleetStats — сводка по парку терминалов и фискальных модулей для метрик
+type FleetStats struct {
+	ActiveTerminals   int
+	InactiveTerminals int
+	// StaleTerminals — активные терминалы, которые давно не выходили на связь
+	StaleTerminals int
+	// ModulesByState: active, inactive или deleted → количество модулей
+	ModulesByState map[string]int
+	// FreeRecordBalance — остаток свободных записей по компаниям
+	FreeRecordBalance []CompanyBalance
+}
+
+type CompanyBalance struct {
+	INN         string
+	CompanyName string
+	Balance     int64
+}
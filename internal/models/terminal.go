@@ -18,37 +18,50 @@ type Terminal struct {
 	CreatedAt            time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt            time.Time `json:"updated_at" db:"updated_at"`
 	StatusChangedByAdmin bool      `json:"status_changed_by_admin" db:"status_changed_by_admin"`
+	Version              int       `json:"version" db:"version"`
+}
+
+// TerminalStatusChange — запись журнала ручной смены статуса терминала
+type TerminalStatusChange struct {
+	ID         int       `json:"id" db:"id"`
+	TerminalID int       `json:"terminal_id" db:"terminal_id"`
+	IsActive   bool      `json:"is_active" db:"is_active"`
+	Reason     string    `json:"reason" db:"reason"`
+	ChangedBy  string    `json:"changed_by" db:"changed_by"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
 
 type TerminalCreateRequest struct {
-	AssemblyNumber     string `json:"assembly_number"`
-	INN                string `json:"inn"`
-	CompanyName        string `json:"company_name"`
+	AssemblyNumber     string `json:"assembly_number" validate:"notblank,max=255"`
+	INN                string `json:"inn" validate:"required,taxid"`
+	CompanyName        string `json:"company_name" validate:"max=255"`
 	Address            string `json:"address"`
-	CashRegisterNumber string `json:"cash_register_number"`
-	ModuleNumber       string `json:"module_number"`
-	LastRequestDate    string `json:"last_request_date"`
-	DatabaseUpdateDate string `json:"database_update_date"`
-	FreeRecordBalance  int    `json:"free_record_balance"`
+	CashRegisterNumber string `json:"cash_register_number" validate:"notblank,max=255"`
+	ModuleNumber       string `json:"module_number" validate:"notblank,max=255"`
+	LastRequestDate    string `json:"last_request_date" validate:"required,rfc3339"`
+	DatabaseUpdateDate string `json:"database_update_date" validate:"required,rfc3339"`
+	FreeRecordBalance  int    `json:"free_record_balance" validate:"gte=0"`
 }
 
 type TerminalUpdateRequest struct {
-	AssemblyNumber       *string `json:"assembly_number,omitempty"`
-	INN                  *string `json:"inn,omitempty"`
-	CompanyName          *string `json:"company_name,omitempty"`
+	AssemblyNumber       *string `json:"assembly_number,omitempty" validate:"omitempty,notblank,max=255"`
+	INN                  *string `json:"inn,omitempty" validate:"omitempty,taxid"`
+	CompanyName          *string `json:"company_name,omitempty" validate:"omitempty,max=255"`
 	Address              *string `json:"address,omitempty"`
-	CashRegisterNumber   *string `json:"cash_register_number,omitempty"`
-	ModuleNumber         *string `json:"module_number,omitempty"`
-	LastRequestDate      *string `json:"last_request_date,omitempty"`
-	DatabaseUpdateDate   *string `json:"database_update_date,omitempty"`
+	CashRegisterNumber   *string `json:"cash_register_number,omitempty" validate:"omitempty,notblank,max=255"`
+	ModuleNumber         *string `json:"module_number,omitempty" validate:"omitempty,notblank,max=255"`
+	LastRequestDate      *string `json:"last_request_date,omitempty" validate:"omitempty,rfc3339"`
+	DatabaseUpdateDate   *string `json:"database_update_date,omitempty" validate:"omitempty,rfc3339"`
 	IsActive             *bool   `json:"is_active,omitempty"`
-	UserID               *int    `json:"user_id,omitempty"`
-	FreeRecordBalance    *int    `json:"free_record_balance,omitempty"`
+	UserID               *int    `json:"user_id,omitempty" validate:"omitempty,gt=0"`
+	FreeRecordBalance    *int    `json:"free_record_balance,omitempty" validate:"omitempty,gte=0"`
 	StatusChangedByAdmin *bool   `json:"status_changed_by_admin" db:"status_changed_by_admin"`
+	// Version — ожидаемая версия записи; заголовок If-Match имеет приоритет
+	Version *int `json:"version,omitempty" validate:"omitempty,gt=0"`
 }
 
 type TerminalExistsRequest struct {
-	CashRegisterNumber string `json:"cash_register_number"`
+	CashRegisterNumber string `json:"cash_register_number" validate:"notblank"`
 }
 
 type TerminalExistsResponse struct {
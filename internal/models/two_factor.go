@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// TwoFactorPolicy — настройки второго фактора
+type TwoFactorPolicy struct {
+	// Issuer — название сервиса в приложении-аутентификаторе
+	Issuer string
+	// ChallengeTTL — сколько живёт токен между вводом пароля и кода
+	ChallengeTTL time.Duration
+	// RequiredForAdmins — администратор не войдёт, пока не подключит второй фактор
+	RequiredForAdmins bool
+}
+
+// TwoFactor — секрет второго фактора пользователя
+type TwoFactor struct {
+	// Secret задан с начала подключения, Enabled — после подтверждения кодом
+	Secret  string
+	Enabled bool
+	// LastStep — последний принятый шаг TOTP; коды этого и более ранних шагов не принимаются
+	LastStep int64
+}
+
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// Required — для учётной записи второй фактор обязателен (администраторы)
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type TwoFactorEnrollResponse struct {
+	// Secret — для ввода вручную, если QR-код не сканируется
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/Terminal%20Backend:admin?secret=JBSWY3DPEHPK3PXP&issuer=Terminal%20Backend"`
+	// QRCode — PNG с provisioning_uri в base64
+	QRCode string `json:"qr_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric" example:"123456"`
+}
+
+type TwoFactorConfirmResponse struct {
+	// RecoveryCodes показываются один раз; каждый код можно использовать вместо TOTP один раз
+	RecoveryCodes []string `json:"recovery_codes"`
+	// Token выдаётся, если подключение было шагом входа администратора
+	Token string `json:"token,omitempty"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// LoginTwoFactorRequest — второй шаг входа: код из приложения или код восстановления
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code,omitempty" validate:"required_without=RecoveryCode,omitempty,len=6,numeric" example:"123456"`
+	RecoveryCode   string `json:"recovery_code,omitempty" validate:"required_without=Code,omitempty,max=32"`
+}
@@ -6,38 +6,107 @@ type User struct {
 	ID          int       `json:"id" db:"id"`
 	INN         string    `json:"inn" db:"inn"`
 	Username    string    `json:"username" db:"username"`
-	Password    string    `json:"password" db:"password"`
+	Password    string    `json:"-" db:"password"` // bcrypt-хеш, в ответы не попадает
 	CompanyName string    `json:"company_name" db:"company_name"`
 	IsActive    bool      `json:"is_active" db:"is_active"`
 	IsAdmin     bool      `json:"is_admin" db:"is_admin"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	Version     int       `json:"version" db:"version"`
+	// TOTPEnabled — вход требует код второго фактора
+	TOTPEnabled bool `json:"totp_enabled" db:"totp_enabled"`
+	// LockedUntil — до какого момента вход заблокирован после неудачных попыток
+	LockedUntil *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+
+	Email string `json:"email,omitempty" db:"email"`
+	Phone string `json:"phone,omitempty" db:"phone"`
+	// EmailVerifiedAt — когда подтверждён Email; при смене адреса сбрасывается
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+
+	// MustChangePassword — пароль задал администратор; при входе его нужно сменить
+	MustChangePassword bool `json:"must_change_password" db:"must_change_password"`
 }
 
 type UserCreateRequest struct {
-	INN         string `json:"inn"`
-	Username    string `json:"username"`
-	Password    string `json:"password"`
-	CompanyName string `json:"company_name"`
-	IsActive    bool   `json:"is_active"`
-	IsAdmin     bool   `json:"is_admin"`
+	INN         string `json:"inn" validate:"required,taxid"`
+	Username    string `json:"username" validate:"notblank,max=255"`
+	Password    string `json:"password" validate:"required,max=72"`
+	CompanyName string `json:"company_name" validate:"max=255"`
+	// IsActive и IsAdmin учитываются только при создании через terminalctl;
+	// POST /auth/register их игнорирует
+	IsActive bool `json:"is_active"`
+	IsAdmin  bool `json:"is_admin"`
+
+	// Email нужен для восстановления пароля; на него уходит письмо с подтверждением
+	Email string `json:"email,omitempty" validate:"omitempty,email,max=255" example:"owner@example.uz"`
+	// Phone — в международном формате
+	Phone string `json:"phone,omitempty" validate:"omitempty,e164" example:"+998901234567"`
 }
 
 type UserUpdateRequest struct {
-	INN         *string `json:"inn,omitempty"`
-	Username    *string `json:"username,omitempty"`
-	Password    *string `json:"password,omitempty"`
-	CompanyName *string `json:"company_name,omitempty"`
+	INN         *string `json:"inn,omitempty" validate:"omitempty,taxid"`
+	Username    *string `json:"username,omitempty" validate:"omitempty,notblank,max=255"`
+	Password    *string `json:"password,omitempty" validate:"omitempty,notblank,max=72"`
+	CompanyName *string `json:"company_name,omitempty" validate:"omitempty,max=255"`
 	IsActive    *bool   `json:"is_active,omitempty"`
 	IsAdmin     *bool   `json:"is_admin,omitempty"`
+	// Version — ожидаемая версия записи; заголовок If-Match имеет приоритет
+	Version *int `json:"version,omitempty" validate:"omitempty,gt=0"`
+
+	// Email: новый адрес нужно подтвердить заново
+	Email *string `json:"email,omitempty" validate:"omitempty,email,max=255"`
+	Phone *string `json:"phone,omitempty" validate:"omitempty,e164"`
+	// CurrentPassword нужен, когда пользователь меняет свой email
+	CurrentPassword *string `json:"current_password,omitempty" validate:"omitempty,max=72"`
 }
 
 type UserLoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
+// UserLoginResponse — либо токен с пользователем, либо ChallengeToken для
+// следующего шага входа: смены пароля, POST /auth/login/2fa или подключения 2FA
 type UserLoginResponse struct {
-	User  User   `json:"user"`
-	Token string `json:"token"`
+	User  *User  `json:"user,omitempty"`
+	Token string `json:"token,omitempty"`
+
+	// MFARequired — нужен код второго фактора
+	MFARequired bool `json:"mfa_required,omitempty"`
+	// PasswordChangeRequired — пароль задал администратор: ChallengeToken годится
+	// только для /auth/password/change, после смены вход продолжается
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+	// MFAEnrollmentRequired — второй фактор обязателен, но ещё не подключён:
+	// ChallengeToken годится только для /auth/2fa/enroll и /auth/2fa/confirm
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	ChallengeToken        string `json:"challenge_token,omitempty"`
+}
+
+// LockoutPolicy — прогрессивная блокировка входа: после Threshold неудачных
+// попыток подряд вход закрывается на Base, каждая следующая блокировка вдвое
+// дольше, но не дольше Max. Threshold 0 отключает блокировку.
+type LockoutPolicy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+// UserDeletePolicy определяет, что происходит с терминалами удаляемого пользователя
+type UserDeletePolicy string
+
+const (
+	// UserDeletePolicyRestrict запрещает удалять пользователя, пока у него есть терминалы
+	UserDeletePolicyRestrict UserDeletePolicy = "restrict"
+	// UserDeletePolicyDeactivate оставляет терминалы, но деактивирует их от имени администратора
+	UserDeletePolicyDeactivate UserDeletePolicy = "deactivate"
+	// UserDeletePolicyCascade удаляет терминалы и фискальные модули вместе с пользователем
+	UserDeletePolicyCascade UserDeletePolicy = "cascade"
+)
+
+func (p UserDeletePolicy) Valid() bool {
+	switch p {
+	case UserDeletePolicyRestrict, UserDeletePolicyDeactivate, UserDeletePolicyCascade:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/lib/pq"
+)
+
+// constraintErrors сопоставляет ограничения схемы с доменными ошибками
+var constraintErrors = map[string]*apperror.Error{
+	"users_username_active_key":                 apperror.ErrUsernameTaken,
+	"users_email_active_key":                    apperror.ErrEmailTaken,
+	"fiscal_modules_fiscal_number_key":          apperror.ErrFiscalNumberTaken,
+	"fiscal_modules_factory_number_key":         apperror.ErrFactoryNumberTaken,
+	"terminals_cash_register_number_active_key": apperror.ErrCashRegisterNumberTaken,
+	"terminals_cash_register_number_fkey":       apperror.ErrFiscalModuleNotRegistered,
+}
+
+// translate переводит ошибки драйвера в доменные: sql.ErrNoRows — в notFound,
+// нарушения ограничений — в конфликт или нарушение связи. Остальное возвращается как есть.
+func translate(err error, notFound *apperror.Error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) && notFound != nil {
+		return notFound.Wrap(err)
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	if domainErr, ok := constraintErrors[pqErr.Constraint]; ok {
+		return domainErr.Wrap(err)
+	}
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return apperror.Conflict("already_exists", "record already exists").Wrap(err)
+	case "foreign_key_violation":
+		return apperror.ErrReferencedRecordNotFound.Wrap(err)
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+type ExportAuditRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewExportAuditRepository(db *sql.DB, logger *logger.Logger) *ExportAuditRepository {
+	return &ExportAuditRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *ExportAuditRepository) Create(ctx context.Context, entry *models.ExportAuditEntry) error {
+	query := `
+        INSERT INTO export_audit_log (user_id, username, export_type, format, filename, row_count,
+                                      filters, encrypted, remote_addr)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING id, created_at`
+
+	filters := []byte(entry.Filters)
+	if len(filters) == 0 {
+		filters = []byte("{}")
+	}
+
+	var userID interface{}
+	if entry.UserID != 0 {
+		userID = entry.UserID
+	}
+
+	return r.db.QueryRowContext(ctx, query,
+		userID, entry.Username, entry.ExportType, entry.Format, entry.Filename, entry.RowCount,
+		filters, entry.Encrypted, entry.RemoteAddr,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+func (r *ExportAuditRepository) List(ctx context.Context, limit int) ([]*models.ExportAuditEntry, error) {
+	query := `
+        SELECT id, COALESCE(user_id, 0), username, export_type, format, filename, row_count,
+               filters, encrypted, remote_addr, created_at
+        FROM export_audit_log
+        ORDER BY id DESC
+        LIMIT $1`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.ExportAuditEntry
+	for rows.Next() {
+		var entry models.ExportAuditEntry
+		var filters []byte
+		err := rows.Scan(
+			&entry.ID, &entry.UserID, &entry.Username, &entry.ExportType, &entry.Format, &entry.Filename,
+			&entry.RowCount, &filters, &entry.Encrypted, &entry.RemoteAddr, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entry.Filters = filters
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
 )
@@ -28,22 +29,22 @@ func (r *FiscalModuleRepository) Create(ctx context.Context, module *models.Fisc
 	query := `
         INSERT INTO fiscal_modules (fiscal_number, factory_number, user_id, is_active)
         VALUES ($1, $2, $3, $4)
-        RETURNING id, created_at, updated_at`
+        RETURNING id, created_at, updated_at, version`
 
 	err := r.db.QueryRowContext(ctx, query,
 		module.FiscalNumber, module.FactoryNumber, module.UserID, module.IsActive,
-	).Scan(&module.ID, &module.CreatedAt, &module.UpdatedAt)
+	).Scan(&module.ID, &module.CreatedAt, &module.UpdatedAt, &module.Version)
 
-	return err
+	return translate(err, nil)
 }
 
 func (r *FiscalModuleRepository) GetByFactoryNumber(ctx context.Context, factoryNumber string) (*models.FiscalModule, error) {
-	query := `SELECT id, fiscal_number, factory_number, user_id, created_at, updated_at FROM fiscal_modules WHERE factory_number = $1`
+	query := `SELECT id, fiscal_number, factory_number, user_id, created_at, updated_at, version FROM fiscal_modules WHERE factory_number = $1 AND deleted_at IS NULL`
 
 	var module models.FiscalModule
 	err := r.db.QueryRowContext(ctx, query, factoryNumber).Scan(
 		&module.ID, &module.FiscalNumber, &module.FactoryNumber,
-		&module.UserID, &module.CreatedAt, &module.UpdatedAt,
+		&module.UserID, &module.CreatedAt, &module.UpdatedAt, &module.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -58,25 +59,25 @@ func (r *FiscalModuleRepository) GetByFactoryNumber(ctx context.Context, factory
 
 func (r *FiscalModuleRepository) GetByID(ctx context.Context, id int) (*models.FiscalModule, error) {
 	query := `
-        SELECT id, fiscal_number, factory_number, user_id, is_active, created_at, updated_at
+        SELECT id, fiscal_number, factory_number, user_id, is_active, created_at, updated_at, version
         FROM fiscal_modules
-        WHERE id = $1`
+        WHERE id = $1 AND deleted_at IS NULL`
 
 	var module models.FiscalModule
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&module.ID, &module.FiscalNumber, &module.FactoryNumber,
-		&module.UserID, &module.IsActive, &module.CreatedAt, &module.UpdatedAt,
+		&module.UserID, &module.IsActive, &module.CreatedAt, &module.UpdatedAt, &module.Version,
 	)
 
 	if err != nil {
-		return nil, err
+		return nil, translate(err, apperror.ErrFiscalModuleNotFound)
 	}
 
 	return &module, nil
 }
 
 func (r *FiscalModuleRepository) Update(ctx context.Context, module *models.FiscalModule) error {
-	r.logger.Info("Starting fiscal module update", "id", module.ID, "is_active", module.IsActive)
+	r.logger.Ctx(ctx).Infow("Starting fiscal module update", "id", module.ID, "is_active", module.IsActive)
 
 	query := "UPDATE fiscal_modules SET "
 	args := []interface{}{}
@@ -92,49 +93,72 @@ func (r *FiscalModuleRepository) Update(ctx context.Context, module *models.Fisc
 		args = append(args, module.FactoryNumber)
 		argId++
 	}
-	query += fmt.Sprintf("user_id = $%d, is_active = $%d, updated_at = $%d ", argId, argId+1, argId+2)
+	query += fmt.Sprintf("user_id = $%d, is_active = $%d, updated_at = $%d, version = version + 1 ", argId, argId+1, argId+2)
 	args = append(args, module.UserID, module.IsActive, time.Now())
 	argId += 3
 
 	query = strings.TrimSuffix(query, ", ")
-	query += fmt.Sprintf("WHERE id = $%d", argId)
-	args = append(args, module.ID)
+	query += fmt.Sprintf("WHERE id = $%d AND version = $%d AND deleted_at IS NULL RETURNING version, updated_at", argId, argId+1)
+	args = append(args, module.ID, module.Version)
 
-	r.logger.Info("Executing update query", "query", query, "args", args)
+	r.logger.Ctx(ctx).Infow("Executing update query", "query", query, "args", args)
 
-	result, err := r.db.ExecContext(ctx, query, args...)
-	if err != nil {
-		r.logger.Error("Failed to execute update query", "error", err)
-		return fmt.Errorf("failed to update fiscal module: %w", err)
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&module.Version, &module.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		r.logger.Ctx(ctx).Warnw("No rows were updated", "id", module.ID)
+		return staleOrMissing(ctx, r.db,
+			`SELECT EXISTS (SELECT 1 FROM fiscal_modules WHERE id = $1 AND deleted_at IS NULL)`,
+			module.ID, apperror.ErrFiscalModuleNotFound)
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		r.logger.Error("Failed to get rows affected", "error", err)
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		r.logger.Ctx(ctx).Errorw("Failed to execute update query", "error", err)
+		return fmt.Errorf("failed to update fiscal module: %w", translate(err, nil))
 	}
 
-	r.logger.Info("Fiscal module update completed", "id", module.ID, "rows_affected", rowsAffected)
-
-	if rowsAffected == 0 {
-		r.logger.Warn("No rows were updated", "id", module.ID)
-		return errors.New("no rows were updated")
-	}
+	r.logger.Ctx(ctx).Infow("Fiscal module update completed", "id", module.ID, "version", module.Version)
 
 	return nil
 }
+
+// Delete помечает модуль удалённым, если к нему не привязан ни один живой терминал
 func (r *FiscalModuleRepository) Delete(ctx context.Context, id int) error {
-	query := `DELETE FROM fiscal_modules WHERE id = $1`
+	query := `
+        UPDATE fiscal_modules fm SET deleted_at = NOW()
+        WHERE fm.id = $1 AND fm.deleted_at IS NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM terminals t
+              WHERE t.cash_register_number = fm.factory_number AND t.deleted_at IS NULL
+          )`
+
+	return translate(execAffectingOne(ctx, r.db, query, id), apperror.ErrFiscalModuleNotFound)
+}
 
-	_, err := r.db.ExecContext(ctx, query, id)
+func (r *FiscalModuleRepository) Restore(ctx context.Context, id int) error {
+	query := `UPDATE fiscal_modules SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`
 
-	return err
+	return translate(execAffectingOne(ctx, r.db, query, id), apperror.ErrFiscalModuleNotFound)
+}
+
+// PurgeDeleted окончательно удаляет модули, удалённые раньше before.
+// Модули, на которые ещё ссылаются терминалы, пропускаются.
+func (r *FiscalModuleRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+        DELETE FROM fiscal_modules fm
+        WHERE fm.deleted_at IS NOT NULL AND fm.deleted_at < $1
+          AND NOT EXISTS (SELECT 1 FROM terminals t WHERE t.cash_register_number = fm.factory_number)`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge fiscal modules: %w", err)
+	}
+	return result.RowsAffected()
 }
 
 func (r *FiscalModuleRepository) List(ctx context.Context) ([]*models.FiscalModule, error) {
 	query := `
-        SELECT id, fiscal_number, factory_number, user_id, is_active, created_at, updated_at
+        SELECT id, fiscal_number, factory_number, user_id, is_active, created_at, updated_at, version
         FROM fiscal_modules
+        WHERE deleted_at IS NULL
         ORDER BY id`
 
 	rows, err := r.db.QueryContext(ctx, query)
@@ -148,7 +172,7 @@ func (r *FiscalModuleRepository) List(ctx context.Context) ([]*models.FiscalModu
 		var module models.FiscalModule
 		err := rows.Scan(
 			&module.ID, &module.FiscalNumber, &module.FactoryNumber,
-			&module.UserID, &module.IsActive, &module.CreatedAt, &module.UpdatedAt,
+			&module.UserID, &module.IsActive, &module.CreatedAt, &module.UpdatedAt, &module.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -160,7 +184,7 @@ func (r *FiscalModuleRepository) List(ctx context.Context) ([]*models.FiscalModu
 }
 
 func (r *FiscalModuleRepository) DeleteByUserID(ctx context.Context, userID int) error {
-	query := `DELETE FROM fiscal_modules WHERE user_id = $1`
+	query := `UPDATE fiscal_modules SET deleted_at = NOW() WHERE user_id = $1 AND deleted_at IS NULL`
 
 	_, err := r.db.ExecContext(ctx, query, userID)
 	return err
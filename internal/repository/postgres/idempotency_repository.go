@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+type IdempotencyRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewIdempotencyRepository(db *sql.DB, logger *logger.Logger) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Reserve вставляет запись без ответа. Истёкшая запись с тем же ключом
+// перезаписывается, живая — возвращается вызывающему.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	query := `
+        INSERT INTO idempotency_keys (scope, key, method, path, request_hash, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (scope, key) DO UPDATE
+        SET method = EXCLUDED.method, path = EXCLUDED.path, request_hash = EXCLUDED.request_hash,
+            status_code = NULL, headers = '{}', body = NULL, created_at = NOW(), expires_at = EXCLUDED.expires_at
+        WHERE idempotency_keys.expires_at <= NOW()
+        RETURNING created_at`
+
+	// Вторая попытка нужна, если чужая запись исчезла между INSERT и SELECT
+	for attempt := 0; attempt < 2; attempt++ {
+		err := r.db.QueryRowContext(ctx, query,
+			record.Scope, record.Key, record.Method, record.Path, record.RequestHash, record.ExpiresAt,
+		).Scan(&record.CreatedAt)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+
+		existing, err := r.get(ctx, record.Scope, record.Key)
+		if err == nil {
+			return existing, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("failed to reserve idempotency key %q", record.Key)
+}
+
+func (r *IdempotencyRepository) get(ctx context.Context, scope, key string) (*models.IdempotencyRecord, error) {
+	query := `
+        SELECT scope, key, method, path, request_hash, COALESCE(status_code, 0), headers, body,
+               created_at, expires_at
+        FROM idempotency_keys
+        WHERE scope = $1 AND key = $2`
+
+	var record models.IdempotencyRecord
+	var headers []byte
+	err := r.db.QueryRowContext(ctx, query, scope, key).Scan(
+		&record.Scope, &record.Key, &record.Method, &record.Path, &record.RequestHash,
+		&record.StatusCode, &headers, &record.Body, &record.CreatedAt, &record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(headers, &record.Headers); err != nil {
+		return nil, fmt.Errorf("failed to decode stored headers: %w", err)
+	}
+	return &record, nil
+}
+
+// Complete сохраняет ответ на зарезервированный ключ
+func (r *IdempotencyRepository) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	headers, err := json.Marshal(record.Headers)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE idempotency_keys SET status_code = $3, headers = $4, body = $5
+        WHERE scope = $1 AND key = $2 AND status_code IS NULL`
+
+	return execAffectingOne(ctx, r.db, query, record.Scope, record.Key, record.StatusCode, headers, record.Body)
+}
+
+// Release освобождает ключ, ответ на который не сохранён, чтобы повтор выполнился заново
+func (r *IdempotencyRepository) Release(ctx context.Context, scope, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status_code IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+func (r *IdempotencyRepository) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE expires_at <= $1`
+
+	result, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
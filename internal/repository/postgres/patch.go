@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+)
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// patchQuery собирает UPDATE ровно по переданным столбцам и возвращает
+// обновлённую строку. Столбцы не из allowed — ошибка вызывающего кода,
+// а не клиента: сервис отсекает неизвестные поля раньше.
+func patchQuery(table string, allowed map[string]bool, changes models.Changes, id, version int, returning string) (string, []interface{}, error) {
+	var set []string
+	var args []interface{}
+	for _, column := range changes.Columns() {
+		if !allowed[column] {
+			return "", nil, fmt.Errorf("column %s.%s cannot be patched", table, column)
+		}
+		args = append(args, changes[column])
+		set = append(set, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	set = append(set, "updated_at = NOW()", "version = version + 1")
+	args = append(args, id, version)
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d AND version = $%d AND deleted_at IS NULL RETURNING %s",
+		table, strings.Join(set, ", "), len(args)-1, len(args), returning)
+	return query, args, nil
+}
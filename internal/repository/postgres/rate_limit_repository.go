@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+// RateLimitRepository — общие для всех реплик счётчики ratelimit
+type RateLimitRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewRateLimitRepository(db *sql.DB, logger *logger.Logger) *RateLimitRepository {
+	return &RateLimitRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Hit увеличивает счётчик одним запросом, чтобы параллельные реплики не теряли обновления
+func (r *RateLimitRepository) Hit(ctx context.Context, key string, windowStart, expiresAt time.Time) (int, error) {
+	query := `
+        INSERT INTO rate_limits (key, window_start, count, expires_at)
+        VALUES ($1, $2, 1, $3)
+        ON CONFLICT (key) DO UPDATE
+        SET count = CASE WHEN rate_limits.window_start = EXCLUDED.window_start THEN rate_limits.count + 1 ELSE 1 END,
+            window_start = EXCLUDED.window_start,
+            expires_at = EXCLUDED.expires_at
+        RETURNING count`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, key, windowStart, expiresAt).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count request: %w", err)
+	}
+	return count, nil
+}
+
+func (r *RateLimitRepository) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM rate_limits WHERE expires_at <= $1`
+
+	result, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge rate limits: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+type ReportRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewReportRepository(db *sql.DB, logger *logger.Logger) *ReportRepository {
+	return &ReportRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+const reportScheduleColumns = `id, user_id, name, report_type, cron_expr, filters, format, delivery_type,
+               delivery_target, is_active, file_password, last_run_at, next_run_at, created_at, updated_at, version`
+
+func scanReportSchedule(row interface{ Scan(...interface{}) error }) (*models.ReportSchedule, error) {
+	var schedule models.ReportSchedule
+	err := row.Scan(
+		&schedule.ID, &schedule.UserID, &schedule.Name, &schedule.ReportType, &schedule.CronExpr,
+		&schedule.Filters, &schedule.Format, &schedule.DeliveryType, &schedule.DeliveryTarget,
+		&schedule.IsActive, &schedule.FilePassword, &schedule.LastRunAt, &schedule.NextRunAt, &schedule.CreatedAt, &schedule.UpdatedAt,
+		&schedule.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (r *ReportRepository) CreateSchedule(ctx context.Context, schedule *models.ReportSchedule) error {
+	query := `
+        INSERT INTO report_schedules (user_id, name, report_type, cron_expr, filters, format,
+                                      delivery_type, delivery_target, is_active, file_password, next_run_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        RETURNING id, created_at, updated_at, version`
+
+	err := r.db.QueryRowContext(ctx, query,
+		schedule.UserID, schedule.Name, schedule.ReportType, schedule.CronExpr, schedule.Filters,
+		schedule.Format, schedule.DeliveryType, schedule.DeliveryTarget, schedule.IsActive,
+		schedule.FilePassword, schedule.NextRunAt,
+	).Scan(&schedule.ID, &schedule.CreatedAt, &schedule.UpdatedAt, &schedule.Version)
+
+	return translate(err, nil)
+}
+
+func (r *ReportRepository) GetScheduleByID(ctx context.Context, id int) (*models.ReportSchedule, error) {
+	query := `SELECT ` + reportScheduleColumns + ` FROM report_schedules WHERE id = $1`
+
+	schedule, err := scanReportSchedule(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, translate(err, apperror.ErrReportScheduleNotFound)
+	}
+	return schedule, nil
+}
+
+func (r *ReportRepository) UpdateSchedule(ctx context.Context, schedule *models.ReportSchedule) error {
+	query := `
+        UPDATE report_schedules
+        SET name = $1, report_type = $2, cron_expr = $3, filters = $4, format = $5,
+            delivery_type = $6, delivery_target = $7, is_active = $8, file_password = $9,
+            next_run_at = $10, updated_at = $11, version = version + 1
+        WHERE id = $12 AND version = $13
+        RETURNING updated_at, version`
+
+	err := r.db.QueryRowContext(ctx, query,
+		schedule.Name, schedule.ReportType, schedule.CronExpr, schedule.Filters, schedule.Format,
+		schedule.DeliveryType, schedule.DeliveryTarget, schedule.IsActive, schedule.FilePassword,
+		schedule.NextRunAt, time.Now(), schedule.ID, schedule.Version,
+	).Scan(&schedule.UpdatedAt, &schedule.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return staleOrMissing(ctx, r.db,
+			`SELECT EXISTS (SELECT 1 FROM report_schedules WHERE id = $1)`,
+			schedule.ID, apperror.ErrReportScheduleNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update report schedule: %w", translate(err, apperror.ErrReportScheduleNotFound))
+	}
+	return nil
+}
+
+func (r *ReportRepository) DeleteSchedule(ctx context.Context, id int) error {
+	query := `DELETE FROM report_schedules WHERE id = $1`
+
+	return translate(execAffectingOne(ctx, r.db, query, id), apperror.ErrReportScheduleNotFound)
+}
+
+// ListSchedules возвращает расписания пользователя, а при userID == 0 — все расписания
+func (r *ReportRepository) ListSchedules(ctx context.Context, userID int) ([]*models.ReportSchedule, error) {
+	query := `SELECT ` + reportScheduleColumns + `
+        FROM report_schedules
+        WHERE $1 = 0 OR user_id = $1
+        ORDER BY id`
+
+	return r.querySchedules(ctx, query, userID)
+}
+
+func (r *ReportRepository) ListDueSchedules(ctx context.Context, now time.Time) ([]*models.ReportSchedule, error) {
+	query := `SELECT ` + reportScheduleColumns + `
+        FROM report_schedules
+        WHERE is_active AND next_run_at IS NOT NULL AND next_run_at <= $1
+          AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+        ORDER BY next_run_at`
+
+	return r.querySchedules(ctx, query, now)
+}
+
+func (r *ReportRepository) querySchedules(ctx context.Context, query string, args ...interface{}) ([]*models.ReportSchedule, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*models.ReportSchedule
+	for rows.Next() {
+		schedule, err := scanReportSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// ClaimSchedule переносит next_run_at только если его ещё никто не перенёс,
+// чтобы при нескольких репликах отчёт запускался один раз
+func (r *ReportRepository) ClaimSchedule(ctx context.Context, id int, dueAt, runAt, nextRunAt time.Time) (bool, error) {
+	query := `
+        UPDATE report_schedules
+        SET last_run_at = $1, next_run_at = $2
+        WHERE id = $3 AND next_run_at = $4`
+
+	result, err := r.db.ExecContext(ctx, query, runAt, nextRunAt, id, dueAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim report schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *ReportRepository) CreateRun(ctx context.Context, run *models.ReportRun) error {
+	query := `
+        INSERT INTO report_runs (schedule_id, status)
+        VALUES ($1, $2)
+        RETURNING id, started_at`
+
+	return r.db.QueryRowContext(ctx, query, run.ScheduleID, run.Status).Scan(&run.ID, &run.StartedAt)
+}
+
+func (r *ReportRepository) FinishRun(ctx context.Context, run *models.ReportRun) error {
+	query := `
+        UPDATE report_runs
+        SET status = $1, row_count = $2, location = $3, error = $4, finished_at = NOW()
+        WHERE id = $5
+        RETURNING finished_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		run.Status, run.RowCount, run.Location, run.Error, run.ID,
+	).Scan(&run.FinishedAt)
+}
+
+func (r *ReportRepository) ListRuns(ctx context.Context, scheduleID int) ([]*models.ReportRun, error) {
+	query := `
+        SELECT id, schedule_id, status, row_count, location, error, started_at, finished_at
+        FROM report_runs
+        WHERE schedule_id = $1
+        ORDER BY started_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*models.ReportRun
+	for rows.Next() {
+		var run models.ReportRun
+		err := rows.Scan(
+			&run.ID, &run.ScheduleID, &run.Status, &run.RowCount, &run.Location,
+			&run.Error, &run.StartedAt, &run.FinishedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, &run)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,51 @@
+package postgres
+
+// ExpectedColumns перечисляет колонки, к которым обращаются запросы
+// репозиториев. При старте сервер сверяет с ним живую схему, чтобы
+// расхождение с миграциями всплывало сразу, а не на первом запросе.
+var ExpectedColumns = map[string][]string{
+	"users": {
+		"id", "inn", "username", "password", "company_name", "is_active", "is_admin",
+		"created_at", "updated_at", "deleted_at", "version",
+		"failed_login_attempts", "lockout_count", "locked_until",
+		"totp_secret", "totp_enabled", "totp_last_step",
+		"email", "phone", "email_verified_at", "must_change_password",
+	},
+	"fiscal_modules": {
+		"id", "fiscal_number", "factory_number", "user_id", "is_active",
+		"created_at", "updated_at", "deleted_at", "version",
+	},
+	"terminals": {
+		"id", "assembly_number", "inn", "company_name", "address", "cash_register_number",
+		"module_number", "last_request_date", "database_update_date", "is_active", "user_id",
+		"free_record_balance", "created_at", "updated_at", "status_changed_by_admin", "deleted_at",
+		"version",
+	},
+	"report_schedules": {
+		"id", "user_id", "name", "report_type", "cron_expr", "filters", "format", "delivery_type",
+		"delivery_target", "is_active", "file_password", "last_run_at", "next_run_at",
+		"created_at", "updated_at", "version",
+	},
+	"report_runs": {
+		"id", "schedule_id", "status", "row_count", "location", "error", "started_at", "finished_at",
+	},
+	"terminal_status_changes": {
+		"id", "terminal_id", "is_active", "reason", "changed_by", "created_at",
+	},
+	"user_recovery_codes": {"id", "user_id", "code_hash", "used_at", "created_at"},
+	"user_password_history": {
+		"id", "user_id", "password_hash", "created_at",
+	},
+	"user_tokens": {
+		"id", "user_id", "purpose", "token_hash", "email", "expires_at", "used_at", "created_at",
+	},
+	"rate_limits": {"key", "window_start", "count", "expires_at"},
+	"idempotency_keys": {
+		"scope", "key", "method", "path", "request_hash", "status_code", "headers", "body",
+		"created_at", "expires_at",
+	},
+	"export_audit_log": {
+		"id", "user_id", "username", "export_type", "format", "filename", "row_count",
+		"filters", "encrypted", "remote_addr", "created_at",
+	},
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+type StatsRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewStatsRepository(db *sql.DB, logger *logger.Logger) *StatsRepository {
+	return &StatsRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// FleetStats считает сводку по парку; терминал устарел, если последний
+// запрос был раньше staleBefore
+func (r *StatsRepository) FleetStats(ctx context.Context, staleBefore time.Time) (*models.FleetStats, error) {
+	stats := &models.FleetStats{ModulesByState: make(map[string]int)}
+
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FILTER (WHERE is_active),
+               COUNT(*) FILTER (WHERE NOT is_active),
+               COUNT(*) FILTER (WHERE is_active AND last_request_date < $1)
+        FROM terminals
+        WHERE deleted_at IS NULL`, staleBefore,
+	).Scan(&stats.ActiveTerminals, &stats.InactiveTerminals, &stats.StaleTerminals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count terminals: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT CASE WHEN deleted_at IS NOT NULL THEN 'deleted'
+                    WHEN is_active THEN 'active'
+                    ELSE 'inactive' END AS state,
+               COUNT(*)
+        FROM fiscal_modules
+        GROUP BY state`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count fiscal modules: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var state string
+		var count int
+		if err := rows.Scan(&state, &count); err != nil {
+			return nil, err
+		}
+		stats.ModulesByState[state] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Название у терминалов одной компании может различаться, метка берёт одно из них
+	balances, err := r.db.QueryContext(ctx, `
+        SELECT inn, MAX(company_name), COALESCE(SUM(free_record_balance), 0)
+        FROM terminals
+        WHERE deleted_at IS NULL
+        GROUP BY inn
+        ORDER BY inn`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum free record balance: %w", err)
+	}
+	defer balances.Close()
+	for balances.Next() {
+		var balance models.CompanyBalance
+		if err := balances.Scan(&balance.INN, &balance.CompanyName, &balance.Balance); err != nil {
+			return nil, err
+		}
+		stats.FreeRecordBalance = append(stats.FreeRecordBalance, balance)
+	}
+
+	return stats, balances.Err()
+}
@@ -8,10 +8,46 @@ import (
 	"strings"
 	"time"
 
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
 )
 
+// terminalColumns — столбцы, которые читают GetByID, List и Patch; порядок совпадает со scanTerminal
+const terminalColumns = `id, assembly_number, inn, company_name, address, cash_register_number,
+               module_number, last_request_date, database_update_date, is_active,
+               user_id, free_record_balance, created_at, updated_at, status_changed_by_admin, version`
+
+// terminalPatchColumns — столбцы, которые можно менять через Patch
+var terminalPatchColumns = map[string]bool{
+	"assembly_number":         true,
+	"inn":                     true,
+	"company_name":            true,
+	"address":                 true,
+	"cash_register_number":    true,
+	"module_number":           true,
+	"last_request_date":       true,
+	"database_update_date":    true,
+	"is_active":               true,
+	"free_record_balance":     true,
+	"status_changed_by_admin": true,
+}
+
+func scanTerminal(row rowScanner) (*models.Terminal, error) {
+	var terminal models.Terminal
+	err := row.Scan(
+		&terminal.ID, &terminal.AssemblyNumber, &terminal.INN, &terminal.CompanyName,
+		&terminal.Address, &terminal.CashRegisterNumber, &terminal.ModuleNumber,
+		&terminal.LastRequestDate, &terminal.DatabaseUpdateDate, &terminal.IsActive,
+		&terminal.UserID, &terminal.FreeRecordBalance, &terminal.CreatedAt, &terminal.UpdatedAt,
+		&terminal.StatusChangedByAdmin, &terminal.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &terminal, nil
+}
+
 type TerminalRepository struct {
 	db     *sql.DB
 	logger *logger.Logger
@@ -29,14 +65,15 @@ func (r *TerminalRepository) GetByCashRegisterNumber(ctx context.Context, cashRe
 	err := r.db.QueryRowContext(ctx, `
         SELECT id, assembly_number, inn, company_name, address, cash_register_number, 
                module_number, last_request_date, database_update_date, is_active, user_id, 
-               free_record_balance, created_at, updated_at 
+               free_record_balance, created_at, updated_at, version
         FROM terminals 
-        WHERE cash_register_number = $1
+        WHERE cash_register_number = $1 AND deleted_at IS NULL
     `, cashRegisterNumber).Scan(
 		&terminal.ID, &terminal.AssemblyNumber, &terminal.INN, &terminal.CompanyName,
 		&terminal.Address, &terminal.CashRegisterNumber, &terminal.ModuleNumber,
 		&terminal.LastRequestDate, &terminal.DatabaseUpdateDate, &terminal.IsActive,
 		&terminal.UserID, &terminal.FreeRecordBalance, &terminal.CreatedAt, &terminal.UpdatedAt,
+		&terminal.Version,
 	)
 
 	if err != nil {
@@ -51,14 +88,11 @@ func (r *TerminalRepository) GetByCashRegisterNumber(ctx context.Context, cashRe
 func (r *TerminalRepository) GetStatus(ctx context.Context, id int) (bool, error) {
 	var isActive bool
 	err := r.db.QueryRowContext(ctx, `
-        SELECT is_active FROM terminals WHERE id = $1
+        SELECT is_active FROM terminals WHERE id = $1 AND deleted_at IS NULL
     `, id).Scan(&isActive)
 
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, errors.New("terminal not found")
-		}
-		return false, err
+		return false, translate(err, apperror.ErrTerminalNotFound)
 	}
 	return isActive, nil
 }
@@ -67,15 +101,12 @@ func (r *TerminalRepository) GetUserIDByCashRegisterNumber(ctx context.Context,
 	query := `
 		SELECT user_id 
 		FROM fiscal_modules
-		WHERE factory_number = $1`
+		WHERE factory_number = $1 AND deleted_at IS NULL`
 
 	var userID int
 	err := r.db.QueryRowContext(ctx, query, cashRegisterNumber).Scan(&userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, fmt.Errorf("no user associated with factory number %s", cashRegisterNumber)
-		}
-		return 0, err
+		return 0, translate(err, apperror.ErrFiscalModuleNotRegistered)
 	}
 
 	return userID, nil
@@ -88,7 +119,7 @@ func (r *TerminalRepository) Create(ctx context.Context, terminal *models.Termin
 	}
 	if existingTerminalNumber != "" || existingFiscalModuleNumber != "" {
 		if existingTerminalNumber != terminal.CashRegisterNumber || existingFiscalModuleNumber != terminal.ModuleNumber {
-			return errors.New("invalid terminal-fiscal module binding")
+			return apperror.ErrInvalidBinding
 		}
 	}
 
@@ -97,39 +128,29 @@ func (r *TerminalRepository) Create(ctx context.Context, terminal *models.Termin
                                module_number, last_request_date, database_update_date, is_active, 
                                user_id, free_record_balance)
         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-        RETURNING id, created_at, updated_at`
+        RETURNING id, created_at, updated_at, version`
 
 	err = r.db.QueryRowContext(ctx, query,
 		terminal.AssemblyNumber, terminal.INN, terminal.CompanyName, terminal.Address,
 		terminal.CashRegisterNumber, terminal.ModuleNumber, terminal.LastRequestDate,
 		terminal.DatabaseUpdateDate, terminal.IsActive, terminal.UserID, terminal.FreeRecordBalance,
-	).Scan(&terminal.ID, &terminal.CreatedAt, &terminal.UpdatedAt)
+	).Scan(&terminal.ID, &terminal.CreatedAt, &terminal.UpdatedAt, &terminal.Version)
 
-	return err
+	return translate(err, nil)
 }
 
 func (r *TerminalRepository) GetByID(ctx context.Context, id int) (*models.Terminal, error) {
 	query := `
-        SELECT id, assembly_number, inn, company_name, address, cash_register_number, 
-               module_number, last_request_date, database_update_date, is_active, 
-               user_id, free_record_balance, created_at, updated_at, status_changed_by_admin
+        SELECT ` + terminalColumns + `
         FROM terminals
-        WHERE id = $1`
-
-	var terminal models.Terminal
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&terminal.ID, &terminal.AssemblyNumber, &terminal.INN, &terminal.CompanyName,
-		&terminal.Address, &terminal.CashRegisterNumber, &terminal.ModuleNumber,
-		&terminal.LastRequestDate, &terminal.DatabaseUpdateDate, &terminal.IsActive,
-		&terminal.UserID, &terminal.FreeRecordBalance, &terminal.CreatedAt, &terminal.UpdatedAt,
-		&terminal.StatusChangedByAdmin,
-	)
+        WHERE id = $1 AND deleted_at IS NULL`
 
+	terminal, err := scanTerminal(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
-		return nil, err
+		return nil, translate(err, apperror.ErrTerminalNotFound)
 	}
 
-	return &terminal, nil
+	return terminal, nil
 }
 
 func (r *TerminalRepository) Update(ctx context.Context, terminal *models.Terminal) error {
@@ -140,7 +161,7 @@ func (r *TerminalRepository) Update(ctx context.Context, terminal *models.Termin
 	if existingTerminalNumber != "" || existingFiscalModuleNumber != "" {
 		if (existingTerminalNumber != terminal.CashRegisterNumber && existingTerminalNumber != "") ||
 			(existingFiscalModuleNumber != terminal.ModuleNumber && existingFiscalModuleNumber != "") {
-			return errors.New("invalid terminal-fiscal module binding")
+			return apperror.ErrInvalidBinding
 		}
 	}
 	query := "UPDATE terminals SET "
@@ -169,59 +190,264 @@ func (r *TerminalRepository) Update(ctx context.Context, terminal *models.Termin
 	addField("free_record_balance", terminal.FreeRecordBalance)
 	addField("status_changed_by_admin", terminal.StatusChangedByAdmin)
 
-	// Всегда обновляем поле updated_at
-	query += fmt.Sprintf("updated_at = $%d ", argId)
+	// Всегда обновляем поле updated_at и увеличиваем версию
+	query += fmt.Sprintf("updated_at = $%d, version = version + 1 ", argId)
 	args = append(args, time.Now())
 	argId++
 
 	// Удаляем последнюю запятую, если она есть
 	query = strings.TrimSuffix(query, ", ")
 
-	// Добавляем условие WHERE
-	query += fmt.Sprintf("WHERE id = $%d", argId)
-	args = append(args, terminal.ID)
+	// Добавляем условие WHERE: версия должна совпадать с прочитанной, иначе
+	// запись успели изменить параллельно
+	query += fmt.Sprintf("WHERE id = $%d AND version = $%d AND deleted_at IS NULL RETURNING version, updated_at", argId, argId+1)
+	args = append(args, terminal.ID, terminal.Version)
 
 	// Логируем запрос и аргументы
-	r.logger.Info("Updating terminal",
+	r.logger.Ctx(ctx).Infow("Updating terminal",
 		"query", query,
 		"args", fmt.Sprintf("%+v", args))
 
 	// Выполняем запрос
-	result, err := r.db.ExecContext(ctx, query, args...)
+	err = r.db.QueryRowContext(ctx, query, args...).Scan(&terminal.Version, &terminal.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return staleOrMissing(ctx, r.db,
+			`SELECT EXISTS (SELECT 1 FROM terminals WHERE id = $1 AND deleted_at IS NULL)`,
+			terminal.ID, apperror.ErrTerminalNotFound)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update terminal: %w", err)
+		return fmt.Errorf("failed to update terminal: %w", translate(err, nil))
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	r.logger.Ctx(ctx).Infow("Terminal updated successfully",
+		"id", terminal.ID,
+		"version", terminal.Version)
+
+	return nil
+}
+
+// Patch записывает ровно переданные столбцы, если версия записи равна version,
+// и возвращает обновлённую строку
+func (r *TerminalRepository) Patch(ctx context.Context, id, version int, changes models.Changes) (*models.Terminal, error) {
+	for _, column := range []string{"cash_register_number", "module_number"} {
+		if number, ok := changes[column].(string); ok {
+			if err := r.checkBindingFree(ctx, id, number); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	query, args, err := patchQuery("terminals", terminalPatchColumns, changes, id, version, terminalColumns)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("no rows were updated")
+	terminal, err := scanTerminal(r.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, staleOrMissing(ctx, r.db,
+			`SELECT EXISTS (SELECT 1 FROM terminals WHERE id = $1 AND deleted_at IS NULL)`,
+			id, apperror.ErrTerminalNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch terminal: %w", translate(err, nil))
 	}
 
-	r.logger.Info("Terminal updated successfully",
-		"id", terminal.ID,
-		"rows_affected", rowsAffected)
+	r.logger.Ctx(ctx).Infow("Terminal patched", "id", id, "columns", changes.Columns(), "version", terminal.Version)
+	return terminal, nil
+}
 
+// checkBindingFree проверяет, что номер кассы или модуля не занят другим терминалом
+func (r *TerminalRepository) checkBindingFree(ctx context.Context, id int, number string) error {
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM terminals
+            WHERE id <> $1 AND (cash_register_number = $2 OR module_number = $2) AND deleted_at IS NULL
+        )`
+
+	var taken bool
+	if err := r.db.QueryRowContext(ctx, query, id, number).Scan(&taken); err != nil {
+		return fmt.Errorf("error checking existing binding: %w", err)
+	}
+	if taken {
+		return apperror.ErrInvalidBinding
+	}
 	return nil
 }
 
+// BindModule в одной транзакции переводит терминал на модуль module
+// (cash_register_number — заводской номер, module_number — фискальный),
+// активирует этот модуль и деактивирует прежний
+func (r *TerminalRepository) BindModule(ctx context.Context, terminal *models.Terminal, module *models.FiscalModule) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRowContext(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM terminals
+            WHERE id <> $1 AND (cash_register_number = $2 OR module_number = $3) AND deleted_at IS NULL
+        )`, terminal.ID, module.FactoryNumber, module.FiscalNumber).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("error checking existing binding: %w", err)
+	}
+	if taken {
+		return apperror.ErrInvalidBinding
+	}
+
+	previous := terminal.CashRegisterNumber
+	err = tx.QueryRowContext(ctx, `
+        UPDATE terminals SET cash_register_number = $2, module_number = $3, updated_at = NOW(), version = version + 1
+        WHERE id = $1 AND version = $4 AND deleted_at IS NULL
+        RETURNING version, updated_at`,
+		terminal.ID, module.FactoryNumber, module.FiscalNumber, terminal.Version,
+	).Scan(&terminal.Version, &terminal.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return staleOrMissing(ctx, r.db,
+			`SELECT EXISTS (SELECT 1 FROM terminals WHERE id = $1 AND deleted_at IS NULL)`,
+			terminal.ID, apperror.ErrTerminalNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bind terminal: %w", translate(err, nil))
+	}
+	terminal.CashRegisterNumber = module.FactoryNumber
+	terminal.ModuleNumber = module.FiscalNumber
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE fiscal_modules SET is_active = (factory_number = $1), updated_at = NOW(), version = version + 1
+        WHERE factory_number IN ($1, $2) AND is_active <> (factory_number = $1) AND deleted_at IS NULL`,
+		module.FactoryNumber, previous)
+	if err != nil {
+		return fmt.Errorf("failed to switch fiscal modules: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// UnbindModule в одной транзакции деактивирует и мягко удаляет терминал,
+// записывает change в историю статусов и деактивирует его модуль
+func (r *TerminalRepository) UnbindModule(ctx context.Context, change *models.TerminalStatusChange) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var factoryNumber string
+	err = tx.QueryRowContext(ctx, `
+        UPDATE terminals SET is_active = false, status_changed_by_admin = true, deleted_at = NOW(),
+                             updated_at = NOW(), version = version + 1
+        WHERE id = $1 AND deleted_at IS NULL
+        RETURNING cash_register_number`, change.TerminalID,
+	).Scan(&factoryNumber)
+	if err != nil {
+		return translate(err, apperror.ErrTerminalNotFound)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO terminal_status_changes (terminal_id, is_active, reason, changed_by)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at`,
+		change.TerminalID, change.IsActive, change.Reason, change.ChangedBy,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record status change: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE fiscal_modules SET is_active = false, updated_at = NOW(), version = version + 1
+        WHERE factory_number = $1 AND is_active AND deleted_at IS NULL`, factoryNumber)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate fiscal module: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 func (r *TerminalRepository) Delete(ctx context.Context, id int) error {
-	query := `DELETE FROM terminals WHERE id = $1`
+	query := `UPDATE terminals SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+
+	return translate(execAffectingOne(ctx, r.db, query, id), apperror.ErrTerminalNotFound)
+}
+
+// Restore восстанавливает терминал, если его фискальный модуль не удалён
+func (r *TerminalRepository) Restore(ctx context.Context, id int) error {
+	query := `
+        UPDATE terminals t SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+        WHERE t.id = $1 AND t.deleted_at IS NOT NULL
+          AND EXISTS (
+              SELECT 1 FROM fiscal_modules fm
+              WHERE fm.factory_number = t.cash_register_number AND fm.deleted_at IS NULL
+          )`
+
+	return translate(execAffectingOne(ctx, r.db, query, id), apperror.ErrTerminalNotFound)
+}
+
+// PurgeDeleted окончательно удаляет терминалы, удалённые раньше before
+func (r *TerminalRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM terminals WHERE deleted_at IS NOT NULL AND deleted_at < $1`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge terminals: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *TerminalRepository) LogStatusChange(ctx context.Context, change *models.TerminalStatusChange) error {
+	query := `
+        INSERT INTO terminal_status_changes (terminal_id, is_active, reason, changed_by)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		change.TerminalID, change.IsActive, change.Reason, change.ChangedBy,
+	).Scan(&change.ID, &change.CreatedAt)
+}
+
+func (r *TerminalRepository) ListStatusChanges(ctx context.Context, terminalID int) ([]*models.TerminalStatusChange, error) {
+	query := `
+        SELECT id, terminal_id, is_active, reason, changed_by, created_at
+        FROM terminal_status_changes
+        WHERE terminal_id = $1
+        ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, terminalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	_, err := r.db.ExecContext(ctx, query, id)
+	var changes []*models.TerminalStatusChange
+	for rows.Next() {
+		var change models.TerminalStatusChange
+		if err := rows.Scan(
+			&change.ID, &change.TerminalID, &change.IsActive, &change.Reason, &change.ChangedBy, &change.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change)
+	}
+
+	return changes, rows.Err()
+}
 
-	return err
+// CountByUserID возвращает количество неудалённых терминалов пользователя
+func (r *TerminalRepository) CountByUserID(ctx context.Context, userID int) (int, error) {
+	query := `SELECT COUNT(*) FROM terminals WHERE user_id = $1 AND deleted_at IS NULL`
+
+	var count int
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
 }
 
 func (r *TerminalRepository) List(ctx context.Context) ([]*models.Terminal, error) {
 	query := `
-        SELECT id, assembly_number, inn, company_name, address, cash_register_number, 
-               module_number, last_request_date, database_update_date, is_active, 
-               user_id, free_record_balance, created_at, updated_at, status_changed_by_admin
+        SELECT ` + terminalColumns + `
         FROM terminals
+        WHERE deleted_at IS NULL
         ORDER BY id`
 
 	rows, err := r.db.QueryContext(ctx, query)
@@ -232,18 +458,11 @@ func (r *TerminalRepository) List(ctx context.Context) ([]*models.Terminal, erro
 
 	var terminals []*models.Terminal
 	for rows.Next() {
-		var terminal models.Terminal
-		err := rows.Scan(
-			&terminal.ID, &terminal.AssemblyNumber, &terminal.INN, &terminal.CompanyName,
-			&terminal.Address, &terminal.CashRegisterNumber, &terminal.ModuleNumber,
-			&terminal.LastRequestDate, &terminal.DatabaseUpdateDate, &terminal.IsActive,
-			&terminal.UserID, &terminal.FreeRecordBalance, &terminal.CreatedAt, &terminal.UpdatedAt,
-			&terminal.StatusChangedByAdmin,
-		)
+		terminal, err := scanTerminal(rows)
 		if err != nil {
 			return nil, err
 		}
-		terminals = append(terminals, &terminal)
+		terminals = append(terminals, terminal)
 	}
 
 	return terminals, nil
@@ -253,7 +472,7 @@ func (r *TerminalRepository) CheckTerminalFiscalModuleBinding(ctx context.Contex
 	query := `
         SELECT COUNT(*) 
         FROM terminals 
-        WHERE cash_register_number = $1 AND module_number = $2
+        WHERE cash_register_number = $1 AND module_number = $2 AND deleted_at IS NULL
     `
 	var count int
 	err := r.db.QueryRowContext(ctx, query, terminalNumber, fiscalModuleNumber).Scan(&count)
@@ -267,7 +486,7 @@ func (r *TerminalRepository) GetExistingBinding(ctx context.Context, number stri
 	query := `
         SELECT cash_register_number, module_number 
         FROM terminals 
-        WHERE cash_register_number = $1 OR module_number = $1
+        WHERE (cash_register_number = $1 OR module_number = $1) AND deleted_at IS NULL
     `
 	var terminalNumber, fiscalModuleNumber string
 	err := r.db.QueryRowContext(ctx, query, number).Scan(&terminalNumber, &fiscalModuleNumber)
@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+type TwoFactorRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewTwoFactorRepository(db *sql.DB, logger *logger.Logger) *TwoFactorRepository {
+	return &TwoFactorRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *TwoFactorRepository) Get(ctx context.Context, userID int) (*models.TwoFactor, error) {
+	query := `
+        SELECT COALESCE(totp_secret, ''), totp_enabled, totp_last_step
+        FROM users
+        WHERE id = $1 AND deleted_at IS NULL`
+
+	var tf models.TwoFactor
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&tf.Secret, &tf.Enabled, &tf.LastStep)
+	if err != nil {
+		return nil, translate(err, apperror.ErrUserNotFound)
+	}
+	return &tf, nil
+}
+
+// SetPending запоминает секрет, который ещё нужно подтвердить кодом.
+// Уже подключённый второй фактор так не заменить.
+func (r *TwoFactorRepository) SetPending(ctx context.Context, userID int, secret string) error {
+	query := `
+        UPDATE users SET totp_secret = $2, totp_last_step = 0
+        WHERE id = $1 AND deleted_at IS NULL AND NOT totp_enabled`
+
+	result, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return translate(err, nil)
+	}
+	return r.expectRow(ctx, result, userID)
+}
+
+// Enable включает второй фактор и заменяет коды восстановления одной транзакцией
+func (r *TwoFactorRepository) Enable(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+        UPDATE users SET totp_enabled = true, totp_last_step = $2
+        WHERE id = $1 AND deleted_at IS NULL AND totp_secret IS NOT NULL AND NOT totp_enabled`, userID, step)
+	if err != nil {
+		return translate(err, nil)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return apperror.ErrTwoFactorNotPending
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Disable отключает второй фактор и удаляет коды восстановления
+func (r *TwoFactorRepository) Disable(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+        UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = 0
+        WHERE id = $1 AND deleted_at IS NULL`, userID)
+	if err != nil {
+		return translate(err, nil)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return apperror.ErrUserNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return tx.Commit()
+}
+
+// UseStep принимает шаг TOTP, только если он новее последнего принятого:
+// так перехваченный код нельзя повторить, в том числе параллельно
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `
+        UPDATE users SET totp_last_step = $2
+        WHERE id = $1 AND totp_enabled AND totp_last_step < $2`
+
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, translate(err, nil)
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// UseRecoveryCode гасит код восстановления; повторно он не подойдёт
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := `
+        UPDATE user_recovery_codes SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, translate(err, nil)
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *TwoFactorRepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID,
+	).Scan(&count)
+	return count, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash,
+		); err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// expectRow отличает отсутствующего пользователя от уже подключённого второго фактора
+func (r *TwoFactorRepository) expectRow(ctx context.Context, result sql.Result, userID int) error {
+	rows, err := result.RowsAffected()
+	if err != nil || rows > 0 {
+		return err
+	}
+	tf, err := r.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if tf.Enabled {
+		return apperror.ErrTwoFactorAlreadyEnabled
+	}
+	return apperror.ErrUserNotFound
+}
@@ -3,14 +3,50 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
 )
 
+// userColumns — столбцы, которые читают GetByID, List и Patch; порядок совпадает со scanUser
+const userColumns = `id, inn, username, password, company_name, is_active, is_admin, created_at, updated_at, version, totp_enabled, locked_until,
+    COALESCE(email, ''), COALESCE(phone, ''), email_verified_at, must_change_password`
+
+// userPatchColumns — столбцы, которые можно менять через Patch
+var userPatchColumns = map[string]bool{
+	"inn":          true,
+	"username":     true,
+	"password":     true,
+	"company_name": true,
+	"is_active":    true,
+	"is_admin":     true,
+	"email":        true,
+	"phone":        true,
+	// email_verified_at сбрасывается вместе со сменой адреса
+	"email_verified_at": true,
+	// must_change_password ставится вместе с паролем, заданным администратором
+	"must_change_password": true,
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID, &user.INN, &user.Username, &user.Password, &user.CompanyName,
+		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt, &user.Version,
+		&user.TOTPEnabled, &user.LockedUntil,
+		&user.Email, &user.Phone, &user.EmailVerifiedAt, &user.MustChangePassword,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 type UserRepository struct {
 	db     *sql.DB
 	logger *logger.Logger
@@ -25,34 +61,30 @@ func NewUserRepository(db *sql.DB, logger *logger.Logger) *UserRepository {
 
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	query := `
-        INSERT INTO users (inn, username, password, company_name, is_active, is_admin)
-        VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING id, created_at, updated_at`
+        INSERT INTO users (inn, username, password, company_name, is_active, is_admin, email, phone, must_change_password)
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9)
+        RETURNING id, created_at, updated_at, version`
 
 	err := r.db.QueryRowContext(ctx, query,
-		user.INN, user.Username, user.Password, user.CompanyName, user.IsActive, user.IsAdmin,
-	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		user.INN, user.Username, user.Password, user.CompanyName, user.IsActive, user.IsAdmin, user.Email, user.Phone,
+		user.MustChangePassword,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.Version)
 
-	return err
+	return translate(err, nil)
 }
 
 func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
 	query := `
-        SELECT id, inn, username, password, company_name, is_active, is_admin, created_at, updated_at
+        SELECT ` + userColumns + `
         FROM users
-        WHERE id = $1`
-
-	var user models.User
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.INN, &user.Username, &user.Password, &user.CompanyName,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
-	)
+        WHERE id = $1 AND deleted_at IS NULL`
 
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
-		return nil, err
+		return nil, translate(err, apperror.ErrUserNotFound)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
@@ -80,30 +112,161 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 		args = append(args, user.CompanyName)
 		argId++
 	}
-	query += fmt.Sprintf("is_active = $%d, is_admin = $%d, updated_at = $%d ", argId, argId+1, argId+2)
-	args = append(args, user.IsActive, user.IsAdmin, time.Now())
-	argId += 3
+	if user.Email != "" {
+		query += fmt.Sprintf("email = $%d, ", argId)
+		args = append(args, user.Email)
+		argId++
+	}
+	if user.Phone != "" {
+		query += fmt.Sprintf("phone = $%d, ", argId)
+		args = append(args, user.Phone)
+		argId++
+	}
+	query += fmt.Sprintf("is_active = $%d, is_admin = $%d, email_verified_at = $%d, must_change_password = $%d, updated_at = $%d, version = version + 1 ",
+		argId, argId+1, argId+2, argId+3, argId+4)
+	args = append(args, user.IsActive, user.IsAdmin, user.EmailVerifiedAt, user.MustChangePassword, time.Now())
+	argId += 5
 
 	query = strings.TrimSuffix(query, ", ")
-	query += fmt.Sprintf("WHERE id = $%d", argId)
-	args = append(args, user.ID)
+	query += fmt.Sprintf("WHERE id = $%d AND version = $%d AND deleted_at IS NULL RETURNING version, updated_at", argId, argId+1)
+	args = append(args, user.ID, user.Version)
 
-	_, err := r.db.ExecContext(ctx, query, args...)
-	return err
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&user.Version, &user.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return staleOrMissing(ctx, r.db,
+			`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`,
+			user.ID, apperror.ErrUserNotFound)
+	}
+	return translate(err, nil)
 }
 
-func (r *UserRepository) Delete(ctx context.Context, id int) error {
-	query := `DELETE FROM users WHERE id = $1`
+// Patch записывает ровно переданные столбцы, если версия записи равна version,
+// и возвращает обновлённую строку
+func (r *UserRepository) Patch(ctx context.Context, id, version int, changes models.Changes) (*models.User, error) {
+	query, args, err := patchQuery("users", userPatchColumns, changes, id, version, userColumns)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := r.db.ExecContext(ctx, query, id)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, staleOrMissing(ctx, r.db,
+			`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`,
+			id, apperror.ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, translate(err, nil)
+	}
+	return user, nil
+}
 
+// Delete помечает пользователя удалённым и в той же транзакции применяет
+// политику к его терминалам и фискальным модулям. Всё, что удаляется вместе
+// с пользователем, получает ту же отметку deleted_at, чтобы Restore мог
+// вернуть это обратно.
+func (r *UserRepository) Delete(ctx context.Context, id int, policy models.UserDeletePolicy) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	err = tx.QueryRowContext(ctx,
+		`UPDATE users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING deleted_at`, id,
+	).Scan(&deletedAt)
+	if err != nil {
+		return translate(err, apperror.ErrUserNotFound)
+	}
+
+	switch policy {
+	case models.UserDeletePolicyDeactivate:
+		// Терминалы остаются, но перестают работать до решения администратора
+		_, err = tx.ExecContext(ctx, `
+            UPDATE terminals SET is_active = false, status_changed_by_admin = true, updated_at = NOW(), version = version + 1
+            WHERE user_id = $1 AND deleted_at IS NULL`, id)
+	case models.UserDeletePolicyCascade:
+		_, err = tx.ExecContext(ctx, `
+            UPDATE terminals SET deleted_at = $2
+            WHERE user_id = $1 AND deleted_at IS NULL`, id, deletedAt)
+		if err == nil {
+			err = r.deleteModules(ctx, tx, id, deletedAt)
+		}
+	default:
+		// restrict: терминалов у пользователя нет, модули уходят вместе с ним
+		err = r.deleteModules(ctx, tx, id, deletedAt)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply %s policy: %w", policy, err)
+	}
+
+	return tx.Commit()
+}
+
+// deleteModules помечает удалёнными модули пользователя, к которым не привязан живой терминал
+func (r *UserRepository) deleteModules(ctx context.Context, tx *sql.Tx, userID int, deletedAt time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+        UPDATE fiscal_modules fm SET deleted_at = $2
+        WHERE fm.user_id = $1 AND fm.deleted_at IS NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM terminals t
+              WHERE t.cash_register_number = fm.factory_number AND t.deleted_at IS NULL
+          )`, userID, deletedAt)
 	return err
 }
 
+// Restore восстанавливает пользователя вместе с терминалами и модулями,
+// удалёнными одновременно с ним
+func (r *UserRepository) Restore(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	err = tx.QueryRowContext(ctx,
+		`SELECT deleted_at FROM users WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE`, id,
+	).Scan(&deletedAt)
+	if err != nil {
+		return translate(err, apperror.ErrUserNotFound)
+	}
+
+	queries := []string{
+		`UPDATE fiscal_modules SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE user_id = $1 AND deleted_at = $2`,
+		`UPDATE terminals SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE user_id = $1 AND deleted_at = $2`,
+		`UPDATE users SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at = $2`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, id, deletedAt); err != nil {
+			return fmt.Errorf("failed to restore user: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeleted окончательно удаляет пользователей, удалённых раньше before.
+// Пользователи, на которых ещё ссылаются терминалы или модули, пропускаются.
+func (r *UserRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+        DELETE FROM users u
+        WHERE u.deleted_at IS NOT NULL AND u.deleted_at < $1
+          AND NOT EXISTS (SELECT 1 FROM terminals t WHERE t.user_id = u.id)
+          AND NOT EXISTS (SELECT 1 FROM fiscal_modules fm WHERE fm.user_id = u.id)`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge users: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 func (r *UserRepository) List(ctx context.Context) ([]*models.User, error) {
 	query := `
-        SELECT id, inn, username, password, company_name, is_active, is_admin, created_at, updated_at
+        SELECT ` + userColumns + `
         FROM users
+        WHERE deleted_at IS NULL
         ORDER BY id`
 
 	rows, err := r.db.QueryContext(ctx, query)
@@ -114,15 +277,11 @@ func (r *UserRepository) List(ctx context.Context) ([]*models.User, error) {
 
 	var users []*models.User
 	for rows.Next() {
-		var user models.User
-		err := rows.Scan(
-			&user.ID, &user.INN, &user.Username, &user.Password, &user.CompanyName,
-			&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
-		users = append(users, &user)
+		users = append(users, user)
 	}
 
 	return users, nil
@@ -130,19 +289,172 @@ func (r *UserRepository) List(ctx context.Context) ([]*models.User, error) {
 
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-        SELECT id, inn, username, password, is_active, is_admin, created_at, updated_at
+        SELECT ` + userColumns + `
         FROM users
-        WHERE username = $1`
+        WHERE username = $1 AND deleted_at IS NULL`
 
-	var user models.User
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
-		&user.ID, &user.INN, &user.Username, &user.Password,
-		&user.IsActive, &user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, username))
+	if err != nil {
+		return nil, translate(err, apperror.ErrUserNotFound)
+	}
 
+	return user, nil
+}
+
+// GetByEmail ищет пользователя по адресу без учёта регистра
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `
+        SELECT ` + userColumns + `
+        FROM users
+        WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
 	if err != nil {
-		return nil, err
+		return nil, translate(err, apperror.ErrUserNotFound)
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// SetPassword меняет хеш пароля, не сверяя версию: пароль меняет сам
+// пользователь, по ссылке из письма или при входе. Требование сменить
+// пароль на этом снимается.
+func (r *UserRepository) SetPassword(ctx context.Context, id int, passwordHash string) error {
+	query := `
+        UPDATE users SET password = $2, must_change_password = FALSE, updated_at = NOW(), version = version + 1
+        WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id, passwordHash)
+	if err != nil {
+		return translate(err, nil)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return apperror.ErrUserNotFound
+	}
+	return nil
+}
+
+// PasswordHistory возвращает до limit прежних хешей пароля, начиная с последнего
+func (r *UserRepository) PasswordHistory(ctx context.Context, id, limit int) ([]string, error) {
+	query := `
+        SELECT password_hash FROM user_password_history
+        WHERE user_id = $1
+        ORDER BY created_at DESC, id DESC
+        LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password history: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// AddPasswordHistory запоминает сменённый хеш и оставляет только keep последних
+func (r *UserRepository) AddPasswordHistory(ctx context.Context, id int, passwordHash string, keep int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO user_password_history (user_id, password_hash) VALUES ($1, $2)`, id, passwordHash,
+	); err != nil {
+		return translate(err, nil)
+	}
+	_, err = tx.ExecContext(ctx, `
+        DELETE FROM user_password_history
+        WHERE user_id = $1 AND id NOT IN (
+            SELECT id FROM user_password_history
+            WHERE user_id = $1
+            ORDER BY created_at DESC, id DESC
+            LIMIT $2
+        )`, id, keep)
+	if err != nil {
+		return fmt.Errorf("failed to trim password history: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// MarkEmailVerified подтверждает адрес, только если он не менялся с отправки письма
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id int, email string) (bool, error) {
+	query := `
+        UPDATE users SET email_verified_at = NOW()
+        WHERE id = $1 AND LOWER(email) = LOWER($2) AND deleted_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id, email)
+	if err != nil {
+		return false, translate(err, nil)
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// RecordLoginFailure засчитывает неудачный вход одним запросом, чтобы
+// параллельные попытки не теряли друг друга. Когда счётчик доходит до порога,
+// он обнуляется, а вход блокируется на base·2^n, но не дольше max, где n —
+// число прошлых блокировок. Возвращает текущее значение locked_until.
+// Версию записи не меняет: это не правка пользователя.
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, id int, policy models.LockoutPolicy) (*time.Time, error) {
+	query := `
+        UPDATE users SET
+            failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $2 THEN 0 ELSE failed_login_attempts + 1 END,
+            lockout_count = CASE WHEN failed_login_attempts + 1 >= $2 THEN lockout_count + 1 ELSE lockout_count END,
+            locked_until = CASE WHEN failed_login_attempts + 1 >= $2
+                THEN NOW() + make_interval(secs => LEAST($3::float8 * POWER(2, LEAST(lockout_count, 30)), $4::float8))
+                ELSE locked_until END
+        WHERE id = $1 AND deleted_at IS NULL
+        RETURNING locked_until`
+
+	var lockedUntil *time.Time
+	err := r.db.QueryRowContext(ctx, query, id, policy.Threshold, policy.Base.Seconds(), policy.Max.Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		return nil, translate(err, apperror.ErrUserNotFound)
+	}
+	return lockedUntil, nil
+}
+
+// ResetLoginFailures обнуляет счётчики после успешного входа
+func (r *UserRepository) ResetLoginFailures(ctx context.Context, id int) error {
+	query := `
+        UPDATE users SET failed_login_attempts = 0, lockout_count = 0, locked_until = NULL
+        WHERE id = $1 AND (failed_login_attempts <> 0 OR lockout_count <> 0 OR locked_until IS NOT NULL)`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	return translate(err, nil)
+}
+
+// Unlock снимает блокировку входа и обнуляет счётчики неудачных попыток
+func (r *UserRepository) Unlock(ctx context.Context, id int) error {
+	query := `
+        UPDATE users SET failed_login_attempts = 0, lockout_count = 0, locked_until = NULL
+        WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return translate(err, nil)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return apperror.ErrUserNotFound
+	}
+	return nil
 }
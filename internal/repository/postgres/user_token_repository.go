@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+type UserTokenRepository struct {
+	db     *sql.DB
+	logger *logger.Logger
+}
+
+func NewUserTokenRepository(db *sql.DB, logger *logger.Logger) *UserTokenRepository {
+	return &UserTokenRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *UserTokenRepository) Create(ctx context.Context, token *models.UserToken) error {
+	query := `
+        INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at)
+        VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+        RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		token.UserID, token.Purpose, token.TokenHash, token.Email, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	return translate(err, nil)
+}
+
+// Consume гасит действующий токен одним запросом, поэтому по одной ссылке
+// нельзя пройти дважды даже параллельно
+func (r *UserTokenRepository) Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (*models.UserToken, error) {
+	query := `
+        UPDATE user_tokens SET used_at = $3
+        WHERE purpose = $1 AND token_hash = $2 AND used_at IS NULL AND expires_at > $3
+        RETURNING id, user_id, purpose, token_hash, COALESCE(email, ''), expires_at, used_at, created_at`
+
+	var t models.UserToken
+	err := r.db.QueryRowContext(ctx, query, purpose, tokenHash, now).Scan(
+		&t.ID, &t.UserID, &t.Purpose, &t.TokenHash, &t.Email, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt,
+	)
+	if err != nil {
+		return nil, translate(err, apperror.ErrInvalidUserToken)
+	}
+	return &t, nil
+}
+
+// Revoke гасит все неиспользованные токены пользователя с этим назначением
+func (r *UserTokenRepository) Revoke(ctx context.Context, userID int, purpose string) error {
+	query := `
+        UPDATE user_tokens SET used_at = NOW()
+        WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, purpose); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired удаляет истёкшие токены; использованные живут до истечения срока
+func (r *UserTokenRepository) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_tokens WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge user tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
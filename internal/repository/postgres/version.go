@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+)
+
+// staleOrMissing вызывается, когда UPDATE ... WHERE version = $n не нашёл строку:
+// если запись на месте, её успели изменить, иначе она не существует или удалена.
+// existsQuery принимает id и возвращает одно булево значение.
+func staleOrMissing(ctx context.Context, db *sql.DB, existsQuery string, id int, notFound *apperror.Error) error {
+	var exists bool
+	if err := db.QueryRowContext(ctx, existsQuery, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return apperror.ErrVersionMismatch
+	}
+	return notFound
+}
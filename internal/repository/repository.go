@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"time"
 
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/repository/postgres"
@@ -14,14 +15,32 @@ type Repositories struct {
 	User         UserRepository
 	FiscalModule FiscalModuleRepository
 	Terminal     TerminalRepository
+	Report       ReportRepository
+	ExportAudit  ExportAuditRepository
+	Idempotency  IdempotencyRepository
+	Stats        StatsRepository
+	RateLimit    RateLimitRepository
+	TwoFactor    TwoFactorRepository
+	UserToken    UserTokenRepository
 }
 
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
 	GetByID(ctx context.Context, id int) (*models.User, error)
 	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	SetPassword(ctx context.Context, id int, passwordHash string) error
+	PasswordHistory(ctx context.Context, id, limit int) ([]string, error)
+	AddPasswordHistory(ctx context.Context, id int, passwordHash string, keep int) error
+	MarkEmailVerified(ctx context.Context, id int, email string) (bool, error)
+	RecordLoginFailure(ctx context.Context, id int, policy models.LockoutPolicy) (*time.Time, error)
+	ResetLoginFailures(ctx context.Context, id int) error
+	Unlock(ctx context.Context, id int) error
 	Update(ctx context.Context, user *models.User) error
-	Delete(ctx context.Context, id int) error
+	Patch(ctx context.Context, id, version int, changes models.Changes) (*models.User, error)
+	Delete(ctx context.Context, id int, policy models.UserDeletePolicy) error
+	Restore(ctx context.Context, id int) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 	List(ctx context.Context) ([]*models.User, error)
 }
 
@@ -32,6 +51,8 @@ type FiscalModuleRepository interface {
 	Update(ctx context.Context, module *models.FiscalModule) error
 	Delete(ctx context.Context, id int) error
 	DeleteByUserID(ctx context.Context, userID int) error
+	Restore(ctx context.Context, id int) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 	List(ctx context.Context) ([]*models.FiscalModule, error)
 }
 
@@ -41,11 +62,75 @@ type TerminalRepository interface {
 	Create(ctx context.Context, terminal *models.Terminal) error
 	GetByID(ctx context.Context, id int) (*models.Terminal, error)
 	Update(ctx context.Context, terminal *models.Terminal) error
+	Patch(ctx context.Context, id, version int, changes models.Changes) (*models.Terminal, error)
 	Delete(ctx context.Context, id int) error
+	Restore(ctx context.Context, id int) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	CountByUserID(ctx context.Context, userID int) (int, error)
+	LogStatusChange(ctx context.Context, change *models.TerminalStatusChange) error
+	// BindModule и UnbindModule меняют терминал и фискальные модули в одной транзакции
+	BindModule(ctx context.Context, terminal *models.Terminal, module *models.FiscalModule) error
+	UnbindModule(ctx context.Context, change *models.TerminalStatusChange) error
+	ListStatusChanges(ctx context.Context, terminalID int) ([]*models.TerminalStatusChange, error)
 	List(ctx context.Context) ([]*models.Terminal, error)
 	GetUserIDByCashRegisterNumber(ctx context.Context, cashRegisterNumber string) (int, error)
 }
 
+type ReportRepository interface {
+	CreateSchedule(ctx context.Context, schedule *models.ReportSchedule) error
+	GetScheduleByID(ctx context.Context, id int) (*models.ReportSchedule, error)
+	UpdateSchedule(ctx context.Context, schedule *models.ReportSchedule) error
+	DeleteSchedule(ctx context.Context, id int) error
+	ListSchedules(ctx context.Context, userID int) ([]*models.ReportSchedule, error)
+	ListDueSchedules(ctx context.Context, now time.Time) ([]*models.ReportSchedule, error)
+	ClaimSchedule(ctx context.Context, id int, dueAt, runAt, nextRunAt time.Time) (bool, error)
+	CreateRun(ctx context.Context, run *models.ReportRun) error
+	FinishRun(ctx context.Context, run *models.ReportRun) error
+	ListRuns(ctx context.Context, scheduleID int) ([]*models.ReportRun, error)
+}
+
+type ExportAuditRepository interface {
+	Create(ctx context.Context, entry *models.ExportAuditEntry) error
+	List(ctx context.Context, limit int) ([]*models.ExportAuditEntry, error)
+}
+
+type IdempotencyRepository interface {
+	// Reserve занимает ключ (истёкшая запись перезаписывается). Если ключ уже
+	// занят, возвращает существующую запись, иначе nil.
+	Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *models.IdempotencyRecord) error
+	Release(ctx context.Context, scope, key string) error
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type StatsRepository interface {
+	FleetStats(ctx context.Context, staleBefore time.Time) (*models.FleetStats, error)
+}
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userID int) (*models.TwoFactor, error)
+	SetPending(ctx context.Context, userID int, secret string) error
+	Enable(ctx context.Context, userID int, step int64, codeHashes []string) error
+	Disable(ctx context.Context, userID int) error
+	UseStep(ctx context.Context, userID int, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	CountRecoveryCodes(ctx context.Context, userID int) (int, error)
+}
+
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *models.UserToken) error
+	Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (*models.UserToken, error)
+	Revoke(ctx context.Context, userID int, purpose string) error
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// RateLimitRepository реализует ratelimit.Store
+type RateLimitRepository interface {
+	Hit(ctx context.Context, key string, windowStart, expiresAt time.Time) (int, error)
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
 func NewRepositories(db *sql.DB, logger *logger.Logger) *Repositories {
 	if db == nil {
 		log.Fatal("Database connection is nil")
@@ -57,6 +142,13 @@ func NewRepositories(db *sql.DB, logger *logger.Logger) *Repositories {
 		User:         postgres.NewUserRepository(db, logger),
 		FiscalModule: postgres.NewFiscalModuleRepository(db, logger),
 		Terminal:     postgres.NewTerminalRepository(db, logger),
+		Report:       postgres.NewReportRepository(db, logger),
+		ExportAudit:  postgres.NewExportAuditRepository(db, logger),
+		Idempotency:  postgres.NewIdempotencyRepository(db, logger),
+		Stats:        postgres.NewStatsRepository(db, logger),
+		RateLimit:    postgres.NewRateLimitRepository(db, logger),
+		TwoFactor:    postgres.NewTwoFactorRepository(db, logger),
+		UserToken:    postgres.NewUserTokenRepository(db, logger),
 	}
 }
 
@@ -64,3 +156,10 @@ func NewRepositories(db *sql.DB, logger *logger.Logger) *Repositories {
 type UserRepoCreator func(*sql.DB, *logger.Logger) UserRepository
 type FiscalModuleRepoCreator func(*sql.DB, *logger.Logger) FiscalModuleRepository
 type TerminalRepoCreator func(*sql.DB, *logger.Logger) TerminalRepository
+type ReportRepoCreator func(*sql.DB, *logger.Logger) ReportRepository
+type ExportAuditRepoCreator func(*sql.DB, *logger.Logger) ExportAuditRepository
+type IdempotencyRepoCreator func(*sql.DB, *logger.Logger) IdempotencyRepository
+type StatsRepoCreator func(*sql.DB, *logger.Logger) StatsRepository
+type RateLimitRepoCreator func(*sql.DB, *logger.Logger) RateLimitRepository
+type TwoFactorRepoCreator func(*sql.DB, *logger.Logger) TwoFactorRepository
+type UserTokenRepoCreator func(*sql.DB, *logger.Logger) UserTokenRepository
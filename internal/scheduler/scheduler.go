@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type JobFunc func(ctx context.Context, now time.Time) error
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      JobFunc
+}
+
+// Scheduler периодически запускает фоновые задачи до отмены контекста
+type Scheduler struct {
+	logger *logger.Logger
+	jobs   []job
+	wg     sync.WaitGroup
+}
+
+func New(logger *logger.Logger) *Scheduler {
+	return &Scheduler{logger: logger}
+}
+
+func (s *Scheduler) Add(name string, interval time.Duration, run JobFunc) {
+	s.jobs = append(s.jobs, job{name: name, interval: interval, run: run})
+}
+
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func(j job) {
+			defer s.wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+}
+
+// Wait дожидается завершения всех задач после отмены контекста
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j job) {
+	s.logger.Infow("Starting background job", "job", j.name, "interval", j.interval.String())
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Infow("Background job stopped", "job", j.name)
+			return
+		case now := <-ticker.C:
+			s.runOnce(ctx, j, now)
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, j job, now time.Time) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.logger.Errorw("Background job panicked", "job", j.name, "panic", rec)
+		}
+	}()
+
+	// Каждый запуск — отдельная трасса
+	ctx, span := tracing.Start(ctx, "job "+j.name)
+	defer span.End()
+
+	if err := j.run(ctx, now); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		s.logger.Ctx(ctx).Errorw("Background job failed", "job", j.name, "error", err)
+	}
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/notify"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+)
+
+// notifyTimeout ограничивает отправку письма, которая идёт уже после ответа клиенту
+const notifyTimeout = 30 * time.Second
+
+// AccountService — восстановление пароля и подтверждение почты по одноразовым
+// ссылкам из писем
+type AccountService struct {
+	users     repository.UserRepository
+	tokens    repository.UserTokenRepository
+	notifier  notify.Notifier
+	passwords *PasswordService
+	policy    models.AccountPolicy
+	logger    *logger.Logger
+}
+
+func NewAccountService(users repository.UserRepository, tokens repository.UserTokenRepository, notifier notify.Notifier, passwords *PasswordService, policy models.AccountPolicy, logger *logger.Logger) *AccountService {
+	return &AccountService{
+		users:     users,
+		tokens:    tokens,
+		notifier:  notifier,
+		passwords: passwords,
+		policy:    policy,
+		logger:    logger,
+	}
+}
+
+// SendVerification отправляет письмо для подтверждения текущего адреса
+// пользователя; прежние ссылки перестают действовать
+func (s *AccountService) SendVerification(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "AccountService.SendVerification")
+	defer span.End()
+
+	if user.Email == "" {
+		return nil
+	}
+
+	token, err := s.issue(ctx, user, models.UserTokenEmailVerification, s.policy.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(ctx, &notify.Message{
+		Email:   user.Email,
+		Phone:   user.Phone,
+		Subject: "Подтверждение адреса электронной почты",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы подтвердить адрес, перейдите по ссылке:\n%s\n\nСсылка действует %s.",
+			user.Username, link(s.policy.EmailVerificationURL, token), ttlText(s.policy.EmailVerificationTTL)),
+	})
+	return nil
+}
+
+// StartVerification — SendVerification для только что созданного или
+// изменённого пользователя: запись уже сохранена, поэтому сбой отправки не
+// отменяет запрос, а лишь логируется; письмо можно запросить повторно
+func (s *AccountService) StartVerification(ctx context.Context, user *models.User) {
+	if err := s.SendVerification(ctx, user); err != nil {
+		s.logger.Ctx(ctx).Errorw("Failed to start email verification", "user_id", user.ID, "error", err)
+	}
+}
+
+// NotifyEmailChanged сообщает на прежний адрес, что адрес учётной записи
+// сменился: если его сменил не владелец, тот узнает об этом
+func (s *AccountService) NotifyEmailChanged(ctx context.Context, user *models.User, oldEmail string) {
+	if oldEmail == "" {
+		return
+	}
+	s.send(ctx, &notify.Message{
+		Email:   oldEmail,
+		Phone:   user.Phone,
+		Subject: "Адрес электронной почты изменён",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nАдрес электронной почты вашей учётной записи изменён на %s.\n\n"+
+			"Если вы этого не делали, срочно обратитесь к администратору.", user.Username, user.Email),
+	})
+}
+
+// ResendVerification повторно отправляет письмо текущему пользователю
+func (s *AccountService) ResendVerification(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "AccountService.ResendVerification")
+	defer span.End()
+
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok {
+		return apperror.ErrUnauthenticated
+	}
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return apperror.ErrEmailMissing
+	}
+	if user.EmailVerifiedAt != nil {
+		return apperror.ErrEmailAlreadyVerified
+	}
+
+	return s.SendVerification(ctx, user)
+}
+
+func (s *AccountService) VerifyEmail(ctx context.Context, req *models.VerifyEmailRequest) error {
+	ctx, span := tracing.Start(ctx, "AccountService.VerifyEmail")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return err
+	}
+
+	token, err := s.tokens.Consume(ctx, models.UserTokenEmailVerification, hashToken(req.Token), time.Now())
+	if err != nil {
+		return err
+	}
+	verified, err := s.users.MarkEmailVerified(ctx, token.UserID, token.Email)
+	if err != nil {
+		return err
+	}
+	// Адрес сменили после отправки письма — ссылка относится к старому
+	if !verified {
+		return apperror.ErrInvalidUserToken
+	}
+
+	logger.WithFields(ctx, "user_id", token.UserID)
+	s.logger.Ctx(ctx).Infow("Email verified")
+	return nil
+}
+
+// ForgotPassword отправляет ссылку для сброса пароля на подтверждённый адрес.
+// Ответ один и тот же, есть такой пользователь или нет, чтобы по нему нельзя
+// было перебирать учётные записи.
+func (s *AccountService) ForgotPassword(ctx context.Context, req *models.ForgotPasswordRequest) error {
+	ctx, span := tracing.Start(ctx, "AccountService.ForgotPassword")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return err
+	}
+
+	user, err := s.findByLogin(ctx, strings.TrimSpace(req.Login))
+	if errors.Is(err, apperror.ErrUserNotFound) {
+		s.logger.Ctx(ctx).Infow("Password reset requested for unknown login")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.WithFields(ctx, "user_id", user.ID)
+	if user.Email == "" || user.EmailVerifiedAt == nil {
+		s.logger.Ctx(ctx).Warnw("Password reset requested but the account has no verified email")
+		return nil
+	}
+
+	token, err := s.issue(ctx, user, models.UserTokenPasswordReset, s.policy.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(ctx, &notify.Message{
+		Email:   user.Email,
+		Phone:   user.Phone,
+		Subject: "Восстановление пароля",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует %s и сработает один раз. Если вы не запрашивали сброс, просто проигнорируйте это письмо.",
+			user.Username, link(s.policy.PasswordResetURL, token), ttlText(s.policy.PasswordResetTTL)),
+	})
+	s.logger.Ctx(ctx).Infow("Password reset link sent")
+	return nil
+}
+
+// ResetPassword задаёт новый пароль по ссылке из письма. Заодно снимается
+// блокировка входа: владелец почты подтвердил, что это он.
+func (s *AccountService) ResetPassword(ctx context.Context, req *models.ResetPasswordRequest) error {
+	ctx, span := tracing.Start(ctx, "AccountService.ResetPassword")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return err
+	}
+	// Простые правила проверяются до того, как гасится ссылка; повтор
+	// прежнего пароля выяснится только после, и ссылку придётся запросить снова
+	if err := s.passwords.Check(req.Password, "password"); err != nil {
+		return err
+	}
+
+	token, err := s.tokens.Consume(ctx, models.UserTokenPasswordReset, hashToken(req.Token), time.Now())
+	if err != nil {
+		return err
+	}
+	logger.WithFields(ctx, "user_id", token.UserID)
+
+	user, err := s.users.GetByID(ctx, token.UserID)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := s.passwords.Hash(ctx, user, req.Password, "password")
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetPassword(ctx, user.ID, hashedPassword); err != nil {
+		return err
+	}
+	s.passwords.Remember(ctx, user.ID, user.Password)
+	if err := s.tokens.Revoke(ctx, token.UserID, models.UserTokenPasswordReset); err != nil {
+		return err
+	}
+	if err := s.users.ResetLoginFailures(ctx, token.UserID); err != nil {
+		return err
+	}
+
+	s.logger.Ctx(ctx).Infow("Password reset")
+	return nil
+}
+
+// PurgeExpired удаляет истёкшие токены; вызывается планировщиком
+func (s *AccountService) PurgeExpired(ctx context.Context, now time.Time) error {
+	ctx, span := tracing.Start(ctx, "AccountService.PurgeExpired")
+	defer span.End()
+
+	purged, err := s.tokens.PurgeExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		s.logger.Ctx(ctx).Infow("Purged expired user tokens", "count", purged)
+	}
+	return nil
+}
+
+// findByLogin ищет по имени пользователя, а если логин похож на адрес — по почте
+func (s *AccountService) findByLogin(ctx context.Context, login string) (*models.User, error) {
+	user, err := s.users.GetByUsername(ctx, login)
+	if errors.Is(err, apperror.ErrUserNotFound) && strings.Contains(login, "@") {
+		return s.users.GetByEmail(ctx, login)
+	}
+	return user, err
+}
+
+// issue гасит прежние токены с тем же назначением и выпускает новый
+func (s *AccountService) issue(ctx context.Context, user *models.User, purpose string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := s.tokens.Revoke(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+	err := s.tokens.Create(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// send отправляет сообщение в фоне: клиент не ждёт почтовый сервер, а время
+// ответа ForgotPassword не выдаёт, нашёлся ли пользователь
+func (s *AccountService) send(ctx context.Context, msg *notify.Message) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	go func() {
+		defer cancel()
+		if err := s.notifier.Notify(ctx, msg); err != nil {
+			s.logger.Ctx(ctx).Errorw("Failed to send notification", "subject", msg.Subject, "error", err)
+		}
+	}()
+}
+
+// link — адрес страницы клиента с токеном или сам токен, если адрес не задан
+func link(base, token string) string {
+	if base == "" {
+		return token
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return token
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// ttlText — срок действия ссылки для текста письма: "48 ч." вместо "48h0m0s"
+func ttlText(ttl time.Duration) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		return fmt.Sprintf("%d ч.", int(ttl.Hours()))
+	}
+	return fmt.Sprintf("%d мин.", int(ttl.Round(time.Minute).Minutes()))
+}
+
+// hashToken: у токена 256 случайных бит, поэтому соль и медленный хеш не нужны
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,37 +2,68 @@ package service
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
 	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService struct {
-	userRepo repository.UserRepository
+	userRepo  repository.UserRepository
+	companies *CompanyService
+	tokens    *auth.Manager
+	lockout   models.LockoutPolicy
+	twoFactor *TwoFactorService
+	accounts  *AccountService
+	passwords *PasswordService
 }
 
-func NewAuthService(userRepo repository.UserRepository) *AuthService {
+func NewAuthService(userRepo repository.UserRepository, companies *CompanyService, tokens *auth.Manager, lockout models.LockoutPolicy, twoFactor *TwoFactorService, accounts *AccountService, passwords *PasswordService) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
+		userRepo:  userRepo,
+		companies: companies,
+		tokens:    tokens,
+		lockout:   lockout,
+		twoFactor: twoFactor,
+		accounts:  accounts,
+		passwords: passwords,
 	}
 }
 
 func (s *AuthService) Register(ctx context.Context, req *models.UserCreateRequest) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Register")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
 	// Хешируем пароль
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwords.Hash(ctx, nil, req.Password, "password")
 	if err != nil {
 		return nil, err
 	}
 
+	// Регистрация открыта всем, поэтому is_admin и is_active из запроса не
+	// принимаются: администраторов создаёт terminalctl или другой администратор
 	user := &models.User{
 		INN:         req.INN,
 		Username:    req.Username,
-		Password:    string(hashedPassword),
+		Password:    hashedPassword,
 		CompanyName: req.CompanyName, // Новое поле
-		IsActive:    req.IsActive,
-		IsAdmin:     req.IsAdmin,
+		IsActive:    true,
+		IsAdmin:     false,
+		Email:       req.Email,
+		Phone:       req.Phone,
+	}
+	if err := s.companies.CheckUser(ctx, user); err != nil {
+		return nil, err
 	}
 
 	// Сохраняем пользователя в базу данных
@@ -40,33 +71,186 @@ func (s *AuthService) Register(ctx context.Context, req *models.UserCreateReques
 	if err != nil {
 		return nil, err
 	}
-
-	// Не возвращаем хешированный пароль
-	user.Password = ""
+	s.accounts.StartVerification(ctx, user)
 
 	return user, nil
 }
 
 func (s *AuthService) Login(ctx context.Context, req *models.UserLoginRequest) (*models.UserLoginResponse, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Login")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
 	user, err := s.userRepo.GetByUsername(ctx, req.Username)
 	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, apperror.ErrInvalidCredentials
+		}
 		return nil, err
 	}
 
+	// Пока вход заблокирован, пароль не проверяем, чтобы его нельзя было подбирать
+	now := time.Now()
+	if locked(user.LockedUntil, now) {
+		return nil, apperror.ErrAccountLocked.WithRetryAfter(user.LockedUntil.Sub(now))
+	}
+
 	// Проверяем пароль
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
 	if err != nil {
+		return nil, s.loginFailed(ctx, user.ID, apperror.ErrInvalidCredentials.Wrap(err))
+	}
+
+	return s.afterPassword(ctx, user)
+}
+
+// afterPassword — следующий шаг входа после проверки пароля: смена пароля,
+// заданного администратором, затем второй фактор, затем токен доступа.
+// До выдачи токена счётчик неудач не сбрасывается: иначе знание пароля
+// позволило бы подбирать код без блокировки.
+func (s *AuthService) afterPassword(ctx context.Context, user *models.User) (*models.UserLoginResponse, error) {
+	if user.MustChangePassword {
+		return s.passwords.Challenge(user)
+	}
+	if s.twoFactor.Required(user) {
+		return s.twoFactor.Challenge(user)
+	}
+	return s.complete(ctx, user)
+}
+
+// ChangePassword меняет пароль текущего пользователя. С токеном смены пароля
+// (PasswordChangeRequired при входе) после смены вход продолжается: ответ —
+// следующий шаг или токен доступа. С обычным токеном ответ nil.
+func (s *AuthService) ChangePassword(ctx context.Context, req *models.ChangePasswordRequest) (*models.UserLoginResponse, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.ChangePassword")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok {
+		return nil, apperror.ErrUnauthenticated
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.VerifyPassword(ctx, user, req.CurrentPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwords.Hash(ctx, user, req.NewPassword, "new_password")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetPassword(ctx, user.ID, hashedPassword); err != nil {
+		return nil, err
+	}
+	s.passwords.Remember(ctx, user.ID, user.Password)
+
+	if claims.Purpose != auth.PurposePasswordChange {
+		return nil, nil
+	}
+	user.Password = hashedPassword
+	user.MustChangePassword = false
+	return s.afterPassword(ctx, user)
+}
+
+// LoginTwoFactor — второй шаг входа: код из приложения или код восстановления
+func (s *AuthService) LoginTwoFactor(ctx context.Context, req *models.LoginTwoFactorRequest) (*models.UserLoginResponse, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.LoginTwoFactor")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
+	claims, err := s.tokens.ValidateChallenge(req.ChallengeToken, auth.PurposeMFA)
+	if err != nil {
+		return nil, apperror.ErrInvalidChallenge.Wrap(err)
+	}
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return nil, apperror.ErrInvalidChallenge
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if locked(user.LockedUntil, now) {
+		return nil, apperror.ErrAccountLocked.WithRetryAfter(user.LockedUntil.Sub(now))
+	}
+
+	if err := s.twoFactor.Verify(ctx, user.ID, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, apperror.ErrInvalidTwoFactorCode) {
+			return nil, s.loginFailed(ctx, user.ID, err)
+		}
 		return nil, err
 	}
 
+	return s.complete(ctx, user)
+}
+
+// complete завершает вход: сбрасывает счётчик неудач и выдаёт токен доступа
+func (s *AuthService) complete(ctx context.Context, user *models.User) (*models.UserLoginResponse, error) {
+	if user.LockedUntil != nil || s.lockout.Threshold > 0 {
+		if err := s.userRepo.ResetLoginFailures(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.LockedUntil = nil
+	}
+
 	// Генерируем JWT токен
-	token, err := auth.GenerateToken(user.ID, user.Username, user.IsAdmin)
+	token, err := s.tokens.GenerateToken(user.ID, user.Username, user.IsAdmin)
 	if err != nil {
 		return nil, err
 	}
 
 	return &models.UserLoginResponse{
-		User:  *user,
+		User:  user,
 		Token: token,
 	}, nil
 }
+
+// loginFailed засчитывает неудачную попытку; если она исчерпала порог,
+// клиент сразу узнаёт о блокировке, иначе получает cause
+// VerifyPassword сверяет текущий пароль пользователя, который уже вошёл.
+// Его спрашивают и с действующим токеном там, где можно перехватить учётную
+// запись: украденный токен для этого не должен годиться. Неверный пароль
+// считается неудачным входом и ведёт к блокировке.
+func (s *AuthService) VerifyPassword(ctx context.Context, user *models.User, password string) error {
+	now := time.Now()
+	if locked(user.LockedUntil, now) {
+		return apperror.ErrAccountLocked.WithRetryAfter(user.LockedUntil.Sub(now))
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return s.loginFailed(ctx, user.ID, apperror.ErrWrongPassword.Wrap(err))
+	}
+	return nil
+}
+
+func (s *AuthService) loginFailed(ctx context.Context, userID int, cause error) error {
+	if s.lockout.Threshold <= 0 {
+		return cause
+	}
+
+	lockedUntil, err := s.userRepo.RecordLoginFailure(ctx, userID, s.lockout)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if locked(lockedUntil, now) {
+		return apperror.ErrAccountLocked.WithRetryAfter(lockedUntil.Sub(now))
+	}
+	return cause
+}
+
+func locked(until *time.Time, now time.Time) bool {
+	return until != nil && until.After(now)
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/registry"
+	"github.com/idkOybek/newNewTerminal/pkg/taxid"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+)
+
+var (
+	ErrCompanyNotFound         = apperror.NotFound("company_not_found", "company not found in registry")
+	ErrCompanyRegistryDisabled = apperror.NotFound("company_registry_disabled", "company registry is not configured")
+	// ErrCompanyMismatch — ИНН или название компании расходятся с реестром или с владельцем терминала
+	ErrCompanyMismatch = apperror.BindingViolation("company_mismatch", "company details are inconsistent")
+)
+
+// CompanyService сверяет ИНН и названия компаний пользователей с реестром,
+// а терминалов — с их владельцем
+type CompanyService struct {
+	registry registry.Registry
+	userRepo repository.UserRepository
+	mode     models.CompanyCheckMode
+	logger   *logger.Logger
+}
+
+// NewCompanyService: registry может быть nil, тогда сверка с реестром не выполняется
+func NewCompanyService(reg registry.Registry, userRepo repository.UserRepository, mode models.CompanyCheckMode, logger *logger.Logger) *CompanyService {
+	if mode == "" {
+		mode = models.CompanyCheckWarn
+	}
+	return &CompanyService{
+		registry: reg,
+		userRepo: userRepo,
+		mode:     mode,
+		logger:   logger,
+	}
+}
+
+func (s *CompanyService) Lookup(ctx context.Context, taxID string) (*models.Company, error) {
+	ctx, span := tracing.Start(ctx, "CompanyService.Lookup")
+	defer span.End()
+
+	if !taxid.Valid(taxID) {
+		return nil, apperror.Invalid("tax_id", "taxid", "tax_id must be a 9-digit INN or a 14-digit PINFL")
+	}
+	if s.registry == nil {
+		return nil, ErrCompanyRegistryDisabled
+	}
+
+	company, err := s.registry.Lookup(ctx, taxID)
+	if errors.Is(err, registry.ErrNotFound) {
+		return nil, ErrCompanyNotFound.Wrap(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("company registry lookup failed: %w", err)
+	}
+
+	return &models.Company{
+		TaxID:  company.TaxID,
+		Kind:   string(taxid.KindOf(company.TaxID)),
+		Name:   company.Name,
+		Active: company.Active,
+	}, nil
+}
+
+// CheckUser сверяет пользователя с реестром. Пустое название компании
+// заполняется из реестра. Недоступность реестра не мешает сохранению.
+func (s *CompanyService) CheckUser(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "CompanyService.CheckUser")
+	defer span.End()
+
+	if s.mode == models.CompanyCheckOff || s.registry == nil {
+		return nil
+	}
+
+	company, err := s.registry.Lookup(ctx, user.INN)
+	if err != nil && !errors.Is(err, registry.ErrNotFound) {
+		s.logger.Ctx(ctx).Warnw("Company registry lookup failed", "inn", user.INN, "error", err)
+		return nil
+	}
+
+	var details []models.ErrorDetail
+	switch {
+	case company == nil:
+		details = append(details, models.ErrorDetail{Field: "inn", Code: "not_registered", Message: "is not found in the company registry"})
+	case user.CompanyName == "":
+		user.CompanyName = company.Name
+	case !taxid.SameCompany(user.CompanyName, company.Name):
+		details = append(details, models.ErrorDetail{
+			Field:   "company_name",
+			Code:    "registry_mismatch",
+			Message: fmt.Sprintf("does not match the registry name %q", company.Name),
+		})
+	}
+	if company != nil && !company.Active {
+		details = append(details, models.ErrorDetail{Field: "inn", Code: "inactive_taxpayer", Message: "belongs to a liquidated taxpayer"})
+	}
+
+	return s.report(ctx, details, "user", user.ID)
+}
+
+// CheckTerminal сверяет ИНН и название компании терминала с владельцем.
+// Пустое название компании берётся у владельца.
+func (s *CompanyService) CheckTerminal(ctx context.Context, terminal *models.Terminal) error {
+	ctx, span := tracing.Start(ctx, "CompanyService.CheckTerminal")
+	defer span.End()
+
+	if s.mode == models.CompanyCheckOff {
+		return nil
+	}
+
+	owner, err := s.userRepo.GetByID(ctx, terminal.UserID)
+	if err != nil {
+		return err
+	}
+
+	if terminal.CompanyName == "" {
+		terminal.CompanyName = owner.CompanyName
+	}
+
+	var details []models.ErrorDetail
+	if terminal.INN != owner.INN {
+		details = append(details, models.ErrorDetail{
+			Field:   "inn",
+			Code:    "owner_mismatch",
+			Message: fmt.Sprintf("does not match the owner's INN %s", owner.INN),
+		})
+	}
+	if owner.CompanyName != "" && !taxid.SameCompany(terminal.CompanyName, owner.CompanyName) {
+		details = append(details, models.ErrorDetail{
+			Field:   "company_name",
+			Code:    "owner_mismatch",
+			Message: fmt.Sprintf("does not match the owner's company %q", owner.CompanyName),
+		})
+	}
+
+	return s.report(ctx, details, "terminal", terminal.ID)
+}
+
+// report в режиме warn только логирует расхождения, в strict — возвращает ошибку
+func (s *CompanyService) report(ctx context.Context, details []models.ErrorDetail, entity string, id int) error {
+	if len(details) == 0 {
+		return nil
+	}
+	if s.mode == models.CompanyCheckStrict {
+		return ErrCompanyMismatch.WithDetails(details...)
+	}
+	s.logger.Ctx(ctx).Warnw("Company details are inconsistent", "entity", entity, "id", id, "details", details)
+	return nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/pdf"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+)
+
+type DocumentService struct {
+	terminalRepo     repository.TerminalRepository
+	fiscalModuleRepo repository.FiscalModuleRepository
+	publicBaseURL    string
+	logger           *logger.Logger
+}
+
+func NewDocumentService(terminalRepo repository.TerminalRepository, fiscalModuleRepo repository.FiscalModuleRepository, publicBaseURL string, logger *logger.Logger) *DocumentService {
+	return &DocumentService{
+		terminalRepo:     terminalRepo,
+		fiscalModuleRepo: fiscalModuleRepo,
+		publicBaseURL:    strings.TrimSuffix(publicBaseURL, "/"),
+		logger:           logger,
+	}
+}
+
+// ActivationCertificate собирает данные акта активации фискального модуля на терминале
+func (s *DocumentService) ActivationCertificate(ctx context.Context, terminalID int) (*pdf.Certificate, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.ActivationCertificate")
+	defer span.End()
+
+	terminal, err := s.terminalRepo.GetByID(ctx, terminalID)
+	if err != nil {
+		return nil, err
+	}
+
+	module, err := s.fiscalModuleRepo.GetByFactoryNumber(ctx, terminal.CashRegisterNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fiscal module: %w", err)
+	}
+
+	certificate := &pdf.Certificate{
+		Number:             strconv.Itoa(terminal.ID),
+		CompanyName:        terminal.CompanyName,
+		INN:                terminal.INN,
+		Address:            terminal.Address,
+		AssemblyNumber:     terminal.AssemblyNumber,
+		CashRegisterNumber: terminal.CashRegisterNumber,
+		ModuleNumber:       terminal.ModuleNumber,
+		ActivatedAt:        terminal.CreatedAt,
+	}
+	if module != nil {
+		certificate.FiscalNumber = module.FiscalNumber
+	}
+	if s.publicBaseURL != "" {
+		certificate.StatusURL = fmt.Sprintf("%s/api/terminals/status/%d", s.publicBaseURL, terminal.ID)
+	}
+
+	return certificate, nil
+}
+
+// TerminalsTable собирает таблицу всех терминалов для PDF-отчёта
+func (s *DocumentService) TerminalsTable(ctx context.Context) (*pdf.Table, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.TerminalsTable")
+	defer span.End()
+
+	terminals, err := s.terminalRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list terminals: %w", err)
+	}
+
+	rows := make([]map[string]interface{}, 0, len(terminals))
+	for _, t := range terminals {
+		rows = append(rows, terminalReportRow(t))
+	}
+
+	return terminalsTable("Терминалы", rows, time.Now()), nil
+}
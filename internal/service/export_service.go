@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+	"github.com/idkOybek/newNewTerminal/pkg/xlsx"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	sheetTerminals     = "Терминалы"
+	sheetFiscalModules = "Фискальные модули"
+	sheetUsers         = "Пользователи"
+	sheetSummary       = "Сводка"
+)
+
+const defaultExportAuditLimit = 100
+
+type ExportService struct {
+	terminalRepo     repository.TerminalRepository
+	fiscalModuleRepo repository.FiscalModuleRepository
+	userRepo         repository.UserRepository
+	auditRepo        repository.ExportAuditRepository
+	logger           *logger.Logger
+}
+
+func NewExportService(terminalRepo repository.TerminalRepository, fiscalModuleRepo repository.FiscalModuleRepository, userRepo repository.UserRepository, auditRepo repository.ExportAuditRepository, logger *logger.Logger) *ExportService {
+	return &ExportService{
+		terminalRepo:     terminalRepo,
+		fiscalModuleRepo: fiscalModuleRepo,
+		userRepo:         userRepo,
+		auditRepo:        auditRepo,
+		logger:           logger,
+	}
+}
+
+// Audit записывает выгрузку в журнал до отдачи файла и возвращает отметку,
+// которую нужно напечатать в самом файле. Если пользователь не указан,
+// он берётся из контекста запроса.
+func (s *ExportService) Audit(ctx context.Context, entry *models.ExportAuditEntry) (string, error) {
+	ctx, span := tracing.Start(ctx, "ExportService.Audit")
+	defer span.End()
+
+	if entry.UserID == 0 {
+		if claims, ok := ctx.Value("user").(*auth.Claims); ok {
+			entry.UserID = claims.UserID
+			entry.Username = claims.Username
+		}
+	}
+
+	if err := s.auditRepo.Create(ctx, entry); err != nil {
+		return "", fmt.Errorf("failed to record export: %w", err)
+	}
+
+	s.logger.Ctx(ctx).Infow("Export recorded", "export_id", entry.ID, "user_id", entry.UserID,
+		"export_type", entry.ExportType, "row_count", entry.RowCount, "encrypted", entry.Encrypted)
+
+	return exportStamp(entry), nil
+}
+
+func (s *ExportService) ListAudit(ctx context.Context, limit int) ([]*models.ExportAuditEntry, error) {
+	ctx, span := tracing.Start(ctx, "ExportService.ListAudit")
+	defer span.End()
+
+	if limit <= 0 {
+		limit = defaultExportAuditLimit
+	}
+	return s.auditRepo.List(ctx, limit)
+}
+
+func exportStamp(entry *models.ExportAuditEntry) string {
+	return fmt.Sprintf("Выгрузка №%d · %s · %s", entry.ID, entry.Username,
+		entry.CreatedAt.Format("02.01.2006 15:04:05 MST"))
+}
+
+// FleetWorkbook собирает книгу для ежемесячной сверки: терминалы, фискальные
+// модули, пользователи и сводный лист с формулами по компаниям и статусам.
+// Вторым значением возвращается общее число выгруженных строк.
+func (s *ExportService) FleetWorkbook(ctx context.Context) (*excelize.File, int, error) {
+	ctx, span := tracing.Start(ctx, "ExportService.FleetWorkbook")
+	defer span.End()
+
+	terminals, err := s.terminalRepo.List(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list terminals: %w", err)
+	}
+	modules, err := s.fiscalModuleRepo.List(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list fiscal modules: %w", err)
+	}
+	users, err := s.userRepo.List(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	rowCount := len(terminals) + len(modules) + len(users)
+
+	wb := xlsx.NewWorkbook()
+
+	terminalRows := make([]map[string]interface{}, 0, len(terminals))
+	companies := make(map[string]bool)
+	for _, t := range terminals {
+		terminalRows = append(terminalRows, terminalReportRow(t))
+		companies[t.CompanyName] = true
+	}
+	err = wb.AddSheet(&xlsx.Sheet{
+		Name:    sheetTerminals,
+		Columns: columns(terminalReportColumns...),
+		Rows:    terminalRows,
+		Links: map[string]xlsx.Link{
+			"cash_register_number": {Sheet: sheetFiscalModules, Key: "factory_number"},
+			"module_number":        {Sheet: sheetFiscalModules, Key: "fiscal_number"},
+			"user_id":              {Sheet: sheetUsers, Key: "id"},
+		},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	moduleRows := make([]map[string]interface{}, 0, len(modules))
+	for _, m := range modules {
+		moduleRows = append(moduleRows, map[string]interface{}{
+			"id":             m.ID,
+			"fiscal_number":  m.FiscalNumber,
+			"factory_number": m.FactoryNumber,
+			"user_id":        m.UserID,
+			"is_active":      m.IsActive,
+			"created_at":     formatReportTime(m.CreatedAt),
+		})
+	}
+	err = wb.AddSheet(&xlsx.Sheet{
+		Name:    sheetFiscalModules,
+		Columns: columns("id", "fiscal_number", "factory_number", "is_active", "user_id", "created_at"),
+		Rows:    moduleRows,
+		Links: map[string]xlsx.Link{
+			"factory_number": {Sheet: sheetTerminals, Key: "cash_register_number"},
+			"user_id":        {Sheet: sheetUsers, Key: "id"},
+		},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	userRows := make([]map[string]interface{}, 0, len(users))
+	for _, u := range users {
+		userRows = append(userRows, map[string]interface{}{
+			"id":           u.ID,
+			"username":     u.Username,
+			"inn":          u.INN,
+			"company_name": u.CompanyName,
+			"is_active":    u.IsActive,
+			"is_admin":     u.IsAdmin,
+			"created_at":   formatReportTime(u.CreatedAt),
+		})
+	}
+	err = wb.AddSheet(&xlsx.Sheet{
+		Name:    sheetUsers,
+		Columns: columns("id", "username", "inn", "company_name", "is_active", "is_admin", "created_at"),
+		Rows:    userRows,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	summaryRows, err := summaryRows(wb, companies)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = wb.AddSheet(&xlsx.Sheet{
+		Name: sheetSummary,
+		Columns: []xlsx.Column{
+			{Key: "company_name", Width: 40},
+			{Key: "total", Title: "Всего"},
+			{Key: "active", Title: "Активных"},
+			{Key: "inactive", Title: "Неактивных"},
+			{Key: "free_record_balance", Width: 20},
+		},
+		Rows: summaryRows,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := wb.Build()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return f, rowCount, nil
+}
+
+func summaryRows(wb *xlsx.Workbook, companies map[string]bool) ([]map[string]interface{}, error) {
+	companyRange, err := wb.ColumnRange(sheetTerminals, "company_name")
+	if err != nil {
+		return nil, err
+	}
+	activeRange, err := wb.ColumnRange(sheetTerminals, "is_active")
+	if err != nil {
+		return nil, err
+	}
+	balanceRange, err := wb.ColumnRange(sheetTerminals, "free_record_balance")
+	if err != nil {
+		return nil, err
+	}
+	moduleActiveRange, err := wb.ColumnRange(sheetFiscalModules, "is_active")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(companies))
+	for name := range companies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := make([]map[string]interface{}, 0, len(names)+3)
+	for i, name := range names {
+		// Строка 1 — заголовки, поэтому компания i находится в строке i+2
+		cell := fmt.Sprintf("$A%d", i+2)
+		rows = append(rows, map[string]interface{}{
+			"company_name":        name,
+			"total":               xlsx.Formula(fmt.Sprintf("COUNTIF(%s,%s)", companyRange, cell)),
+			"active":              xlsx.Formula(fmt.Sprintf("COUNTIFS(%s,%s,%s,TRUE)", companyRange, cell, activeRange)),
+			"inactive":            xlsx.Formula(fmt.Sprintf("COUNTIFS(%s,%s,%s,FALSE)", companyRange, cell, activeRange)),
+			"free_record_balance": xlsx.Formula(fmt.Sprintf("SUMIF(%s,%s,%s)", companyRange, cell, balanceRange)),
+		})
+	}
+
+	totals := map[string]interface{}{
+		"company_name":        "Итого по терминалам",
+		"total":               0,
+		"active":              0,
+		"inactive":            0,
+		"free_record_balance": 0,
+	}
+	if last := len(names) + 1; len(names) > 0 {
+		totals["total"] = xlsx.Formula(fmt.Sprintf("SUM(B2:B%d)", last))
+		totals["active"] = xlsx.Formula(fmt.Sprintf("SUM(C2:C%d)", last))
+		totals["inactive"] = xlsx.Formula(fmt.Sprintf("SUM(D2:D%d)", last))
+		totals["free_record_balance"] = xlsx.Formula(fmt.Sprintf("SUM(E2:E%d)", last))
+	}
+
+	rows = append(rows, totals,
+		map[string]interface{}{
+			"company_name": "Фискальные модули",
+			"total":        xlsx.Formula(fmt.Sprintf("COUNTA(%s)", moduleActiveRange)),
+			"active":       xlsx.Formula(fmt.Sprintf("COUNTIF(%s,TRUE)", moduleActiveRange)),
+			"inactive":     xlsx.Formula(fmt.Sprintf("COUNTIF(%s,FALSE)", moduleActiveRange)),
+		},
+	)
+
+	return rows, nil
+}
+
+func columns(keys ...string) []xlsx.Column {
+	result := make([]xlsx.Column, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, xlsx.Column{Key: key})
+	}
+	return result
+}
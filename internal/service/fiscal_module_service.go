@@ -2,13 +2,19 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
 )
 
+var ErrFiscalModuleInUse = apperror.Conflict("fiscal_module_in_use", "fiscal module is bound to a terminal")
+
 type FiscalModuleService struct {
 	repo   repository.FiscalModuleRepository
 	logger *logger.Logger
@@ -21,6 +27,13 @@ func NewFiscalModuleService(repo repository.FiscalModuleRepository, logger *logg
 	}
 }
 func (s *FiscalModuleService) Create(ctx context.Context, req *models.FiscalModuleCreateRequest) (*models.FiscalModuleResponse, error) {
+	ctx, span := tracing.Start(ctx, "FiscalModuleService.Create")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
 	module := &models.FiscalModule{
 		FiscalNumber:  req.FiscalNumber,
 		FactoryNumber: req.FactoryNumber,
@@ -39,10 +52,14 @@ func (s *FiscalModuleService) Create(ctx context.Context, req *models.FiscalModu
 		FactoryNumber: module.FactoryNumber,
 		UserID:        module.UserID,
 		IsActive:      module.IsActive,
+		Version:       module.Version,
 	}, nil
 }
 
 func (s *FiscalModuleService) GetByID(ctx context.Context, id int) (*models.FiscalModuleResponse, error) {
+	ctx, span := tracing.Start(ctx, "FiscalModuleService.GetByID")
+	defer span.End()
+
 	module, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
@@ -53,14 +70,25 @@ func (s *FiscalModuleService) GetByID(ctx context.Context, id int) (*models.Fisc
 		FiscalNumber:  module.FiscalNumber,
 		FactoryNumber: module.FactoryNumber,
 		UserID:        module.UserID,
+		Version:       module.Version,
 	}, nil
 }
 
 func (s *FiscalModuleService) Update(ctx context.Context, id int, req *models.FiscalModuleUpdateRequest) (*models.FiscalModule, error) {
+	ctx, span := tracing.Start(ctx, "FiscalModuleService.Update")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
 	module, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkVersion(req.Version, module.Version); err != nil {
+		return nil, err
+	}
 
 	if req.FiscalNumber != nil {
 		module.FiscalNumber = *req.FiscalNumber
@@ -84,10 +112,30 @@ func (s *FiscalModuleService) Update(ctx context.Context, id int, req *models.Fi
 }
 
 func (s *FiscalModuleService) Delete(ctx context.Context, id int) error {
-	return s.repo.Delete(ctx, id)
+	ctx, span := tracing.Start(ctx, "FiscalModuleService.Delete")
+	defer span.End()
+
+	err := s.repo.Delete(ctx, id)
+	if errors.Is(err, apperror.ErrFiscalModuleNotFound) {
+		// Модуль существует, но к нему ещё привязан терминал
+		if _, getErr := s.repo.GetByID(ctx, id); getErr == nil {
+			return ErrFiscalModuleInUse
+		}
+	}
+	return err
+}
+
+func (s *FiscalModuleService) Restore(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "FiscalModuleService.Restore")
+	defer span.End()
+
+	return s.repo.Restore(ctx, id)
 }
 
 func (s *FiscalModuleService) List(ctx context.Context) ([]*models.FiscalModuleResponse, error) {
+	ctx, span := tracing.Start(ctx, "FiscalModuleService.List")
+	defer span.End()
+
 	modules, err := s.repo.List(ctx)
 	if err != nil {
 		return nil, err
@@ -101,6 +149,7 @@ func (s *FiscalModuleService) List(ctx context.Context) ([]*models.FiscalModuleR
 			FactoryNumber: module.FactoryNumber,
 			UserID:        module.UserID,
 			IsActive:      module.IsActive,
+			Version:       module.Version,
 		})
 	}
 
@@ -108,27 +157,50 @@ func (s *FiscalModuleService) List(ctx context.Context) ([]*models.FiscalModuleR
 }
 
 func (s *FiscalModuleService) Activate(ctx context.Context, id int) error {
-	s.logger.Info("Starting fiscal module activation", "id", id)
+	ctx, span := tracing.Start(ctx, "FiscalModuleService.Activate")
+	defer span.End()
+
+	s.logger.Ctx(ctx).Infow("Starting fiscal module activation", "id", id)
 
 	module, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		s.logger.Error("Failed to get fiscal module", "id", id, "error", err)
+		s.logger.Ctx(ctx).Errorw("Failed to get fiscal module", "id", id, "error", err)
 		return fmt.Errorf("failed to get fiscal module: %w", err)
 	}
-	s.logger.Info("Fiscal module retrieved", "id", id, "current_status", module.IsActive)
+	s.logger.Ctx(ctx).Infow("Fiscal module retrieved", "id", id, "current_status", module.IsActive)
 
 	if !module.IsActive {
 		module.IsActive = true
-		s.logger.Info("Updating fiscal module status", "id", id, "new_status", true)
+		s.logger.Ctx(ctx).Infow("Updating fiscal module status", "id", id, "new_status", true)
 		err = s.repo.Update(ctx, module)
 		if err != nil {
-			s.logger.Error("Failed to update fiscal module", "id", id, "error", err)
+			s.logger.Ctx(ctx).Errorw("Failed to update fiscal module", "id", id, "error", err)
 			return fmt.Errorf("failed to update fiscal module: %w", err)
 		}
-		s.logger.Info("Fiscal module activated successfully", "id", id)
+		s.logger.Ctx(ctx).Infow("Fiscal module activated successfully", "id", id)
 	} else {
-		s.logger.Info("Fiscal module already active", "id", id)
+		s.logger.Ctx(ctx).Infow("Fiscal module already active", "id", id)
 	}
 
 	return nil
 }
+
+func (s *FiscalModuleService) Deactivate(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "FiscalModuleService.Deactivate")
+	defer span.End()
+
+	module, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get fiscal module: %w", err)
+	}
+	if !module.IsActive {
+		return nil
+	}
+
+	module.IsActive = false
+	if err := s.repo.Update(ctx, module); err != nil {
+		return fmt.Errorf("failed to update fiscal module: %w", err)
+	}
+	s.logger.Ctx(ctx).Infow("Fiscal module deactivated", "id", id)
+	return nil
+}
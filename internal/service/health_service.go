@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/buildinfo"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+)
+
+// readyTimeout ограничивает проверки /readyz, чтобы зависшая БД не держала пробу
+const readyTimeout = 2 * time.Second
+
+// Pinger — *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// SchemaVersioner — *migrate.Migrator
+type SchemaVersioner interface {
+	Version(ctx context.Context) (int64, bool, error)
+	Latest() int64
+}
+
+// HealthService отвечает оркестратору, жив ли процесс и готов ли он принимать трафик
+type HealthService struct {
+	db       Pinger
+	schema   SchemaVersioner
+	draining atomic.Bool
+	logger   *logger.Logger
+}
+
+func NewHealthService(db Pinger, schema SchemaVersioner, logger *logger.Logger) *HealthService {
+	return &HealthService{
+		db:     db,
+		schema: schema,
+		logger: logger,
+	}
+}
+
+// Drain переводит /readyz в 503 перед остановкой сервера, чтобы балансировщик
+// успел убрать экземпляр из ротации. Отменить нельзя.
+func (s *HealthService) Drain() {
+	s.draining.Store(true)
+}
+
+// Ready проверяет соединение с БД и версию схемы. Схема новее встроенных
+// миграций готовности не мешает: так бывает при откате сервера после миграции.
+func (s *HealthService) Ready(ctx context.Context) *models.HealthResponse {
+	ctx, span := tracing.Start(ctx, "HealthService.Ready")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	checks := make(map[string]models.HealthCheck)
+	if s.draining.Load() {
+		checks["shutdown"] = unavailable(errors.New("server is shutting down"))
+	}
+
+	// Причину недоступности БД не отдаём наружу: /readyz открыт без авторизации
+	if err := s.db.PingContext(ctx); err != nil {
+		s.logger.Ctx(ctx).Warnw("Readiness check failed", "check", "database", "error", err)
+		checks["database"] = unavailable(errors.New("database is unreachable"))
+	} else {
+		checks["database"] = models.HealthCheck{Status: models.HealthStatusOK}
+		checks["schema"] = s.checkSchema(ctx)
+	}
+
+	response := &models.HealthResponse{Status: models.HealthStatusOK, Checks: checks}
+	for _, check := range checks {
+		if check.Status != models.HealthStatusOK {
+			response.Status = models.HealthStatusUnavailable
+		}
+	}
+	return response
+}
+
+func (s *HealthService) checkSchema(ctx context.Context) models.HealthCheck {
+	version, dirty, err := s.schema.Version(ctx)
+	switch {
+	case err != nil:
+		s.logger.Ctx(ctx).Warnw("Readiness check failed", "check", "schema", "error", err)
+		return unavailable(errors.New("failed to read schema version"))
+	case dirty:
+		return unavailable(fmt.Errorf("schema is dirty at version %d", version))
+	case version < s.schema.Latest():
+		return unavailable(fmt.Errorf("schema version %d is behind %d", version, s.schema.Latest()))
+	}
+	return models.HealthCheck{Status: models.HealthStatusOK}
+}
+
+// Version: если БД недоступна, версия схемы не заполняется, но ответ всё равно отдаётся
+func (s *HealthService) Version(ctx context.Context) *models.VersionInfo {
+	ctx, span := tracing.Start(ctx, "HealthService.Version")
+	defer span.End()
+
+	build := buildinfo.Get()
+	info := &models.VersionInfo{
+		Commit:              build.Commit,
+		BuildTime:           build.BuildTime,
+		GoVersion:           build.GoVersion,
+		Modified:            build.Modified,
+		LatestSchemaVersion: s.schema.Latest(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	if version, dirty, err := s.schema.Version(ctx); err == nil {
+		info.SchemaVersion = &version
+		info.SchemaDirty = dirty
+	}
+	return info
+}
+
+func unavailable(err error) models.HealthCheck {
+	return models.HealthCheck{Status: models.HealthStatusUnavailable, Error: err.Error()}
+}
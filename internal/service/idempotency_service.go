@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+)
+
+var (
+	ErrIdempotencyKeyReused     = apperror.Conflict("idempotency_key_reused", "idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = apperror.Conflict("idempotency_key_in_progress", "a request with this idempotency key is still being processed")
+)
+
+// IdempotencyService хранит ответы на POST-запросы с заголовком Idempotency-Key,
+// чтобы повтор после обрыва связи не выполнял запрос второй раз
+type IdempotencyService struct {
+	repo   repository.IdempotencyRepository
+	ttl    time.Duration
+	logger *logger.Logger
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepository, ttl time.Duration, logger *logger.Logger) *IdempotencyService {
+	return &IdempotencyService{
+		repo:   repo,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// Enabled сообщает, задан ли срок хранения ответов
+func (s *IdempotencyService) Enabled() bool {
+	return s.ttl > 0
+}
+
+// Begin занимает ключ под запрос. Если запрос с этим ключом уже выполнен,
+// возвращает сохранённый ответ; nil означает, что запрос нужно выполнить.
+func (s *IdempotencyService) Begin(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Begin")
+	defer span.End()
+
+	record.ExpiresAt = time.Now().Add(s.ttl)
+
+	existing, err := s.repo.Reserve(ctx, record)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+
+	if existing.Method != record.Method || existing.Path != record.Path || existing.RequestHash != record.RequestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if existing.StatusCode == 0 {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return existing, nil
+}
+
+func (s *IdempotencyService) Complete(ctx context.Context, record *models.IdempotencyRecord) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Complete")
+	defer span.End()
+
+	return s.repo.Complete(ctx, record)
+}
+
+func (s *IdempotencyService) Release(ctx context.Context, scope, key string) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Release")
+	defer span.End()
+
+	return s.repo.Release(ctx, scope, key)
+}
+
+// PurgeExpired удаляет истёкшие ключи; вызывается планировщиком
+func (s *IdempotencyService) PurgeExpired(ctx context.Context, now time.Time) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.PurgeExpired")
+	defer span.End()
+
+	purged, err := s.repo.PurgeExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		s.logger.Ctx(ctx).Infow("Purged expired idempotency keys", "count", purged)
+	}
+	return nil
+}
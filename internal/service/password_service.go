@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/password"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordBytes — предел bcrypt; длиннее bcrypt.GenerateFromPassword не хеширует
+const maxPasswordBytes = 72
+
+// PasswordService проверяет новые пароли по политике и хеширует их.
+// Все места, где задаётся пароль, проходят через Hash.
+type PasswordService struct {
+	users    repository.UserRepository
+	tokens   *auth.Manager
+	policy   models.PasswordPolicy
+	classes  []password.Class
+	breached *password.List
+	logger   *logger.Logger
+}
+
+// NewPasswordService: breached — список утёкших паролей, nil — без проверки
+func NewPasswordService(users repository.UserRepository, tokens *auth.Manager, policy models.PasswordPolicy, breached *password.List, logger *logger.Logger) *PasswordService {
+	classes := make([]password.Class, 0, len(policy.RequiredClasses))
+	for _, c := range policy.RequiredClasses {
+		classes = append(classes, password.Class(c))
+	}
+	return &PasswordService{
+		users:    users,
+		tokens:   tokens,
+		policy:   policy,
+		classes:  classes,
+		breached: breached,
+		logger:   logger,
+	}
+}
+
+// Check проверяет длину, классы символов и список утёкших паролей; field —
+// имя поля запроса для деталей ошибки
+func (s *PasswordService) Check(pw, field string) error {
+	var details []models.ErrorDetail
+	if utf8.RuneCountInString(pw) < s.policy.MinLength {
+		details = append(details, models.ErrorDetail{Field: field, Code: "password_too_short",
+			Message: fmt.Sprintf("must be at least %d characters long", s.policy.MinLength)})
+	}
+	if len(pw) > maxPasswordBytes {
+		details = append(details, models.ErrorDetail{Field: field, Code: "password_too_long",
+			Message: fmt.Sprintf("must be at most %d bytes long", maxPasswordBytes)})
+	}
+	if missing := password.Missing(pw, s.classes); len(missing) > 0 {
+		details = append(details, models.ErrorDetail{Field: field, Code: "password_too_simple",
+			Message: "must contain " + password.Describe(missing)})
+	}
+	if s.breached.Contains(pw) {
+		details = append(details, models.ErrorDetail{Field: field, Code: "password_breached",
+			Message: "appears in a list of leaked passwords; choose another one"})
+	}
+	if len(details) > 0 {
+		return apperror.Validation(apperror.CodeValidationFailed, "password does not meet the password policy", details...)
+	}
+	return nil
+}
+
+// Hash проверяет пароль и возвращает его bcrypt-хеш. Для существующего
+// пользователя пароль не должен совпадать с текущим и последними прежними.
+func (s *PasswordService) Hash(ctx context.Context, user *models.User, pw, field string) (string, error) {
+	ctx, span := tracing.Start(ctx, "PasswordService.Hash")
+	defer span.End()
+
+	if err := s.Check(pw, field); err != nil {
+		return "", err
+	}
+	if user != nil && s.policy.History > 0 {
+		reused, err := s.reused(ctx, user, pw)
+		if err != nil {
+			return "", err
+		}
+		if reused {
+			return "", apperror.Invalid(field, "password_reused",
+				fmt.Sprintf("must differ from the last %d passwords", s.policy.History))
+		}
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Remember кладёт сменённый хеш в историю. Пароль к этому моменту уже
+// сохранён, поэтому сбой только логируется.
+func (s *PasswordService) Remember(ctx context.Context, userID int, oldHash string) {
+	if s.policy.History <= 1 || oldHash == "" {
+		return
+	}
+	if err := s.users.AddPasswordHistory(ctx, userID, oldHash, s.policy.History-1); err != nil {
+		s.logger.Ctx(ctx).Errorw("Failed to record password history", "user_id", userID, "error", err)
+	}
+}
+
+// Challenge выдаёт токен, с которым при входе можно только сменить пароль
+func (s *PasswordService) Challenge(user *models.User) (*models.UserLoginResponse, error) {
+	token, err := s.tokens.GenerateChallenge(user.ID, user.Username, user.IsAdmin, auth.PurposePasswordChange, s.policy.ChangeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &models.UserLoginResponse{
+		PasswordChangeRequired: true,
+		ChallengeToken:         token,
+	}, nil
+}
+
+// reused сравнивает пароль с текущим хешем и History-1 прежними
+func (s *PasswordService) reused(ctx context.Context, user *models.User, pw string) (bool, error) {
+	hashes := []string{user.Password}
+	if s.policy.History > 1 {
+		previous, err := s.users.PasswordHistory(ctx, user.ID, s.policy.History-1)
+		if err != nil {
+			return false, err
+		}
+		hashes = append(hashes, previous...)
+	}
+
+	for _, hash := range hashes {
+		if hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,539 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/csv"
+	"github.com/idkOybek/newNewTerminal/pkg/delivery"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/pdf"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+	"github.com/idkOybek/newNewTerminal/pkg/xlsx"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultInactiveDays         = 7
+	defaultMaxFreeRecordBalance = 100
+)
+
+var (
+	ErrReportScheduleNotFound = apperror.ErrReportScheduleNotFound
+	ErrWebhookForbidden       = apperror.Forbidden("admin_required", "only admins can deliver reports to a webhook")
+)
+
+type ReportService struct {
+	repo          repository.ReportRepository
+	terminalRepo  repository.TerminalRepository
+	userRepo      repository.UserRepository
+	exportService *ExportService
+	deliverers    map[string]delivery.Deliverer
+	logger        *logger.Logger
+}
+
+func NewReportService(repo repository.ReportRepository, terminalRepo repository.TerminalRepository, userRepo repository.UserRepository, exportService *ExportService, deliverers map[string]delivery.Deliverer, logger *logger.Logger) *ReportService {
+	return &ReportService{
+		repo:          repo,
+		terminalRepo:  terminalRepo,
+		userRepo:      userRepo,
+		exportService: exportService,
+		deliverers:    deliverers,
+		logger:        logger,
+	}
+}
+
+func (s *ReportService) CreateSchedule(ctx context.Context, req *models.ReportScheduleCreateRequest) (*models.ReportSchedule, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.CreateSchedule")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok {
+		return nil, apperror.ErrUnauthenticated
+	}
+
+	schedule := &models.ReportSchedule{
+		UserID:         claims.UserID,
+		Name:           req.Name,
+		ReportType:     req.ReportType,
+		CronExpr:       req.CronExpr,
+		Filters:        req.Filters,
+		Format:         req.Format,
+		DeliveryType:   req.DeliveryType,
+		DeliveryTarget: req.DeliveryTarget,
+		IsActive:       req.IsActive,
+		FilePassword:   req.FilePassword,
+	}
+	if schedule.Format == "" {
+		schedule.Format = models.ReportFormatXLSX
+	}
+	if schedule.DeliveryType == models.DeliveryTypeWebhook && !claims.IsAdmin {
+		return nil, ErrWebhookForbidden
+	}
+	if err := s.prepareSchedule(schedule, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateSchedule(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (s *ReportService) GetSchedule(ctx context.Context, id int) (*models.ReportSchedule, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.GetSchedule")
+	defer span.End()
+
+	schedule, err := s.repo.GetScheduleByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok || (!claims.IsAdmin && claims.UserID != schedule.UserID) {
+		return nil, ErrReportScheduleNotFound
+	}
+
+	return schedule, nil
+}
+
+func (s *ReportService) UpdateSchedule(ctx context.Context, id int, req *models.ReportScheduleUpdateRequest) (*models.ReportSchedule, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.UpdateSchedule")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
+	schedule, err := s.GetSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(req.Version, schedule.Version); err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		schedule.Name = *req.Name
+	}
+	if req.ReportType != nil {
+		schedule.ReportType = *req.ReportType
+	}
+	if req.CronExpr != nil {
+		schedule.CronExpr = *req.CronExpr
+	}
+	if req.Filters != nil {
+		schedule.Filters = *req.Filters
+	}
+	if req.Format != nil {
+		schedule.Format = *req.Format
+	}
+	if req.DeliveryType != nil {
+		schedule.DeliveryType = *req.DeliveryType
+	}
+	if req.DeliveryTarget != nil {
+		schedule.DeliveryTarget = *req.DeliveryTarget
+	}
+	if req.IsActive != nil {
+		schedule.IsActive = *req.IsActive
+	}
+	if req.FilePassword != nil {
+		schedule.FilePassword = *req.FilePassword
+	}
+
+	// адрес вебхука задаёт только администратор, иначе пользователь мог бы
+	// направить запросы сервера во внутреннюю сеть
+	if (req.DeliveryType != nil || req.DeliveryTarget != nil) && schedule.DeliveryType == models.DeliveryTypeWebhook {
+		if claims, ok := ctx.Value("user").(*auth.Claims); !ok || !claims.IsAdmin {
+			return nil, ErrWebhookForbidden
+		}
+	}
+
+	if err := s.prepareSchedule(schedule, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateSchedule(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (s *ReportService) DeleteSchedule(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "ReportService.DeleteSchedule")
+	defer span.End()
+
+	if _, err := s.GetSchedule(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteSchedule(ctx, id)
+}
+
+func (s *ReportService) ListSchedules(ctx context.Context) ([]*models.ReportSchedule, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.ListSchedules")
+	defer span.End()
+
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok {
+		return nil, apperror.ErrUnauthenticated
+	}
+
+	userID := claims.UserID
+	if claims.IsAdmin {
+		userID = 0
+	}
+	return s.repo.ListSchedules(ctx, userID)
+}
+
+func (s *ReportService) ListRuns(ctx context.Context, id int) ([]*models.ReportRun, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.ListRuns")
+	defer span.End()
+
+	if _, err := s.GetSchedule(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListRuns(ctx, id)
+}
+
+// RunNow запускает отчёт вне расписания, не сдвигая next_run_at
+func (s *ReportService) RunNow(ctx context.Context, id int) (*models.ReportRun, error) {
+	ctx, span := tracing.Start(ctx, "ReportService.RunNow")
+	defer span.End()
+
+	schedule, err := s.GetSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.run(ctx, schedule)
+}
+
+// RunDue запускает все расписания, время которых наступило. Вызывается планировщиком.
+func (s *ReportService) RunDue(ctx context.Context, now time.Time) error {
+	ctx, span := tracing.Start(ctx, "ReportService.RunDue")
+	defer span.End()
+
+	schedules, err := s.repo.ListDueSchedules(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to list due report schedules: %w", err)
+	}
+
+	for _, schedule := range schedules {
+		sched, err := cron.ParseStandard(schedule.CronExpr)
+		if err != nil {
+			s.logger.Ctx(ctx).Errorw("Invalid cron expression in report schedule", "schedule_id", schedule.ID, "error", err)
+			continue
+		}
+
+		claimed, err := s.repo.ClaimSchedule(ctx, schedule.ID, *schedule.NextRunAt, now, sched.Next(now))
+		if err != nil {
+			s.logger.Ctx(ctx).Errorw("Failed to claim report schedule", "schedule_id", schedule.ID, "error", err)
+			continue
+		}
+		if !claimed {
+			// Расписание уже забрала другая реплика
+			continue
+		}
+
+		if _, err := s.run(ctx, schedule); err != nil {
+			s.logger.Ctx(ctx).Errorw("Scheduled report failed", "schedule_id", schedule.ID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ReportService) run(ctx context.Context, schedule *models.ReportSchedule) (*models.ReportRun, error) {
+	run := &models.ReportRun{
+		ScheduleID: schedule.ID,
+		Status:     models.ReportRunStatusRunning,
+	}
+	if err := s.repo.CreateRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to create report run: %w", err)
+	}
+
+	s.logger.Ctx(ctx).Infow("Running report", "schedule_id", schedule.ID, "run_id", run.ID, "report_type", schedule.ReportType)
+
+	location, rowCount, runErr := s.generateAndDeliver(ctx, schedule)
+	run.RowCount = rowCount
+	run.Location = location
+	run.Status = models.ReportRunStatusSuccess
+	if runErr != nil {
+		run.Status = models.ReportRunStatusFailed
+		run.Error = runErr.Error()
+	}
+
+	if err := s.repo.FinishRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to save report run: %w", err)
+	}
+
+	s.logger.Ctx(ctx).Infow("Report run finished", "schedule_id", schedule.ID, "run_id", run.ID,
+		"status", run.Status, "row_count", run.RowCount)
+
+	return run, runErr
+}
+
+func (s *ReportService) generateAndDeliver(ctx context.Context, schedule *models.ReportSchedule) (string, int, error) {
+	deliverer, ok := s.deliverers[schedule.DeliveryType]
+	if !ok {
+		return "", 0, fmt.Errorf("delivery type %q is not configured", schedule.DeliveryType)
+	}
+
+	owner, err := s.userRepo.GetByID(ctx, schedule.UserID)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get schedule owner: %w", err)
+	}
+
+	rows, err := s.buildRows(ctx, schedule, owner)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(rows) == 0 {
+		s.logger.Ctx(ctx).Infow("Report is empty, nothing to deliver", "schedule_id", schedule.ID)
+		return "", 0, nil
+	}
+
+	filters, err := json.Marshal(schedule.Filters)
+	if err != nil {
+		return "", len(rows), err
+	}
+
+	now := time.Now()
+	entry := &models.ExportAuditEntry{
+		UserID:     owner.ID,
+		Username:   owner.Username,
+		ExportType: models.ExportTypeScheduled,
+		Format:     schedule.Format,
+		Filename:   reportFileName(schedule, now),
+		RowCount:   len(rows),
+		Filters:    filters,
+		Encrypted:  schedule.FilePassword != "",
+		RemoteAddr: "scheduler",
+	}
+	stamp, err := s.exportService.Audit(ctx, entry)
+	if err != nil {
+		return "", len(rows), err
+	}
+
+	file, err := renderReport(schedule, rows, now, stamp)
+	if err != nil {
+		return "", len(rows), err
+	}
+
+	location, err := deliverer.Deliver(ctx, schedule.DeliveryTarget, file)
+	if err != nil {
+		return "", len(rows), err
+	}
+
+	return location, len(rows), nil
+}
+
+func (s *ReportService) buildRows(ctx context.Context, schedule *models.ReportSchedule, owner *models.User) ([]map[string]interface{}, error) {
+	filters := schedule.Filters
+
+	// Пользователь без прав администратора видит в отчётах только свои терминалы
+	if !owner.IsAdmin {
+		filters.UserID = &owner.ID
+	}
+
+	terminals, err := s.terminalRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list terminals: %w", err)
+	}
+
+	inactiveDays := defaultInactiveDays
+	if filters.InactiveDays != nil {
+		inactiveDays = *filters.InactiveDays
+	}
+	staleBefore := time.Now().AddDate(0, 0, -inactiveDays)
+
+	maxBalance := defaultMaxFreeRecordBalance
+	if filters.MaxFreeRecordBalance != nil {
+		maxBalance = *filters.MaxFreeRecordBalance
+	}
+
+	var rows []map[string]interface{}
+	for _, t := range terminals {
+		if filters.UserID != nil && t.UserID != *filters.UserID {
+			continue
+		}
+		if filters.CompanyName != "" && !strings.Contains(strings.ToLower(t.CompanyName), strings.ToLower(filters.CompanyName)) {
+			continue
+		}
+		if filters.IsActive != nil && t.IsActive != *filters.IsActive {
+			continue
+		}
+
+		switch schedule.ReportType {
+		case models.ReportTypeInactiveTerminals:
+			if t.IsActive && t.LastRequestDate.After(staleBefore) {
+				continue
+			}
+		case models.ReportTypeLowBalance:
+			if t.FreeRecordBalance > maxBalance {
+				continue
+			}
+		}
+
+		rows = append(rows, terminalReportRow(t))
+	}
+
+	return rows, nil
+}
+
+var terminalReportColumns = []string{
+	"id", "company_name", "inn", "address", "assembly_number", "cash_register_number",
+	"module_number", "is_active", "free_record_balance", "last_request_date",
+	"database_update_date", "user_id",
+}
+
+func terminalReportRow(t *models.Terminal) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                   t.ID,
+		"assembly_number":      t.AssemblyNumber,
+		"inn":                  t.INN,
+		"company_name":         t.CompanyName,
+		"address":              t.Address,
+		"cash_register_number": t.CashRegisterNumber,
+		"module_number":        t.ModuleNumber,
+		"last_request_date":    formatReportTime(t.LastRequestDate),
+		"database_update_date": formatReportTime(t.DatabaseUpdateDate),
+		"is_active":            t.IsActive,
+		"user_id":              t.UserID,
+		"free_record_balance":  t.FreeRecordBalance,
+	}
+}
+
+func formatReportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func reportFileName(schedule *models.ReportSchedule, now time.Time) string {
+	return fmt.Sprintf("%s_%s.%s", schedule.ReportType, now.Format("2006-01-02_15-04-05"), schedule.Format)
+}
+
+func renderReport(schedule *models.ReportSchedule, rows []map[string]interface{}, now time.Time, stamp string) (*delivery.File, error) {
+	name := reportFileName(schedule, now)
+
+	var buf bytes.Buffer
+	switch schedule.Format {
+	case models.ReportFormatCSV:
+		if err := csv.WriteCSV(rows, &buf); err != nil {
+			return nil, fmt.Errorf("failed to generate CSV: %w", err)
+		}
+		return &delivery.File{Name: name, ContentType: "text/csv", Data: buf.Bytes()}, nil
+	case models.ReportFormatXLSX:
+		f, err := xlsx.WriteXLSX(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate XLSX: %w", err)
+		}
+		if err := xlsx.Save(f, &buf, xlsx.SaveOptions{Password: schedule.FilePassword, Stamp: stamp}); err != nil {
+			return nil, fmt.Errorf("failed to write XLSX: %w", err)
+		}
+		return &delivery.File{
+			Name:        name,
+			ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			Data:        buf.Bytes(),
+		}, nil
+	case models.ReportFormatPDF:
+		table := terminalsTable(reportTitles[schedule.ReportType], rows, now)
+		if err := pdf.WriteTable(&buf, table, pdf.Options{Password: schedule.FilePassword, Stamp: stamp}); err != nil {
+			return nil, fmt.Errorf("failed to generate PDF: %w", err)
+		}
+		return &delivery.File{Name: name, ContentType: "application/pdf", Data: buf.Bytes()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported report format %q", schedule.Format)
+	}
+}
+
+var reportTitles = map[string]string{
+	models.ReportTypeTerminals:         "Терминалы",
+	models.ReportTypeInactiveTerminals: "Неактивные терминалы",
+	models.ReportTypeLowBalance:        "Терминалы с низким балансом свободных записей",
+}
+
+func terminalsTable(title string, rows []map[string]interface{}, now time.Time) *pdf.Table {
+	table := &pdf.Table{Title: title, GeneratedAt: now}
+	for _, key := range terminalReportColumns {
+		table.Headers = append(table.Headers, xlsx.HeaderTitle(key))
+	}
+	for _, row := range rows {
+		cells := make([]string, 0, len(terminalReportColumns))
+		for _, key := range terminalReportColumns {
+			cells = append(cells, formatCell(row[key]))
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+	return table
+}
+
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "Да"
+		}
+		return "Нет"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// prepareSchedule проверяет расписание и пересчитывает next_run_at
+func (s *ReportService) prepareSchedule(schedule *models.ReportSchedule, now time.Time) error {
+	if strings.TrimSpace(schedule.Name) == "" {
+		return apperror.Invalid("name", "required", "report name is required")
+	}
+
+	switch schedule.ReportType {
+	case models.ReportTypeTerminals, models.ReportTypeInactiveTerminals, models.ReportTypeLowBalance:
+	default:
+		return apperror.Invalid("report_type", "unknown", fmt.Sprintf("unknown report type %q", schedule.ReportType))
+	}
+
+	switch schedule.Format {
+	case models.ReportFormatXLSX, models.ReportFormatCSV, models.ReportFormatPDF:
+	default:
+		return apperror.Invalid("format", "unsupported", fmt.Sprintf("unsupported report format %q", schedule.Format))
+	}
+	if schedule.FilePassword != "" && schedule.Format == models.ReportFormatCSV {
+		return apperror.Invalid("file_password", "not_supported", "CSV reports cannot be password-protected")
+	}
+
+	if _, ok := s.deliverers[schedule.DeliveryType]; !ok {
+		return apperror.Invalid("delivery_type", "not_configured", fmt.Sprintf("delivery type %q is not configured", schedule.DeliveryType))
+	}
+
+	sched, err := cron.ParseStandard(schedule.CronExpr)
+	if err != nil {
+		return apperror.Invalid("cron_expr", "invalid_format", "invalid cron expression").Wrap(err)
+	}
+
+	if schedule.IsActive {
+		next := sched.Next(now)
+		schedule.NextRunAt = &next
+	} else {
+		schedule.NextRunAt = nil
+	}
+
+	return nil
+}
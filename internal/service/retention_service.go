@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+)
+
+// RetentionService окончательно удаляет записи, которые были мягко удалены
+// дольше срока хранения
+type RetentionService struct {
+	terminalRepo     repository.TerminalRepository
+	fiscalModuleRepo repository.FiscalModuleRepository
+	userRepo         repository.UserRepository
+	retention        time.Duration
+	logger           *logger.Logger
+}
+
+func NewRetentionService(terminalRepo repository.TerminalRepository, fiscalModuleRepo repository.FiscalModuleRepository, userRepo repository.UserRepository, retention time.Duration, logger *logger.Logger) *RetentionService {
+	return &RetentionService{
+		terminalRepo:     terminalRepo,
+		fiscalModuleRepo: fiscalModuleRepo,
+		userRepo:         userRepo,
+		retention:        retention,
+		logger:           logger,
+	}
+}
+
+// Enabled сообщает, задан ли срок хранения удалённых записей
+func (s *RetentionService) Enabled() bool {
+	return s.retention > 0
+}
+
+// PurgeDeleted удаляет записи в порядке зависимостей: терминалы ссылаются
+// на модули и пользователей, модули — на пользователей
+func (s *RetentionService) PurgeDeleted(ctx context.Context, now time.Time) error {
+	ctx, span := tracing.Start(ctx, "RetentionService.PurgeDeleted")
+	defer span.End()
+
+	if !s.Enabled() {
+		return nil
+	}
+	before := now.Add(-s.retention)
+
+	terminals, err := s.terminalRepo.PurgeDeleted(ctx, before)
+	if err != nil {
+		return err
+	}
+	modules, err := s.fiscalModuleRepo.PurgeDeleted(ctx, before)
+	if err != nil {
+		return err
+	}
+	users, err := s.userRepo.PurgeDeleted(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	if terminals+modules+users > 0 {
+		s.logger.Ctx(ctx).Infow("Purged soft-deleted records",
+			"terminals", terminals, "fiscal_modules", modules, "users", users, "deleted_before", before)
+	}
+	return nil
+}
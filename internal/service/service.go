@@ -1,32 +1,137 @@
 package service
 
 import (
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/delivery"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/notify"
+	"github.com/idkOybek/newNewTerminal/pkg/password"
+	"github.com/idkOybek/newNewTerminal/pkg/registry"
 )
 
 type Services struct {
 	Auth         *AuthService
+	TwoFactor    *TwoFactorService
+	Account      *AccountService
 	User         *UserService
 	FiscalModule *FiscalModuleService
 	Terminal     *TerminalService
+	Report       *ReportService
+	Export       *ExportService
+	Document     *DocumentService
+	Retention    *RetentionService
+	Company      *CompanyService
+	Idempotency  *IdempotencyService
+	Stats        *StatsService
+	Health       *HealthService
 }
 
 type Deps struct {
-	Repos  *repository.Repositories
-	Logger *logger.Logger
+	Repos      *repository.Repositories
+	Logger     *logger.Logger
+	Deliverers map[string]delivery.Deliverer
+	// Tokens выпускает JWT при входе
+	Tokens *auth.Manager
+	// Lockout — блокировка входа после неудачных попыток
+	Lockout models.LockoutPolicy
+	// TwoFactor — настройки второго фактора входа
+	TwoFactor models.TwoFactorPolicy
+	// Notifier доставляет письма со ссылками сброса пароля и подтверждения почты
+	Notifier notify.Notifier
+	// Account — сроки действия этих ссылок
+	Account models.AccountPolicy
+	// Password — требования к новым паролям
+	Password models.PasswordPolicy
+	// BreachedPasswords — список утёкших паролей; nil — проверка отключена
+	BreachedPasswords *password.List
+
+	// PublicBaseURL — внешний адрес API, на который ведут QR-коды в документах
+	PublicBaseURL string
+
+	// UserDeletePolicy определяет судьбу терминалов удаляемого пользователя
+	UserDeletePolicy models.UserDeletePolicy
+	// SoftDeleteRetention — сколько хранить удалённые записи до окончательной очистки, 0 — бессрочно
+	SoftDeleteRetention time.Duration
+
+	// Registry — реестр налогоплательщиков; nil — сверка с реестром отключена
+	Registry registry.Registry
+	// CompanyCheck — реакция на расхождения ИНН и названий компаний
+	CompanyCheck models.CompanyCheckMode
+
+	// IdempotencyTTL — сколько хранить ответы на запросы с Idempotency-Key, 0 — не хранить
+	IdempotencyTTL time.Duration
+
+	// TerminalStaleAfter — сколько терминал может не выходить на связь, прежде чем считаться устаревшим
+	TerminalStaleAfter time.Duration
+
+	// DB и Schema нужны только проверкам готовности
+	DB     Pinger
+	Schema SchemaVersioner
 }
 
 func NewServices(deps Deps) *Services {
-	authService := NewAuthService(deps.Repos.User)
-	userService := NewUserService(deps.Repos.User, deps.Repos.FiscalModule)
+	companyService := NewCompanyService(deps.Registry, deps.Repos.User, deps.CompanyCheck, deps.Logger)
+	twoFactorService := NewTwoFactorService(deps.Repos.TwoFactor, deps.Repos.User, deps.Tokens, deps.TwoFactor, deps.Logger)
+	passwordService := NewPasswordService(deps.Repos.User, deps.Tokens, deps.Password, deps.BreachedPasswords, deps.Logger)
+	accountService := NewAccountService(deps.Repos.User, deps.Repos.UserToken, deps.Notifier, passwordService, deps.Account, deps.Logger)
+	authService := NewAuthService(deps.Repos.User, companyService, deps.Tokens, deps.Lockout, twoFactorService, accountService, passwordService)
+	userService := NewUserService(deps.Repos.User, deps.Repos.Terminal, deps.Repos.TwoFactor, deps.UserDeletePolicy, companyService, accountService, passwordService, authService)
 	fiscalModuleService := NewFiscalModuleService(deps.Repos.FiscalModule, deps.Logger)
-	terminalService := NewTerminalService(deps.Repos.Terminal, deps.Repos.FiscalModule, fiscalModuleService, deps.Logger)
+	terminalService := NewTerminalService(deps.Repos.Terminal, deps.Repos.FiscalModule, fiscalModuleService, companyService, deps.Logger)
+	exportService := NewExportService(deps.Repos.Terminal, deps.Repos.FiscalModule, deps.Repos.User, deps.Repos.ExportAudit, deps.Logger)
+	reportService := NewReportService(deps.Repos.Report, deps.Repos.Terminal, deps.Repos.User, exportService, deps.Deliverers, deps.Logger)
+	documentService := NewDocumentService(deps.Repos.Terminal, deps.Repos.FiscalModule, deps.PublicBaseURL, deps.Logger)
+	retentionService := NewRetentionService(deps.Repos.Terminal, deps.Repos.FiscalModule, deps.Repos.User, deps.SoftDeleteRetention, deps.Logger)
+	idempotencyService := NewIdempotencyService(deps.Repos.Idempotency, deps.IdempotencyTTL, deps.Logger)
+	statsService := NewStatsService(deps.Repos.Stats, deps.TerminalStaleAfter)
+	healthService := NewHealthService(deps.DB, deps.Schema, deps.Logger)
 
 	return &Services{
 		Auth:         authService,
+		TwoFactor:    twoFactorService,
+		Account:      accountService,
 		User:         userService,
 		FiscalModule: fiscalModuleService,
 		Terminal:     terminalService,
+		Report:       reportService,
+		Export:       exportService,
+		Document:     documentService,
+		Retention:    retentionService,
+		Company:      companyService,
+		Idempotency:  idempotencyService,
+		Stats:        statsService,
+		Health:       healthService,
+	}
+}
+
+// checkVersion сверяет версию, которую ожидает клиент (If-Match или поле version),
+// с прочитанной из базы; nil означает, что клиент версию не передал
+func checkVersion(expected *int, current int) error {
+	if expected != nil && *expected != current {
+		return apperror.ErrVersionMismatch
+	}
+	return nil
+}
+
+// checkPatchFields отклоняет поля PATCH, которых нет среди patchable, и null:
+// все изменяемые через PATCH столбцы обязательны
+func checkPatchFields(mask models.FieldMask, patchable map[string]bool) error {
+	var details []models.ErrorDetail
+	for _, field := range mask.Fields() {
+		switch {
+		case !patchable[field]:
+			details = append(details, models.ErrorDetail{Field: field, Code: "not_patchable", Message: "cannot be changed with PATCH"})
+		case mask.Null(field):
+			details = append(details, models.ErrorDetail{Field: field, Code: "not_nullable", Message: "cannot be null"})
+		}
+	}
+	if len(details) > 0 {
+		return apperror.Validation(apperror.CodeValidationFailed, "request validation failed", details...)
 	}
+	return nil
 }
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+)
+
+// defaultStaleAfter совпадает с порогом отчёта о неактивных терминалах
+const defaultStaleAfter = defaultInactiveDays * 24 * time.Hour
+
+type StatsService struct {
+	repo       repository.StatsRepository
+	staleAfter time.Duration
+}
+
+func NewStatsService(repo repository.StatsRepository, staleAfter time.Duration) *StatsService {
+	if staleAfter <= 0 {
+		staleAfter = defaultStaleAfter
+	}
+	return &StatsService{
+		repo:       repo,
+		staleAfter: staleAfter,
+	}
+}
+
+func (s *StatsService) Fleet(ctx context.Context, now time.Time) (*models.FleetStats, error) {
+	ctx, span := tracing.Start(ctx, "StatsService.Fleet")
+	defer span.End()
+
+	return s.repo.FleetStats(ctx, now.Add(-s.staleAfter))
+}
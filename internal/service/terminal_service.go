@@ -7,19 +7,45 @@ import (
 	"log"
 	"time"
 
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
 	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
 )
 
+var (
+	ErrFiscalModuleWithoutOwner = apperror.BindingViolation("fiscal_module_without_owner", "fiscal module is not assigned to a user")
+	// ErrStatusLockedByAdmin — пользователь пытается включить терминал, выключенный администратором
+	ErrStatusLockedByAdmin = apperror.Forbidden("status_locked_by_admin", "the terminal was deactivated by an administrator")
+)
+
+// terminalPatchFields — поля, которые принимает PATCH /terminals/{id}
+var terminalPatchFields = map[string]bool{
+	"assembly_number":      true,
+	"inn":                  true,
+	"company_name":         true,
+	"address":              true,
+	"cash_register_number": true,
+	"module_number":        true,
+	"last_request_date":    true,
+	"database_update_date": true,
+	"is_active":            true,
+	"free_record_balance":  true,
+	"version":              true,
+}
+
 type TerminalService struct {
 	repo                repository.TerminalRepository
 	fiscalModuleRepo    repository.FiscalModuleRepository
 	fiscalModuleService *FiscalModuleService
+	companyService      *CompanyService
 	logger              *logger.Logger
 }
 
-func NewTerminalService(repo repository.TerminalRepository, fiscalModuleRepo repository.FiscalModuleRepository, fiscalModuleService *FiscalModuleService, logger *logger.Logger) *TerminalService {
+func NewTerminalService(repo repository.TerminalRepository, fiscalModuleRepo repository.FiscalModuleRepository, fiscalModuleService *FiscalModuleService, companyService *CompanyService, logger *logger.Logger) *TerminalService {
 	if logger == nil {
 		log.Println("Error: logger is nil in NewTerminalService")
 		return nil
@@ -44,22 +70,30 @@ func NewTerminalService(repo repository.TerminalRepository, fiscalModuleRepo rep
 		repo:                repo,
 		fiscalModuleRepo:    fiscalModuleRepo,
 		fiscalModuleService: fiscalModuleService,
+		companyService:      companyService,
 		logger:              logger,
 	}
 }
 
 func (s *TerminalService) CheckExists(ctx context.Context, cashRegisterNumber string) (*models.TerminalExistsResponse, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.CheckExists")
+	defer span.End()
+
+	logger.WithFields(ctx, "cash_register_number", cashRegisterNumber)
 	terminal, err := s.repo.GetByCashRegisterNumber(ctx, cashRegisterNumber)
 	if err != nil {
 		return nil, err
 	}
 	if terminal == nil {
-		return nil, errors.New("terminal not found")
+		return nil, apperror.ErrTerminalNotFound
 	}
 	return &models.TerminalExistsResponse{ID: terminal.ID}, nil
 }
 
 func (s *TerminalService) GetStatus(ctx context.Context, id int) (*models.TerminalStatusResponse, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.GetStatus")
+	defer span.End()
+
 	isActive, err := s.repo.GetStatus(ctx, id)
 	if err != nil {
 		return nil, err
@@ -68,45 +102,59 @@ func (s *TerminalService) GetStatus(ctx context.Context, id int) (*models.Termin
 }
 
 func (s *TerminalService) Create(ctx context.Context, req *models.TerminalCreateRequest) (*models.Terminal, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.Create")
+	defer span.End()
+
 	if s.logger == nil {
 		return nil, errors.New("logger is not initialized")
 	}
 	if s.fiscalModuleRepo == nil {
-		s.logger.Error("Fiscal module repository is not initialized")
+		s.logger.Ctx(ctx).Errorw("Fiscal module repository is not initialized")
 		return nil, errors.New("fiscal module repository is not initialized")
 	}
 	if s.repo == nil {
-		s.logger.Error("Terminal repository is not initialized")
+		s.logger.Ctx(ctx).Errorw("Terminal repository is not initialized")
 		return nil, errors.New("terminal repository is not initialized")
 	}
 	if s.fiscalModuleService == nil {
-		s.logger.Error("Fiscal module service is not initialized")
+		s.logger.Ctx(ctx).Errorw("Fiscal module service is not initialized")
 		return nil, errors.New("fiscal module service is not initialized")
 	}
 
-	s.logger.Info("Starting terminal creation", "cash_register_number", req.CashRegisterNumber)
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(ctx, "cash_register_number", req.CashRegisterNumber)
+	s.logger.Ctx(ctx).Infow("Starting terminal creation")
 
 	fiscalModule, err := s.fiscalModuleRepo.GetByFactoryNumber(ctx, req.CashRegisterNumber)
 	if err != nil {
-		s.logger.Error("Failed to get fiscal module", "error", err)
+		s.logger.Ctx(ctx).Errorw("Failed to get fiscal module", "error", err)
 		return nil, fmt.Errorf("failed to get fiscal module: %w", err)
 	}
 	if fiscalModule == nil {
-		s.logger.Error("No fiscal module found", "cash_register_number", req.CashRegisterNumber)
-		return nil, errors.New("no fiscal module found with the given cash register number")
+		s.logger.Ctx(ctx).Errorw("No fiscal module found")
+		return nil, apperror.ErrFiscalModuleNotRegistered
 	}
-	s.logger.Info("Fiscal module found", "id", fiscalModule.ID, "is_active", fiscalModule.IsActive)
+	s.logger.Ctx(ctx).Infow("Fiscal module found", "id", fiscalModule.ID, "is_active", fiscalModule.IsActive)
 
 	userID, err := s.repo.GetUserIDByCashRegisterNumber(ctx, req.CashRegisterNumber)
 	if err != nil {
 		return nil, fmt.Errorf("failed to determine user for this terminal: %w", err)
 	}
 	if userID == 0 {
-		return nil, errors.New("user not found for this terminal")
+		return nil, ErrFiscalModuleWithoutOwner
 	}
 
-	lastRequestDate, _ := time.Parse(time.RFC3339, req.LastRequestDate)
-	databaseUpdateDate, _ := time.Parse(time.RFC3339, req.DatabaseUpdateDate)
+	lastRequestDate, err := time.Parse(time.RFC3339, req.LastRequestDate)
+	if err != nil {
+		return nil, apperror.Invalid("last_request_date", "rfc3339", "last_request_date must be an RFC 3339 timestamp")
+	}
+	databaseUpdateDate, err := time.Parse(time.RFC3339, req.DatabaseUpdateDate)
+	if err != nil {
+		return nil, apperror.Invalid("database_update_date", "rfc3339", "database_update_date must be an RFC 3339 timestamp")
+	}
 
 	terminal := &models.Terminal{
 		AssemblyNumber:     req.AssemblyNumber,
@@ -121,41 +169,67 @@ func (s *TerminalService) Create(ctx context.Context, req *models.TerminalCreate
 		UserID:             userID,
 		FreeRecordBalance:  req.FreeRecordBalance,
 	}
+	if err := s.companyService.CheckTerminal(ctx, terminal); err != nil {
+		return nil, err
+	}
 
 	err = s.repo.Create(ctx, terminal)
 	if err != nil {
-		s.logger.Error("Failed to create terminal", "error", err)
+		s.logger.Ctx(ctx).Errorw("Failed to create terminal", "error", err)
 		return nil, fmt.Errorf("failed to create terminal: %w", err)
 	}
-	s.logger.Info("Terminal created successfully", "id", terminal.ID)
+	s.logger.Ctx(ctx).Infow("Terminal created successfully", "id", terminal.ID)
 
-	s.logger.Info("Attempting to activate fiscal module", "id", fiscalModule.ID)
+	s.logger.Ctx(ctx).Infow("Attempting to activate fiscal module", "id", fiscalModule.ID)
 	err = s.fiscalModuleService.Activate(ctx, fiscalModule.ID)
 	if err != nil {
-		s.logger.Error("Failed to activate fiscal module", "error", err)
+		s.logger.Ctx(ctx).Errorw("Failed to activate fiscal module", "error", err)
 		return terminal, fmt.Errorf("terminal created, but failed to activate fiscal module: %w", err)
 	}
-	s.logger.Info("Fiscal module activation attempt completed")
+	s.logger.Ctx(ctx).Infow("Fiscal module activation attempt completed")
 
 	return terminal, nil
 }
 
 func (s *TerminalService) GetByID(ctx context.Context, id int) (*models.Terminal, error) {
-	return s.repo.GetByID(ctx, id)
+	ctx, span := tracing.Start(ctx, "TerminalService.GetByID")
+	defer span.End()
+
+	return s.load(ctx, id)
 }
 
-func (s *TerminalService) Update(ctx context.Context, id int, req *models.TerminalUpdateRequest) (*models.Terminal, error) {
+// load читает терминал и добавляет его номер кассы к полям лога запроса
+func (s *TerminalService) load(ctx context.Context, id int) (*models.Terminal, error) {
 	terminal, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	logger.WithFields(ctx, "cash_register_number", terminal.CashRegisterNumber)
+	return terminal, nil
+}
+
+func (s *TerminalService) Update(ctx context.Context, id int, req *models.TerminalUpdateRequest) (*models.Terminal, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.Update")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
+	terminal, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(req.Version, terminal.Version); err != nil {
+		return nil, err
+	}
 
 	isAdmin, ok := ctx.Value("userRole").(bool)
 	if !ok {
 		return nil, errors.New("не удалось определить роль пользователя")
 	}
 
-	s.logger.Info("User role", "isAdmin", isAdmin)
+	s.logger.Ctx(ctx).Infow("User role", "isAdmin", isAdmin)
 
 	// Обновляем только предоставленные поля
 	if req.AssemblyNumber != nil {
@@ -176,25 +250,25 @@ func (s *TerminalService) Update(ctx context.Context, id int, req *models.Termin
 	if req.LastRequestDate != nil {
 		lastRequestDate, err := time.Parse(time.RFC3339, *req.LastRequestDate)
 		if err != nil {
-			return nil, fmt.Errorf("неверный формат даты LastRequestDate: %v", err)
+			return nil, apperror.Invalid("last_request_date", "rfc3339", "last_request_date must be an RFC 3339 timestamp")
 		}
 		terminal.LastRequestDate = lastRequestDate
 	}
 	if req.DatabaseUpdateDate != nil {
 		databaseUpdateDate, err := time.Parse(time.RFC3339, *req.DatabaseUpdateDate)
 		if err != nil {
-			return nil, fmt.Errorf("неверный формат даты DatabaseUpdateDate: %v", err)
+			return nil, apperror.Invalid("database_update_date", "rfc3339", "database_update_date must be an RFC 3339 timestamp")
 		}
 		terminal.DatabaseUpdateDate = databaseUpdateDate
 	}
 	if req.IsActive != nil {
 		if !isAdmin && terminal.StatusChangedByAdmin && !terminal.IsActive {
 			// Если обычный пользователь пытается изменить неактивный статус, установленный админом
-			s.logger.Warn("Attempt to change inactive status set by admin", "terminalID", id, "currentStatus", terminal.IsActive, "requestedStatus", *req.IsActive)
-			return nil, errors.New("нельзя изменить неактивный статус, установленный администратором")
+			s.logger.Ctx(ctx).Warnw("Attempt to change inactive status set by admin", "terminalID", id, "currentStatus", terminal.IsActive, "requestedStatus", *req.IsActive)
+			return nil, ErrStatusLockedByAdmin
 		}
 		if *req.IsActive != terminal.IsActive {
-			s.logger.Info("Changing terminal status", "terminalID", id, "oldStatus", terminal.IsActive, "newStatus", *req.IsActive, "changedByAdmin", isAdmin)
+			s.logger.Ctx(ctx).Infow("Changing terminal status", "terminalID", id, "oldStatus", terminal.IsActive, "newStatus", *req.IsActive, "changedByAdmin", isAdmin)
 			terminal.IsActive = *req.IsActive
 			terminal.StatusChangedByAdmin = isAdmin
 		}
@@ -205,6 +279,11 @@ func (s *TerminalService) Update(ctx context.Context, id int, req *models.Termin
 	if req.CashRegisterNumber != nil {
 		terminal.CashRegisterNumber = *req.CashRegisterNumber
 	}
+	if req.INN != nil || req.CompanyName != nil {
+		if err := s.companyService.CheckTerminal(ctx, terminal); err != nil {
+			return nil, err
+		}
+	}
 	
 	err = s.repo.Update(ctx, terminal)
 	if err != nil {
@@ -217,10 +296,220 @@ func (s *TerminalService) Update(ctx context.Context, id int, req *models.Termin
 	return terminal, nil
 }
 
+// Patch меняет только поля из mask, включая пустые строки и false,
+// и возвращает запись в том виде, в каком её записала база
+func (s *TerminalService) Patch(ctx context.Context, id int, req *models.TerminalUpdateRequest, mask models.FieldMask) (*models.Terminal, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.Patch")
+	defer span.End()
+
+	if err := checkPatchFields(mask, terminalPatchFields); err != nil {
+		return nil, err
+	}
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
+	terminal, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(req.Version, terminal.Version); err != nil {
+		return nil, err
+	}
+
+	isAdmin, _ := ctx.Value("userRole").(bool)
+
+	// patched — запись после изменений, нужна для сверки компании
+	patched := *terminal
+	changes := models.Changes{}
+	if mask.Has("assembly_number") {
+		patched.AssemblyNumber = *req.AssemblyNumber
+		changes["assembly_number"] = patched.AssemblyNumber
+	}
+	if mask.Has("inn") {
+		patched.INN = *req.INN
+		changes["inn"] = patched.INN
+	}
+	if mask.Has("company_name") {
+		patched.CompanyName = *req.CompanyName
+		changes["company_name"] = patched.CompanyName
+	}
+	if mask.Has("address") {
+		changes["address"] = *req.Address
+	}
+	if mask.Has("cash_register_number") {
+		changes["cash_register_number"] = *req.CashRegisterNumber
+	}
+	if mask.Has("module_number") {
+		changes["module_number"] = *req.ModuleNumber
+	}
+	if mask.Has("last_request_date") {
+		lastRequestDate, err := time.Parse(time.RFC3339, *req.LastRequestDate)
+		if err != nil {
+			return nil, apperror.Invalid("last_request_date", "rfc3339", "last_request_date must be an RFC 3339 timestamp")
+		}
+		changes["last_request_date"] = lastRequestDate
+	}
+	if mask.Has("database_update_date") {
+		databaseUpdateDate, err := time.Parse(time.RFC3339, *req.DatabaseUpdateDate)
+		if err != nil {
+			return nil, apperror.Invalid("database_update_date", "rfc3339", "database_update_date must be an RFC 3339 timestamp")
+		}
+		changes["database_update_date"] = databaseUpdateDate
+	}
+	if mask.Has("is_active") {
+		if !isAdmin && terminal.StatusChangedByAdmin && !terminal.IsActive {
+			return nil, ErrStatusLockedByAdmin
+		}
+		changes["is_active"] = *req.IsActive
+		if *req.IsActive != terminal.IsActive {
+			changes["status_changed_by_admin"] = isAdmin
+		}
+	}
+	if mask.Has("free_record_balance") {
+		changes["free_record_balance"] = *req.FreeRecordBalance
+	}
+
+	if mask.Has("inn") || mask.Has("company_name") {
+		if err := s.companyService.CheckTerminal(ctx, &patched); err != nil {
+			return nil, err
+		}
+		// Пустое название компании заполняется у владельца, если клиент не обнулил его явно
+		if !mask.Has("company_name") && patched.CompanyName != terminal.CompanyName {
+			changes["company_name"] = patched.CompanyName
+		}
+	}
+
+	if len(changes) == 0 {
+		return terminal, nil
+	}
+	return s.repo.Patch(ctx, id, terminal.Version, changes)
+}
+
 func (s *TerminalService) Delete(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "TerminalService.Delete")
+	defer span.End()
+
 	return s.repo.Delete(ctx, id)
 }
 
+func (s *TerminalService) Restore(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "TerminalService.Restore")
+	defer span.End()
+
+	return s.repo.Restore(ctx, id)
+}
+
 func (s *TerminalService) List(ctx context.Context) ([]*models.Terminal, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.List")
+	defer span.End()
+
 	return s.repo.List(ctx)
 }
+
+// SetStatus меняет статус терминала от имени администратора и записывает причину в журнал
+func (s *TerminalService) SetStatus(ctx context.Context, id int, active bool, reason string) (*models.Terminal, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.SetStatus")
+	defer span.End()
+
+	terminal, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	terminal.IsActive = active
+	terminal.StatusChangedByAdmin = true
+	if err := s.repo.Update(ctx, terminal); err != nil {
+		return nil, err
+	}
+
+	if err := s.logStatusChange(ctx, id, active, reason); err != nil {
+		return terminal, err
+	}
+	s.logger.Ctx(ctx).Infow("Terminal status changed by admin", "terminal_id", id, "is_active", active, "reason", reason)
+	return terminal, nil
+}
+
+func (s *TerminalService) StatusHistory(ctx context.Context, id int) ([]*models.TerminalStatusChange, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.StatusHistory")
+	defer span.End()
+
+	return s.repo.ListStatusChanges(ctx, id)
+}
+
+// BindModule перепривязывает терминал к другому фискальному модулю.
+// Новый модуль активируется, прежний — деактивируется, всё в одной транзакции.
+func (s *TerminalService) BindModule(ctx context.Context, id int, factoryNumber string) (*models.Terminal, error) {
+	ctx, span := tracing.Start(ctx, "TerminalService.BindModule")
+	defer span.End()
+
+	terminal, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if terminal.CashRegisterNumber == factoryNumber {
+		return terminal, nil
+	}
+
+	module, err := s.fiscalModuleRepo.GetByFactoryNumber(ctx, factoryNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fiscal module: %w", err)
+	}
+	if module == nil {
+		return nil, apperror.ErrFiscalModuleNotRegistered
+	}
+
+	bound, err := s.repo.GetByCashRegisterNumber(ctx, factoryNumber)
+	if err != nil {
+		return nil, err
+	}
+	if bound != nil {
+		return nil, ErrFiscalModuleInUse
+	}
+
+	if err := s.repo.BindModule(ctx, terminal, module); err != nil {
+		return nil, err
+	}
+	s.logger.Ctx(ctx).Infow("Terminal bound to fiscal module", "terminal_id", id, "factory_number", factoryNumber)
+	return terminal, nil
+}
+
+// UnbindModule освобождает фискальный модуль: терминал деактивируется
+// и мягко удаляется (его можно восстановить), модуль деактивируется; всё это
+// в одной транзакции. cash_register_number обязателен, поэтому терминал без
+// модуля существовать не может.
+func (s *TerminalService) UnbindModule(ctx context.Context, id int, reason string) error {
+	ctx, span := tracing.Start(ctx, "TerminalService.UnbindModule")
+	defer span.End()
+
+	terminal, err := s.load(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UnbindModule(ctx, s.statusChange(ctx, id, false, reason)); err != nil {
+		return err
+	}
+	s.logger.Ctx(ctx).Infow("Fiscal module unbound from terminal", "terminal_id", id, "factory_number", terminal.CashRegisterNumber)
+	return nil
+}
+
+func (s *TerminalService) logStatusChange(ctx context.Context, id int, active bool, reason string) error {
+	if err := s.repo.LogStatusChange(ctx, s.statusChange(ctx, id, active, reason)); err != nil {
+		return fmt.Errorf("failed to record status change: %w", err)
+	}
+	return nil
+}
+
+// statusChange — запись истории статусов от имени текущего пользователя
+func (s *TerminalService) statusChange(ctx context.Context, id int, active bool, reason string) *models.TerminalStatusChange {
+	change := &models.TerminalStatusChange{
+		TerminalID: id,
+		IsActive:   active,
+		Reason:     reason,
+	}
+	if claims, ok := ctx.Value("user").(*auth.Claims); ok {
+		change.ChangedBy = claims.Username
+	}
+	return change
+}
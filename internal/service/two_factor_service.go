@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/internal/repository"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/idkOybek/newNewTerminal/pkg/totp"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew — сколько соседних 30-секундных шагов принимается из-за расхождения часов
+	totpSkew = 1
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorService управляет вторым фактором входа (TOTP) и кодами восстановления
+type TwoFactorService struct {
+	repo   repository.TwoFactorRepository
+	users  repository.UserRepository
+	tokens *auth.Manager
+	policy models.TwoFactorPolicy
+	logger *logger.Logger
+}
+
+func NewTwoFactorService(repo repository.TwoFactorRepository, users repository.UserRepository, tokens *auth.Manager, policy models.TwoFactorPolicy, logger *logger.Logger) *TwoFactorService {
+	return &TwoFactorService{
+		repo:   repo,
+		users:  users,
+		tokens: tokens,
+		policy: policy,
+		logger: logger,
+	}
+}
+
+// Required — должен ли пользователь входить со вторым фактором
+func (s *TwoFactorService) Required(user *models.User) bool {
+	return user.TOTPEnabled || (s.policy.RequiredForAdmins && user.IsAdmin)
+}
+
+// Challenge выдаёт токен для ввода кода или, если второй фактор обязателен,
+// но не подключён, — для его подключения
+func (s *TwoFactorService) Challenge(user *models.User) (*models.UserLoginResponse, error) {
+	purpose := auth.PurposeMFA
+	if !user.TOTPEnabled {
+		purpose = auth.PurposeMFAEnroll
+	}
+
+	token, err := s.tokens.GenerateChallenge(user.ID, user.Username, user.IsAdmin, purpose, s.policy.ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &models.UserLoginResponse{
+		MFARequired:           user.TOTPEnabled,
+		MFAEnrollmentRequired: !user.TOTPEnabled,
+		ChallengeToken:        token,
+	}, nil
+}
+
+func (s *TwoFactorService) Status(ctx context.Context) (*models.TwoFactorStatus, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Status")
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.TwoFactorStatus{
+		Enabled:  user.TOTPEnabled,
+		Required: s.policy.RequiredForAdmins && user.IsAdmin,
+	}
+	if user.TOTPEnabled {
+		if status.RecoveryCodesLeft, err = s.repo.CountRecoveryCodes(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Enroll создаёт новый секрет. Он начнёт действовать после Confirm, поэтому
+// незавершённое подключение не закрывает пользователю вход.
+func (s *TwoFactorService) Enroll(ctx context.Context) (*models.TwoFactorEnrollResponse, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Enroll")
+	defer span.End()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, apperror.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPending(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	uri := totp.ProvisioningURI(s.policy.Issuer, user.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Ctx(ctx).Infow("Two-factor enrollment started")
+	return &models.TwoFactorEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: uri,
+		QRCode:          base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// Confirm включает второй фактор по первому коду из приложения и выдаёт коды
+// восстановления. Если подключение было шагом входа администратора, выдаётся
+// и обычный токен.
+func (s *TwoFactorService) Confirm(ctx context.Context, req *models.TwoFactorCodeRequest) (*models.TwoFactorConfirmResponse, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Confirm")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok {
+		return nil, apperror.ErrUnauthenticated
+	}
+
+	tf, err := s.repo.Get(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if tf.Enabled {
+		return nil, apperror.ErrTwoFactorAlreadyEnabled
+	}
+	if tf.Secret == "" {
+		return nil, apperror.ErrTwoFactorNotPending
+	}
+
+	step, ok := totp.Validate(tf.Secret, req.Code, time.Now(), totpSkew)
+	if !ok {
+		return nil, apperror.ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Enable(ctx, claims.UserID, step, hashes); err != nil {
+		return nil, err
+	}
+	s.logger.Ctx(ctx).Infow("Two-factor authentication enabled")
+
+	resp := &models.TwoFactorConfirmResponse{RecoveryCodes: codes}
+	if claims.Purpose == auth.PurposeMFAEnroll {
+		if resp.Token, err = s.tokens.GenerateToken(claims.UserID, claims.Username, claims.IsAdmin); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// Disable отключает второй фактор по действующему коду. Администраторам,
+// для которых он обязателен, отключать нельзя — только сбросить через другого администратора.
+func (s *TwoFactorService) Disable(ctx context.Context, req *models.TwoFactorCodeRequest) error {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Disable")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return err
+	}
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+	if s.policy.RequiredForAdmins && user.IsAdmin {
+		return apperror.ErrTwoFactorRequired
+	}
+	if err := s.verifyCode(ctx, user.ID, req.Code); err != nil {
+		return err
+	}
+
+	if err := s.repo.Disable(ctx, user.ID); err != nil {
+		return err
+	}
+	s.logger.Ctx(ctx).Infow("Two-factor authentication disabled")
+	return nil
+}
+
+// RegenerateRecoveryCodes заменяет все коды восстановления новыми
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, req *models.TwoFactorCodeRequest) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.RegenerateRecoveryCodes")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok {
+		return nil, apperror.ErrUnauthenticated
+	}
+	if err := s.verifyCode(ctx, claims.UserID, req.Code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, claims.UserID, hashes); err != nil {
+		return nil, err
+	}
+	s.logger.Ctx(ctx).Infow("Recovery codes regenerated")
+	return codes, nil
+}
+
+// Verify проверяет код из приложения или, если code пуст, код восстановления.
+// Принятый код повторно не подойдёт.
+func (s *TwoFactorService) Verify(ctx context.Context, userID int, code, recoveryCode string) error {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Verify")
+	defer span.End()
+
+	if code != "" {
+		return s.verifyCode(ctx, userID, code)
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, hashRecoveryCode(recoveryCode))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return apperror.ErrInvalidTwoFactorCode
+	}
+	s.logger.Ctx(ctx).Warnw("Recovery code used for login", "user_id", userID)
+	return nil
+}
+
+func (s *TwoFactorService) verifyCode(ctx context.Context, userID int, code string) error {
+	tf, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !tf.Enabled {
+		return apperror.ErrTwoFactorNotEnabled
+	}
+
+	step, ok := totp.Validate(tf.Secret, code, time.Now(), totpSkew)
+	if !ok || step <= tf.LastStep {
+		return apperror.ErrInvalidTwoFactorCode
+	}
+	used, err := s.repo.UseStep(ctx, userID, step)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return apperror.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) currentUser(ctx context.Context) (*models.User, error) {
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok {
+		return nil, apperror.ErrUnauthenticated
+	}
+	return s.users.GetByID(ctx, claims.UserID)
+}
+
+// newRecoveryCodes возвращает коды вида "abcde-fghij" и их хеши для хранения.
+// 50 случайных бит на код достаточно, чтобы хранить SHA-256 без соли.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := strings.ToLower(recoveryEncoding.EncodeToString(raw))[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode не различает регистр, пробелы и дефисы — код вводят вручную
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
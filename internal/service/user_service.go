@@ -2,26 +2,76 @@ package service
 
 import (
 	"context"
+	"strings"
 
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
 	"github.com/idkOybek/newNewTerminal/internal/models"
 	"github.com/idkOybek/newNewTerminal/internal/repository"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/idkOybek/newNewTerminal/internal/validation"
+	"github.com/idkOybek/newNewTerminal/pkg/auth"
+	"github.com/idkOybek/newNewTerminal/pkg/tracing"
 )
 
+var (
+	ErrUserHasTerminals = apperror.Conflict("user_has_terminals", "user still has terminals; delete or reassign them first")
+	// ErrForeignUser — не-администратор пытается изменить чужую учётную запись
+	ErrForeignUser = apperror.Forbidden("foreign_user", "only admins can change other users")
+	// ErrRoleChangeForbidden — не-администратор меняет себе is_admin или is_active
+	ErrRoleChangeForbidden = apperror.Forbidden("admin_required", "only admins can change is_admin and is_active")
+	// ErrOwnPasswordChange — свой пароль меняется только с текущим паролем
+	ErrOwnPasswordChange = apperror.Forbidden("use_password_change", "change your own password with POST /auth/password/change")
+	// ErrCurrentPasswordRequired — свой email меняется только с текущим паролем
+	ErrCurrentPasswordRequired = apperror.Invalid("current_password", "required", "current password is required to change the email")
+)
+
+// userPatchFields — поля, которые принимает PATCH /users/{id}
+var userPatchFields = map[string]bool{
+	"inn":          true,
+	"username":     true,
+	"password":     true,
+	"company_name": true,
+	"is_active":    true,
+	"is_admin":     true,
+	"version":      true,
+	"email":        true,
+	"phone":        true,
+	// current_password не столбец: он подтверждает смену email
+	"current_password": true,
+}
+
 type UserService struct {
-	repo             repository.UserRepository
-	fiscalModuleRepo repository.FiscalModuleRepository
+	repo          repository.UserRepository
+	terminalRepo  repository.TerminalRepository
+	twoFactorRepo repository.TwoFactorRepository
+	deletePolicy  models.UserDeletePolicy
+	companies     *CompanyService
+	accounts      *AccountService
+	passwords     *PasswordService
+	authService   *AuthService
 }
 
-func NewUserService(repo repository.UserRepository, fiscalModuleRepo repository.FiscalModuleRepository) *UserService {
+func NewUserService(repo repository.UserRepository, terminalRepo repository.TerminalRepository, twoFactorRepo repository.TwoFactorRepository, deletePolicy models.UserDeletePolicy, companies *CompanyService, accounts *AccountService, passwords *PasswordService, authService *AuthService) *UserService {
 	return &UserService{
-		repo:             repo,
-		fiscalModuleRepo: fiscalModuleRepo,
+		repo:          repo,
+		terminalRepo:  terminalRepo,
+		twoFactorRepo: twoFactorRepo,
+		deletePolicy:  deletePolicy,
+		companies:     companies,
+		accounts:      accounts,
+		passwords:     passwords,
+		authService:   authService,
 	}
 }
 
 func (s *UserService) Create(ctx context.Context, req *models.UserCreateRequest) (*models.User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	ctx, span := tracing.Start(ctx, "UserService.Create")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwords.Hash(ctx, nil, req.Password, "password")
 	if err != nil {
 		return nil, err
 	}
@@ -29,29 +79,64 @@ func (s *UserService) Create(ctx context.Context, req *models.UserCreateRequest)
 	user := &models.User{
 		INN:         req.INN,
 		Username:    req.Username,
-		Password:    string(hashedPassword),
+		Password:    hashedPassword,
 		CompanyName: req.CompanyName, // Новое поле
 		IsActive:    req.IsActive,
 		IsAdmin:     req.IsAdmin,
+		Email:       req.Email,
+		Phone:       req.Phone,
+		// Пароль выдал администратор, пользователь сменит его при первом входе
+		MustChangePassword: true,
+	}
+	if err := s.companies.CheckUser(ctx, user); err != nil {
+		return nil, err
 	}
 
 	err = s.repo.Create(ctx, user)
 	if err != nil {
 		return nil, err
 	}
+	s.accounts.StartVerification(ctx, user)
 
 	return user, nil
 }
 
 func (s *UserService) GetByID(ctx context.Context, id int) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByID")
+	defer span.End()
+
 	return s.repo.GetByID(ctx, id)
 }
 
+func (s *UserService) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByUsername")
+	defer span.End()
+
+	return s.repo.GetByUsername(ctx, username)
+}
+
 func (s *UserService) Update(ctx context.Context, id int, req *models.UserUpdateRequest) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Update")
+	defer span.End()
+
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	claims, err := authorizeUserChange(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
 	user, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkVersion(req.Version, user.Version); err != nil {
+		return nil, err
+	}
+	if !claims.IsAdmin && (differs(req.IsAdmin, user.IsAdmin) || differs(req.IsActive, user.IsActive)) {
+		return nil, ErrRoleChangeForbidden
+	}
 
 	if req.INN != nil {
 		user.INN = *req.INN
@@ -59,12 +144,18 @@ func (s *UserService) Update(ctx context.Context, id int, req *models.UserUpdate
 	if req.Username != nil {
 		user.Username = *req.Username
 	}
+	oldPassword := ""
 	if req.Password != nil {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err := authorizePasswordReset(claims, id); err != nil {
+			return nil, err
+		}
+		hashedPassword, err := s.passwords.Hash(ctx, user, *req.Password, "password")
 		if err != nil {
 			return nil, err
 		}
-		user.Password = string(hashedPassword)
+		oldPassword = user.Password
+		user.Password = hashedPassword
+		user.MustChangePassword = true
 	}
 	if req.CompanyName != nil {
 		user.CompanyName = *req.CompanyName
@@ -75,25 +166,227 @@ func (s *UserService) Update(ctx context.Context, id int, req *models.UserUpdate
 	if req.IsAdmin != nil {
 		user.IsAdmin = *req.IsAdmin
 	}
+	oldEmail := user.Email
+	emailChanged := req.Email != nil && !strings.EqualFold(*req.Email, user.Email)
+	if emailChanged {
+		if err := s.authorizeEmailChange(ctx, claims, user, req.CurrentPassword); err != nil {
+			return nil, err
+		}
+		user.Email = *req.Email
+		user.EmailVerifiedAt = nil
+	}
+	if req.Phone != nil {
+		user.Phone = *req.Phone
+	}
+	if req.INN != nil || req.CompanyName != nil {
+		if err := s.companies.CheckUser(ctx, user); err != nil {
+			return nil, err
+		}
+	}
 
 	err = s.repo.Update(ctx, user)
 	if err != nil {
 		return nil, err
 	}
+	s.passwords.Remember(ctx, id, oldPassword)
+	if emailChanged {
+		s.accounts.StartVerification(ctx, user)
+		s.accounts.NotifyEmailChanged(ctx, user, oldEmail)
+	}
 
 	return user, nil
 }
 
+// Patch меняет только поля из mask, включая пустые строки и false,
+// и возвращает запись в том виде, в каком её записала база
+func (s *UserService) Patch(ctx context.Context, id int, req *models.UserUpdateRequest, mask models.FieldMask) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Patch")
+	defer span.End()
+
+	if err := checkPatchFields(mask, userPatchFields); err != nil {
+		return nil, err
+	}
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	claims, err := authorizeUserChange(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(req.Version, user.Version); err != nil {
+		return nil, err
+	}
+	if !claims.IsAdmin && (mask.Has("is_admin") && *req.IsAdmin != user.IsAdmin ||
+		mask.Has("is_active") && *req.IsActive != user.IsActive) {
+		return nil, ErrRoleChangeForbidden
+	}
+
+	patched := *user
+	changes := models.Changes{}
+	if mask.Has("inn") {
+		patched.INN = *req.INN
+		changes["inn"] = patched.INN
+	}
+	if mask.Has("username") {
+		changes["username"] = *req.Username
+	}
+	if mask.Has("password") {
+		if err := authorizePasswordReset(claims, id); err != nil {
+			return nil, err
+		}
+		hashedPassword, err := s.passwords.Hash(ctx, user, *req.Password, "password")
+		if err != nil {
+			return nil, err
+		}
+		changes["password"] = hashedPassword
+		changes["must_change_password"] = true
+	}
+	if mask.Has("company_name") {
+		patched.CompanyName = *req.CompanyName
+		changes["company_name"] = patched.CompanyName
+	}
+	if mask.Has("is_active") {
+		changes["is_active"] = *req.IsActive
+	}
+	if mask.Has("is_admin") {
+		changes["is_admin"] = *req.IsAdmin
+	}
+	emailChanged := mask.Has("email") && !strings.EqualFold(*req.Email, user.Email)
+	if emailChanged {
+		if err := s.authorizeEmailChange(ctx, claims, user, req.CurrentPassword); err != nil {
+			return nil, err
+		}
+		changes["email"] = *req.Email
+		changes["email_verified_at"] = nil
+	}
+	if mask.Has("phone") {
+		changes["phone"] = *req.Phone
+	}
+
+	if mask.Has("inn") || mask.Has("company_name") {
+		if err := s.companies.CheckUser(ctx, &patched); err != nil {
+			return nil, err
+		}
+		// Пустое название компании заполняется из реестра, если клиент не обнулил его явно
+		if !mask.Has("company_name") && patched.CompanyName != user.CompanyName {
+			changes["company_name"] = patched.CompanyName
+		}
+	}
+
+	if len(changes) == 0 {
+		return user, nil
+	}
+	updated, err := s.repo.Patch(ctx, id, user.Version, changes)
+	if err != nil {
+		return nil, err
+	}
+	if mask.Has("password") {
+		s.passwords.Remember(ctx, id, user.Password)
+	}
+	if emailChanged {
+		s.accounts.StartVerification(ctx, updated)
+		s.accounts.NotifyEmailChanged(ctx, updated, user.Email)
+	}
+	return updated, nil
+}
+
 func (s *UserService) Delete(ctx context.Context, id int) error {
-	// Сначала удаляем связанные фискальные модули
-	if err := s.fiscalModuleRepo.DeleteByUserID(ctx, id); err != nil {
-		return err
+	ctx, span := tracing.Start(ctx, "UserService.Delete")
+	defer span.End()
+
+	if s.deletePolicy == models.UserDeletePolicyRestrict {
+		count, err := s.terminalRepo.CountByUserID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUserHasTerminals
+		}
 	}
 
-	// Затем удаляем самого пользователя
-	return s.repo.Delete(ctx, id)
+	// Пользователь помечается удалённым; судьба его терминалов зависит от политики
+	return s.repo.Delete(ctx, id, s.deletePolicy)
+}
+
+func (s *UserService) Restore(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "UserService.Restore")
+	defer span.End()
+
+	return s.repo.Restore(ctx, id)
+}
+
+// Unlock снимает блокировку входа, не дожидаясь её истечения
+func (s *UserService) Unlock(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "UserService.Unlock")
+	defer span.End()
+
+	return s.repo.Unlock(ctx, id)
+}
+
+// ResetTwoFactor отключает второй фактор пользователя, потерявшего телефон и
+// коды восстановления. Если второй фактор для него обязателен, он подключит
+// его заново при следующем входе.
+func (s *UserService) ResetTwoFactor(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "UserService.ResetTwoFactor")
+	defer span.End()
+
+	return s.twoFactorRepo.Disable(ctx, id)
 }
 
 func (s *UserService) List(ctx context.Context) ([]*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.List")
+	defer span.End()
+
 	return s.repo.List(ctx)
 }
+
+// authorizeUserChange: администратор меняет любую учётную запись,
+// остальные — только свою
+func authorizeUserChange(ctx context.Context, id int) (*auth.Claims, error) {
+	claims, ok := ctx.Value("user").(*auth.Claims)
+	if !ok {
+		return nil, apperror.ErrUnauthenticated
+	}
+	if !claims.IsAdmin && claims.UserID != id {
+		return nil, ErrForeignUser
+	}
+	return claims, nil
+}
+
+// authorizeEmailChange: свой email меняется только с текущим паролем, иначе
+// украденный токен позволил бы сменить адрес и восстановить через него пароль.
+// Администратор меняет чужой адрес без пароля.
+func (s *UserService) authorizeEmailChange(ctx context.Context, claims *auth.Claims, user *models.User, currentPassword *string) error {
+	if claims.IsAdmin && claims.UserID != user.ID {
+		return nil
+	}
+	if currentPassword == nil || *currentPassword == "" {
+		return ErrCurrentPasswordRequired
+	}
+	return s.authService.VerifyPassword(ctx, user, *currentPassword)
+}
+
+// differs — новое значение передано и отличается от текущего
+func differs(value *bool, current bool) bool {
+	return value != nil && *value != current
+}
+
+// authorizePasswordReset: без текущего пароля пароль задаёт только
+// администратор другому пользователю (через API или terminalctl, который
+// действует от имени администратора); такой пароль нужно сменить при входе.
+// Свой пароль меняется через /auth/password/change: украденный токен не
+// должен позволять перехватить учётную запись.
+func authorizePasswordReset(claims *auth.Claims, id int) error {
+	if claims.UserID == id {
+		return ErrOwnPasswordChange
+	}
+	if !claims.IsAdmin {
+		return ErrForeignUser
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package validation проверяет запросы по тегам validate в internal/models
+// и возвращает все нарушения одной доменной ошибкой с деталями по полям.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/idkOybek/newNewTerminal/internal/apperror"
+	"github.com/idkOybek/newNewTerminal/internal/models"
+	"github.com/idkOybek/newNewTerminal/pkg/taxid"
+	"github.com/robfig/cron/v3"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// В деталях ошибок поля называются так же, как в JSON
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+
+	v.RegisterValidation("rfc3339", isRFC3339)
+	v.RegisterValidation("cron", isCron)
+	v.RegisterValidation("notblank", isNotBlank)
+	v.RegisterValidation("inn", func(fl validator.FieldLevel) bool { return taxid.IsINN(fl.Field().String()) })
+	v.RegisterValidation("pinfl", func(fl validator.FieldLevel) bool { return taxid.IsPINFL(fl.Field().String()) })
+	v.RegisterValidation("taxid", func(fl validator.FieldLevel) bool { return taxid.Valid(fl.Field().String()) })
+
+	return v
+}
+
+// Struct проверяет s и возвращает *apperror.Error вида Validation со всеми нарушениями
+func Struct(s interface{}) error {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	details := make([]models.ErrorDetail, 0, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		details = append(details, models.ErrorDetail{
+			Field:   fieldPath(fe),
+			Code:    fe.Tag(),
+			Message: message(fe),
+		})
+	}
+	return apperror.Validation(apperror.CodeValidationFailed, "request validation failed", details...)
+}
+
+// fieldPath отбрасывает имя структуры: "TerminalCreateRequest.inn" -> "inn",
+// вложенные поля остаются через точку: "filters.inactive_days"
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "notblank":
+		return "is required"
+	case "required_unless":
+		return "is required for this delivery type"
+	case "excluded_if":
+		return "is not allowed in this combination"
+	case "min":
+		switch fe.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		case reflect.Slice:
+			return fmt.Sprintf("must contain at least %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		switch fe.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		case reflect.Slice:
+			return fmt.Sprintf("must contain at most %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters long", fe.Param())
+	case "numeric":
+		return "must contain only digits"
+	case "excludesall":
+		return fmt.Sprintf("must not contain any of: %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "email":
+		return "must be a valid email address"
+	case "e164":
+		return "must be a phone number in international format, e.g. +998901234567"
+	case "rfc3339":
+		return "must be a date in RFC 3339 format, e.g. 2024-01-02T15:04:05Z"
+	case "cron":
+		return "must be a valid cron expression"
+	case "inn":
+		return "must be a 9-digit INN"
+	case "pinfl":
+		return "must be a 14-digit PINFL"
+	case "taxid":
+		return "must be a 9-digit INN of a legal entity or a 14-digit PINFL of an individual"
+	}
+	return fmt.Sprintf("failed the %q check", fe.Tag())
+}
+
+func isRFC3339(fl validator.FieldLevel) bool {
+	_, err := time.Parse(time.RFC3339, fl.Field().String())
+	return err == nil
+}
+
+func isCron(fl validator.FieldLevel) bool {
+	_, err := cron.ParseStandard(fl.Field().String())
+	return err == nil
+}
+
+// isNotBlank в отличие от required не пропускает строки из одних пробелов
+func isNotBlank(fl validator.FieldLevel) bool {
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
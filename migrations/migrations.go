@@ -0,0 +1,16 @@
+// Package migrations встраивает SQL-миграции в бинарник, чтобы их можно
+// было применять без доступа к исходникам
+package migrations
+
+import "embed"
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+// Dir — каталог с миграциями внутри FS
+const Dir = "migrations"
+
+// FS возвращает встроенные файлы миграций
+func FS() embed.FS {
+	return files
+}
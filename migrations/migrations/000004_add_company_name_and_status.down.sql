@@ -0,0 +1,3 @@
+-- company_name и is_active уже создаются в 000001 и 000002,
+-- поэтому откат 000004 ничего не удаляет
+SELECT 1;
@@ -0,0 +1,3 @@
+-- terminals из 000003 не имела уникального ограничения на assembly_number,
+-- поэтому откатывать нечего
+SELECT 1;
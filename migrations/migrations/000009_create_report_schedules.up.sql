@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS report_schedules (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    name VARCHAR(255) NOT NULL,
+    report_type VARCHAR(64) NOT NULL,
+    cron_expr VARCHAR(255) NOT NULL,
+    filters JSONB NOT NULL DEFAULT '{}',
+    format VARCHAR(16) NOT NULL DEFAULT 'xlsx',
+    delivery_type VARCHAR(32) NOT NULL,
+    delivery_target TEXT NOT NULL DEFAULT '',
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_report_schedules_user_id ON report_schedules(user_id);
+CREATE INDEX idx_report_schedules_next_run_at ON report_schedules(next_run_at) WHERE is_active;
+
+CREATE TABLE IF NOT EXISTS report_runs (
+    id SERIAL PRIMARY KEY,
+    schedule_id INTEGER NOT NULL REFERENCES report_schedules(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL,
+    row_count INTEGER NOT NULL DEFAULT 0,
+    location TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_report_runs_schedule_id ON report_runs(schedule_id);
@@ -0,0 +1,3 @@
+ALTER TABLE report_schedules DROP COLUMN IF EXISTS file_password;
+
+DROP TABLE IF EXISTS export_audit_log;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS export_audit_log (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id),
+    username VARCHAR(255) NOT NULL DEFAULT '',
+    export_type VARCHAR(64) NOT NULL,
+    format VARCHAR(16) NOT NULL,
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    row_count INTEGER NOT NULL DEFAULT 0,
+    filters JSONB NOT NULL DEFAULT '{}',
+    encrypted BOOLEAN NOT NULL DEFAULT false,
+    remote_addr VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_export_audit_log_user_id ON export_audit_log(user_id);
+CREATE INDEX idx_export_audit_log_created_at ON export_audit_log(created_at);
+
+ALTER TABLE report_schedules ADD COLUMN IF NOT EXISTS file_password VARCHAR(255) NOT NULL DEFAULT '';
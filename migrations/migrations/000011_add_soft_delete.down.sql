@@ -0,0 +1,31 @@
+ALTER TABLE export_audit_log DROP CONSTRAINT IF EXISTS export_audit_log_user_id_fkey;
+ALTER TABLE export_audit_log ADD CONSTRAINT export_audit_log_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE report_schedules DROP CONSTRAINT IF EXISTS report_schedules_user_id_fkey;
+ALTER TABLE report_schedules ADD CONSTRAINT report_schedules_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id);
+
+-- Мягко удалённые записи не переживают откат: иначе уникальные ограничения не восстановить
+DELETE FROM terminals WHERE deleted_at IS NOT NULL;
+DELETE FROM fiscal_modules fm
+WHERE fm.deleted_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM terminals t WHERE t.cash_register_number = fm.factory_number);
+DELETE FROM users u
+WHERE u.deleted_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM terminals t WHERE t.user_id = u.id)
+  AND NOT EXISTS (SELECT 1 FROM fiscal_modules fm WHERE fm.user_id = u.id);
+
+DROP INDEX IF EXISTS terminals_cash_register_number_active_key;
+ALTER TABLE terminals ADD CONSTRAINT terminals_cash_register_number_key UNIQUE (cash_register_number);
+
+DROP INDEX IF EXISTS users_username_active_key;
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
+
+DROP INDEX IF EXISTS idx_terminals_deleted_at;
+DROP INDEX IF EXISTS idx_fiscal_modules_deleted_at;
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+ALTER TABLE terminals DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE fiscal_modules DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,25 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE fiscal_modules ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE terminals ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_fiscal_modules_deleted_at ON fiscal_modules(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_terminals_deleted_at ON terminals(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Удалённый пользователь или терминал не должен занимать логин и номер кассы.
+-- factory_number остаётся уникальным без условия: на него ссылается внешний ключ terminals.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_active_key ON users(username) WHERE deleted_at IS NULL;
+
+ALTER TABLE terminals DROP CONSTRAINT IF EXISTS terminals_cash_register_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS terminals_cash_register_number_active_key ON terminals(cash_register_number) WHERE deleted_at IS NULL;
+
+-- Окончательная очистка пользователя забирает с собой его расписания,
+-- а журнал выгрузок сохраняется (имя пользователя в нём продублировано)
+ALTER TABLE report_schedules DROP CONSTRAINT IF EXISTS report_schedules_user_id_fkey;
+ALTER TABLE report_schedules ADD CONSTRAINT report_schedules_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE export_audit_log DROP CONSTRAINT IF EXISTS export_audit_log_user_id_fkey;
+ALTER TABLE export_audit_log ADD CONSTRAINT export_audit_log_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1 @@
+ALTER TABLE terminals DROP COLUMN IF EXISTS status_changed_by_admin;
@@ -0,0 +1,2 @@
+-- Колонку раньше добавляли вручную, поэтому IF NOT EXISTS
+ALTER TABLE terminals ADD COLUMN IF NOT EXISTS status_changed_by_admin BOOLEAN NOT NULL DEFAULT false;
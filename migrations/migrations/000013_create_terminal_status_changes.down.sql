@@ -0,0 +1 @@
+DROP TABLE IF EXISTS terminal_status_changes;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS terminal_status_changes (
+    id SERIAL PRIMARY KEY,
+    terminal_id INTEGER NOT NULL REFERENCES terminals(id) ON DELETE CASCADE,
+    is_active BOOLEAN NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    changed_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_terminal_status_changes_terminal_id ON terminal_status_changes(terminal_id);
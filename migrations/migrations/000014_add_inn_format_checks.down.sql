@@ -0,0 +1,2 @@
+ALTER TABLE terminals DROP CONSTRAINT IF EXISTS terminals_inn_format_check;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_inn_format_check;
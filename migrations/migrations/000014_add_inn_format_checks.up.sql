@@ -0,0 +1,8 @@
+-- ИНН юридического лица — 9 цифр, ПИНФЛ физического лица — 14.
+-- NOT VALID: старые записи не проверяются, чтобы миграция не падала на них;
+-- найти их можно через terminalctl check.
+ALTER TABLE users
+    ADD CONSTRAINT users_inn_format_check CHECK (inn ~ '^([0-9]{9}|[0-9]{14})$') NOT VALID;
+
+ALTER TABLE terminals
+    ADD CONSTRAINT terminals_inn_format_check CHECK (inn ~ '^([0-9]{9}|[0-9]{14})$') NOT VALID;
@@ -0,0 +1,4 @@
+ALTER TABLE report_schedules DROP COLUMN IF EXISTS version;
+ALTER TABLE terminals DROP COLUMN IF EXISTS version;
+ALTER TABLE fiscal_modules DROP COLUMN IF EXISTS version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
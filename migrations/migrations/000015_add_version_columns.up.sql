@@ -0,0 +1,6 @@
+-- Счётчик версий для оптимистичных блокировок: UPDATE проверяет версию,
+-- которую клиент получил в ETag, и увеличивает её на единицу
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE fiscal_modules ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE terminals ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE report_schedules ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,10 @@
+-- Счётчики запросов для ограничения частоты (RATE_LIMIT_STORE=postgres).
+-- Одна строка на ключ: окно начинается в window_start, count — запросов в нём.
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key VARCHAR(255) PRIMARY KEY,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    count INTEGER NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_rate_limits_expires_at ON rate_limits(expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS lockout_count,
+    DROP COLUMN IF EXISTS failed_login_attempts;
@@ -0,0 +1,7 @@
+-- Прогрессивная блокировка входа: после LOGIN_LOCKOUT_THRESHOLD неудачных
+-- попыток подряд учётная запись блокируется, и каждая следующая блокировка
+-- вдвое длиннее предыдущей. Успешный вход сбрасывает оба счётчика.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS lockout_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
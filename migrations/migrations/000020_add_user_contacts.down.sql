@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS user_tokens;
+
+DROP INDEX IF EXISTS users_email_active_key;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS email_verified_at,
+    DROP COLUMN IF EXISTS phone,
+    DROP COLUMN IF EXISTS email;
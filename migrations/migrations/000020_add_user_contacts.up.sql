@@ -0,0 +1,26 @@
+-- Контакты пользователя. Адрес почты подтверждается письмом; сброс пароля
+-- отправляется только на подтверждённый адрес.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS phone VARCHAR(32),
+    ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITH TIME ZONE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_active_key ON users(LOWER(email))
+    WHERE deleted_at IS NULL AND email IS NOT NULL;
+
+-- Одноразовые токены сброса пароля и подтверждения почты; хранятся только хеши.
+-- email — адрес, на который ушло письмо: подтверждение не засчитывается,
+-- если адрес с тех пор сменился.
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    email VARCHAR(255),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_tokens_user_id ON user_tokens(user_id, purpose);
+CREATE INDEX idx_user_tokens_expires_at ON user_tokens(expires_at);
@@ -0,0 +1,13 @@
+-- Пароль, заданный администратором, нужно сменить при следующем входе
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Прежние хеши паролей: новый пароль не должен совпадать с несколькими последними
+CREATE TABLE IF NOT EXISTS user_password_history (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_password_history_user_id ON user_password_history(user_id, created_at DESC);
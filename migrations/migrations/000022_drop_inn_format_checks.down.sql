@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD CONSTRAINT users_inn_format_check CHECK (inn ~ '^([0-9]{9}|[0-9]{14})$') NOT VALID;
+
+ALTER TABLE terminals
+    ADD CONSTRAINT terminals_inn_format_check CHECK (inn ~ '^([0-9]{9}|[0-9]{14})$') NOT VALID;
@@ -0,0 +1,7 @@
+-- Ограничение NOT VALID всё равно проверяется при каждом UPDATE строки, даже
+-- если inn не меняется, поэтому старые записи с ИНН в свободной форме нельзя
+-- было ни деактивировать, ни удалить, а неудачный вход не засчитывался.
+-- Формат ИНН проверяется валидатором при записи inn; старые записи
+-- находит terminalctl check.
+ALTER TABLE terminals DROP CONSTRAINT IF EXISTS terminals_inn_format_check;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_inn_format_check;
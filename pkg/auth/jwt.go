@@ -2,46 +2,121 @@ package auth
 
 import (
 	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/idkOybek/newNewTerminal/internal/config"
+)
+
+// Назначения промежуточных токенов двухшагового входа
+const (
+	// PurposeMFA — пароль проверен, нужен код второго фактора
+	PurposeMFA = "mfa"
+	// PurposeMFAEnroll — пароль проверен, но второй фактор обязателен и ещё не подключён
+	PurposeMFAEnroll = "mfa_enroll"
+	// PurposePasswordChange — пароль проверен, но его задал администратор и его нужно сменить
+	PurposePasswordChange = "password_change"
 )
 
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
 	IsAdmin  bool   `json:"is_admin"`
+	// Purpose пуст у обычного токена доступа. Токен с назначением годится
+	// только для своего шага входа, но не для API.
+	Purpose string `json:"purpose,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(userID int, username string, isAdmin bool) (string, error) {
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return "", err
-	}
+// Keys — ключ подписи новых токенов и прежние ключи, которые ещё принимаются
+type Keys struct {
+	Secret   string
+	Previous []string
+	TTL      time.Duration
+}
+
+// Manager выпускает и проверяет токены. Ключи можно заменить на лету через SetKeys.
+type Manager struct {
+	keys atomic.Pointer[Keys]
+}
+
+func NewManager(keys Keys) *Manager {
+	m := &Manager{}
+	m.SetKeys(keys)
+	return m
+}
+
+func (m *Manager) SetKeys(keys Keys) {
+	m.keys.Store(&keys)
+}
+
+func (m *Manager) GenerateToken(userID int, username string, isAdmin bool) (string, error) {
+	return m.generate(userID, username, isAdmin, "", m.keys.Load().TTL)
+}
+
+// GenerateChallenge выпускает короткоживущий токен для следующего шага входа
+func (m *Manager) GenerateChallenge(userID int, username string, isAdmin bool, purpose string, ttl time.Duration) (string, error) {
+	return m.generate(userID, username, isAdmin, purpose, ttl)
+}
+
+func (m *Manager) generate(userID int, username string, isAdmin bool, purpose string, ttl time.Duration) (string, error) {
+	keys := m.keys.Load()
 
 	claims := &Claims{
 		UserID:   userID,
 		Username: username,
 		IsAdmin:  isAdmin,
+		Purpose:  purpose,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(cfg.JWTSecret))
+	return token.SignedString([]byte(keys.Secret))
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
-	cfg, err := config.LoadConfig()
+// ValidateChallenge проверяет токен и его назначение
+func (m *Manager) ValidateChallenge(tokenString, purpose string) (*Claims, error) {
+	claims, err := m.ValidateToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("token purpose %q, want %q", claims.Purpose, purpose)
+	}
+	return claims, nil
+}
+
+// ValidateToken проверяет подпись текущим ключом, затем прежними
+func (m *Manager) ValidateToken(tokenString string) (*Claims, error) {
+	keys := m.keys.Load()
+
+	var err error
+	for _, secret := range append([]string{keys.Secret}, keys.Previous...) {
+		if secret == "" {
+			continue
+		}
+		var claims *Claims
+		claims, err = parse(tokenString, secret)
+		if err == nil {
+			return claims, nil
+		}
+		var validationErr *jwt.ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Errors&jwt.ValidationErrorSignatureInvalid == 0 {
+			return nil, err
+		}
+	}
+	return nil, err
+}
 
+func parse(tokenString, secret string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.JWTSecret), nil
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
 	})
 
 	if err != nil {
@@ -0,0 +1,55 @@
+// Package buildinfo хранит сведения о сборке. Commit и BuildTime задаются при сборке:
+//
+//	go build -ldflags "-X github.com/idkOybek/newNewTerminal/pkg/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/idkOybek/newNewTerminal/pkg/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+//
+// Без -ldflags значения берутся из VCS-метаданных, которые go build встраивает сам.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Commit    = ""
+	BuildTime = ""
+)
+
+type Info struct {
+	Commit    string
+	BuildTime string
+	GoVersion string
+	// Modified — сборка из рабочей копии с незакоммиченными изменениями
+	Modified bool
+}
+
+func Get() Info {
+	info := Info{
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+}
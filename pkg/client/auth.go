@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Register регистрирует пользователя. Токен при этом не выдаётся.
+func (c *Client) Register(ctx context.Context, req *UserCreateRequest) (*User, error) {
+	r := newRequest(http.MethodPost, "/auth/register", req)
+	r.anonymous = true
+
+	var user User
+	if err := c.doJSON(ctx, r, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login входит в систему и запоминает токен для следующих запросов. Если
+// учётной записи нужен второй фактор, токена в ответе нет: resp.MFARequired
+// и resp.ChallengeToken для LoginTwoFactor. Если второй фактор обязателен, но
+// не подключён (resp.MFAEnrollmentRequired), ChallengeToken передаётся в
+// EnrollTwoFactor и ConfirmTwoFactor.
+func (c *Client) Login(ctx context.Context, req *UserLoginRequest) (*UserLoginResponse, error) {
+	r := newRequest(http.MethodPost, "/auth/login", req)
+	r.anonymous = true
+
+	var resp UserLoginResponse
+	if err := c.doJSON(ctx, r, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Token != "" {
+		c.setToken(resp.Token)
+	}
+	return &resp, nil
+}
+
+// LoginTwoFactor завершает вход кодом второго фактора и запоминает токен
+func (c *Client) LoginTwoFactor(ctx context.Context, req *LoginTwoFactorRequest) (*UserLoginResponse, error) {
+	r := newRequest(http.MethodPost, "/auth/login/2fa", req)
+	r.anonymous = true
+
+	var resp UserLoginResponse
+	if err := c.doJSON(ctx, r, &resp); err != nil {
+		return nil, err
+	}
+	c.setToken(resp.Token)
+	return &resp, nil
+}
+
+// ChangePassword меняет пароль текущего пользователя. После Login с
+// resp.PasswordChangeRequired передайте resp.ChallengeToken: вход продолжится,
+// и ответ будет как у Login (токен запоминается). С обычным токеном ответ nil.
+func (c *Client) ChangePassword(ctx context.Context, challengeToken string, req *ChangePasswordRequest) (*UserLoginResponse, error) {
+	r := newRequest(http.MethodPost, "/auth/password/change", req)
+	if challengeToken == "" {
+		return nil, c.doJSON(ctx, r, nil)
+	}
+	r.anonymous = true
+	r.bearer = challengeToken
+
+	var resp UserLoginResponse
+	if err := c.doJSON(ctx, r, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Token != "" {
+		c.setToken(resp.Token)
+	}
+	return &resp, nil
+}
+
+// ForgotPassword просит прислать ссылку для сброса пароля на подтверждённый
+// адрес. Сервер отвечает одинаково, есть такой пользователь или нет.
+func (c *Client) ForgotPassword(ctx context.Context, req *ForgotPasswordRequest) error {
+	r := newRequest(http.MethodPost, "/auth/password/forgot", req)
+	r.anonymous = true
+	return c.doJSON(ctx, r, nil)
+}
+
+// ResetPassword задаёт новый пароль по токену из письма. Токен не запоминается:
+// после сброса нужно войти заново.
+func (c *Client) ResetPassword(ctx context.Context, req *ResetPasswordRequest) error {
+	r := newRequest(http.MethodPost, "/auth/password/reset", req)
+	r.anonymous = true
+	return c.doJSON(ctx, r, nil)
+}
+
+// VerifyEmail подтверждает адрес по токену из письма
+func (c *Client) VerifyEmail(ctx context.Context, req *VerifyEmailRequest) error {
+	r := newRequest(http.MethodPost, "/auth/email/verify", req)
+	r.anonymous = true
+	return c.doJSON(ctx, r, nil)
+}
+
+// ResendVerification повторно отправляет письмо для подтверждения адреса текущего пользователя
+func (c *Client) ResendVerification(ctx context.Context) error {
+	return c.doJSON(ctx, newRequest(http.MethodPost, "/auth/email/verify/resend", nil), nil)
+}
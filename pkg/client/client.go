@@ -0,0 +1,355 @@
+// Package client — типизированный Go-клиент REST API терминалов.
+//
+//	c := client.New("https://txkm-vipos.uz/api", client.WithCredentials("login", "password"))
+//	status, err := c.GetTerminalStatus(ctx, 42)
+//
+// Клиент сам получает и обновляет JWT, повторяет идемпотентные запросы
+// с экспоненциальной задержкой и возвращает ошибки API как *APIError.
+// POST-запросы отправляются с заголовком Idempotency-Key, поэтому тоже
+// повторяются: сервер вернёт сохранённый ответ вместо повторного выполнения.
+package client
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin — за сколько до истечения токен обновляется заранее
+const tokenRefreshMargin = time.Minute
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+
+	maxRetries   int
+	retryBackoff time.Duration
+	maxBackoff   time.Duration
+
+	username string
+	password string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+type Option func(*Client)
+
+// WithHTTPClient задаёт свой http.Client (таймауты, транспорт, прокси)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithToken использует готовый токен. Без учётных данных он не обновляется.
+func WithToken(token string) Option {
+	return func(c *Client) { c.setToken(token) }
+}
+
+// WithCredentials позволяет клиенту самому входить в систему и
+// перевыпускать токен перед истечением или после ответа 401
+func WithCredentials(username, password string) Option {
+	return func(c *Client) { c.username, c.password = username, password }
+}
+
+// WithRetry настраивает повторы идемпотентных запросов: maxRetries повторов
+// с задержкой от backoff, удваивающейся до maxBackoff
+func WithRetry(maxRetries int, backoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries, c.retryBackoff, c.maxBackoff = maxRetries, backoff, maxBackoff
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// New создаёт клиент. baseURL включает префикс API, например https://host/api.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		userAgent:    "newNewTerminal-client",
+		maxRetries:   3,
+		retryBackoff: 200 * time.Millisecond,
+		maxBackoff:   5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token возвращает текущий токен (например, чтобы сохранить его между запусками)
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+type request struct {
+	method string
+	path   string
+	body   interface{}
+	// idempotent разрешает повтор запроса; по умолчанию — для GET, PUT и DELETE
+	idempotent bool
+	// anonymous — запрос без токена (вход и регистрация)
+	anonymous bool
+	// bearer — промежуточный токен входа вместо токена клиента
+	bearer string
+	// idempotencyKey — один на все попытки запроса, чтобы сервер узнал повтор
+	idempotencyKey string
+}
+
+func newRequest(method, path string, body interface{}) *request {
+	r := &request{
+		method:     method,
+		path:       path,
+		body:       body,
+		idempotent: method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete,
+	}
+	if method == http.MethodPost {
+		r.idempotencyKey = newIdempotencyKey()
+		r.idempotent = r.idempotencyKey != ""
+	}
+	return r
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	if _, err := cryptorand.Read(key); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(key)
+}
+
+// doJSON выполняет запрос и декодирует JSON-ответ в out (если out не nil)
+func (c *Client) doJSON(ctx context.Context, req *request, out interface{}) error {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// doFile выполняет запрос, отдающий файл
+func (c *Client) doFile(ctx context.Context, req *request) (*File, error) {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{ContentType: resp.Header.Get("Content-Type"), Data: data}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		file.Name = params["filename"]
+	}
+	return file, nil
+}
+
+// do отправляет запрос с авторизацией и повторами. При успехе тело ответа
+// должен закрыть вызывающий.
+func (c *Client) do(ctx context.Context, req *request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	reauthenticated := false
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		var apiErr *APIError
+		if err == nil {
+			apiErr = newAPIError(req, resp)
+			err = apiErr
+		} else {
+			// Ошибка входа при обновлении токена тоже приходит как *APIError
+			errors.As(err, &apiErr)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// Токен отозван или истёк раньше срока — входим заново один раз
+		if apiErr != nil && apiErr.StatusCode == http.StatusUnauthorized && !req.anonymous && !reauthenticated && c.hasCredentials() {
+			reauthenticated = true
+			c.setToken("")
+			attempt--
+			continue
+		}
+
+		if !req.idempotent || attempt >= c.maxRetries || !retryable(apiErr) {
+			return nil, err
+		}
+
+		delay := c.backoff(attempt)
+		if apiErr != nil && apiErr.RetryAfter > delay {
+			delay = apiErr.RetryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req *request, body []byte) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if req.idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", req.idempotencyKey)
+	}
+	httpReq.Header.Set("User-Agent", c.userAgent)
+
+	if req.bearer != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+req.bearer)
+	}
+	if !req.anonymous {
+		token, err := c.validToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	return c.httpClient.Do(httpReq)
+}
+
+// retryable: сетевые ошибки (apiErr == nil), перегрузка и недоступность сервера,
+// а также первая попытка того же запроса, которая на сервере ещё выполняется
+func retryable(apiErr *APIError) bool {
+	if apiErr == nil {
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusConflict:
+		return apiErr.Code == "idempotency_key_in_progress"
+	}
+	return false
+}
+
+// backoff — экспоненциальная задержка с полным джиттером
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.retryBackoff << attempt
+	if delay <= 0 || delay > c.maxBackoff {
+		delay = c.maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+func (c *Client) hasCredentials() bool {
+	return c.username != ""
+}
+
+// validToken возвращает действующий токен, при необходимости входя заново
+func (c *Client) validToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, expiry := c.token, c.tokenExpiry
+	c.mu.Unlock()
+
+	fresh := token != "" && (expiry.IsZero() || time.Until(expiry) > tokenRefreshMargin)
+	if fresh || !c.hasCredentials() {
+		return token, nil
+	}
+
+	resp, err := c.Login(ctx, &UserLoginRequest{Username: c.username, Password: c.password})
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh token: %w", err)
+	}
+	// Второй фактор и новый пароль без участия человека не ввести
+	if resp.PasswordChangeRequired {
+		return "", ErrPasswordChangeRequired
+	}
+	if resp.Token == "" {
+		return "", ErrTwoFactorRequired
+	}
+	return resp.Token, nil
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.tokenExpiry = tokenExpiry(token)
+}
+
+// tokenExpiry читает exp из JWT без проверки подписи — только чтобы знать,
+// когда обновить токен. Проверяет подпись сервер.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.ExpiresAt, 0)
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
@@ -0,0 +1,16 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// LookupCompany ищет компанию по ИНН (9 цифр) или физическое лицо по ПИНФЛ (14 цифр)
+func (c *Client) LookupCompany(ctx context.Context, taxID string) (*Company, error) {
+	var company Company
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, "/companies/"+url.PathEscape(taxID), nil), &company); err != nil {
+		return nil, err
+	}
+	return &company, nil
+}
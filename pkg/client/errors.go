@@ -0,0 +1,105 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrTwoFactorRequired — учётной записи нужен второй фактор, поэтому клиент
+// не может сам войти заново по логину и паролю. Войдите через Login и
+// LoginTwoFactor или передайте готовый токен через WithToken.
+var ErrTwoFactorRequired = errors.New("two-factor authentication required")
+
+// ErrPasswordChangeRequired — пароль задал администратор, и сервер не выдаст
+// токен, пока его не сменят через ChangePassword с ChallengeToken из Login
+var ErrPasswordChangeRequired = errors.New("password change required")
+
+// APIError — ответ сервера с кодом 4xx/5xx
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	// Message — поле error из ErrorResponse, либо текст ответа, если сервер
+	// ответил не JSON (например, прокси перед сервером)
+	Message string
+	// Code и Details приходят из ErrorResponse, если сервер их заполнил
+	Code    string
+	Details []ErrorDetail
+	// RequestID — из ErrorResponse или заголовка X-Request-ID; его стоит
+	// указывать, обращаясь в поддержку
+	RequestID  string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	return msg
+}
+
+func newAPIError(req *request, resp *http.Response) *APIError {
+	defer resp.Body.Close()
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     req.method,
+		Path:       req.path,
+		RequestID:  resp.Header.Get("X-Request-ID"),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var errResp ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+		apiErr.Message = errResp.Error
+		apiErr.Code = errResp.Code
+		apiErr.Details = errResp.Details
+		if errResp.RequestID != "" {
+			apiErr.RequestID = errResp.RequestID
+		}
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
+
+func hasStatus(err error, codes ...int) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func IsNotFound(err error) bool { return hasStatus(err, http.StatusNotFound) }
+
+func IsUnauthorized(err error) bool { return hasStatus(err, http.StatusUnauthorized) }
+
+func IsForbidden(err error) bool { return hasStatus(err, http.StatusForbidden) }
+
+func IsConflict(err error) bool { return hasStatus(err, http.StatusConflict) }
+
+func IsBadRequest(err error) bool { return hasStatus(err, http.StatusBadRequest) }
+
+// IsValidation — запрос не прошёл проверку (422); нарушения по полям — в APIError.Details
+func IsValidation(err error) bool { return hasStatus(err, http.StatusUnprocessableEntity) }
+
+func IsPreconditionFailed(err error) bool { return hasStatus(err, http.StatusPreconditionFailed) }
+
+// HasCode проверяет машиночитаемый код ошибки, например "terminal_not_found"
+func HasCode(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+func (c *Client) ExportXLSX(ctx context.Context, req *ExportRequest) (*File, error) {
+	return c.doFile(ctx, newRequest(http.MethodPost, "/export", req))
+}
+
+// ExportFleetXLSX выгружает многостраничную книгу по всему парку (только для администраторов)
+func (c *Client) ExportFleetXLSX(ctx context.Context, req *FleetExportRequest) (*File, error) {
+	return c.doFile(ctx, newRequest(http.MethodPost, "/export/fleet", req))
+}
+
+// ExportFleetPDF выгружает список терминалов в PDF (только для администраторов)
+func (c *Client) ExportFleetPDF(ctx context.Context, req *FleetExportRequest) (*File, error) {
+	return c.doFile(ctx, newRequest(http.MethodPost, "/export/fleet/pdf", req))
+}
+
+// ListExportAudit возвращает журнал выгрузок; limit <= 0 — значение сервера по умолчанию
+func (c *Client) ListExportAudit(ctx context.Context, limit int) ([]*ExportAuditEntry, error) {
+	path := "/export/audit"
+	if limit > 0 {
+		path = fmt.Sprintf("%s?limit=%d", path, limit)
+	}
+
+	var entries []*ExportAuditEntry
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, path, nil), &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+func (c *Client) CreateFiscalModule(ctx context.Context, req *FiscalModuleCreateRequest) (*FiscalModuleResponse, error) {
+	var module FiscalModuleResponse
+	if err := c.doJSON(ctx, newRequest(http.MethodPost, "/fiscal-modules", req), &module); err != nil {
+		return nil, err
+	}
+	return &module, nil
+}
+
+func (c *Client) GetFiscalModule(ctx context.Context, id int) (*FiscalModuleResponse, error) {
+	var module FiscalModuleResponse
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, fmt.Sprintf("/fiscal-modules/%d", id), nil), &module); err != nil {
+		return nil, err
+	}
+	return &module, nil
+}
+
+func (c *Client) ListFiscalModules(ctx context.Context) ([]*FiscalModuleResponse, error) {
+	var modules []*FiscalModuleResponse
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, "/fiscal-modules", nil), &modules); err != nil {
+		return nil, err
+	}
+	return modules, nil
+}
+
+func (c *Client) UpdateFiscalModule(ctx context.Context, id int, req *FiscalModuleUpdateRequest) (*FiscalModuleResponse, error) {
+	var module FiscalModuleResponse
+	if err := c.doJSON(ctx, newRequest(http.MethodPut, fmt.Sprintf("/fiscal-modules/%d", id), req), &module); err != nil {
+		return nil, err
+	}
+	return &module, nil
+}
+
+// DeleteFiscalModule мягко удаляет модуль (только для администраторов)
+func (c *Client) DeleteFiscalModule(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodDelete, fmt.Sprintf("/fiscal-modules/%d", id), nil), nil)
+}
+
+// RestoreFiscalModule восстанавливает удалённый модуль (только для администраторов)
+func (c *Client) RestoreFiscalModule(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodPost, fmt.Sprintf("/fiscal-modules/%d/restore", id), nil), nil)
+}
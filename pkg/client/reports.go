@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+func (c *Client) CreateReportSchedule(ctx context.Context, req *ReportScheduleCreateRequest) (*ReportSchedule, error) {
+	var schedule ReportSchedule
+	if err := c.doJSON(ctx, newRequest(http.MethodPost, "/reports/schedules", req), &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (c *Client) GetReportSchedule(ctx context.Context, id int) (*ReportSchedule, error) {
+	var schedule ReportSchedule
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, fmt.Sprintf("/reports/schedules/%d", id), nil), &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (c *Client) ListReportSchedules(ctx context.Context) ([]*ReportSchedule, error) {
+	var schedules []*ReportSchedule
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, "/reports/schedules", nil), &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (c *Client) UpdateReportSchedule(ctx context.Context, id int, req *ReportScheduleUpdateRequest) (*ReportSchedule, error) {
+	var schedule ReportSchedule
+	if err := c.doJSON(ctx, newRequest(http.MethodPut, fmt.Sprintf("/reports/schedules/%d", id), req), &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (c *Client) DeleteReportSchedule(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodDelete, fmt.Sprintf("/reports/schedules/%d", id), nil), nil)
+}
+
+// RunReportSchedule запускает отчёт немедленно и возвращает запись о запуске
+func (c *Client) RunReportSchedule(ctx context.Context, id int) (*ReportRun, error) {
+	var run ReportRun
+	if err := c.doJSON(ctx, newRequest(http.MethodPost, fmt.Sprintf("/reports/schedules/%d/run", id), nil), &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (c *Client) ListReportRuns(ctx context.Context, id int) ([]*ReportRun, error) {
+	var runs []*ReportRun
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, fmt.Sprintf("/reports/schedules/%d/runs", id), nil), &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CreateTerminal регистрирует терминал и активирует его фискальный модуль.
+// Запрос не повторяется автоматически: повтор после таймаута может
+// наткнуться на уже созданную привязку.
+func (c *Client) CreateTerminal(ctx context.Context, req *TerminalCreateRequest) (*Terminal, error) {
+	var terminal Terminal
+	if err := c.doJSON(ctx, newRequest(http.MethodPost, "/terminals", req), &terminal); err != nil {
+		return nil, err
+	}
+	return &terminal, nil
+}
+
+func (c *Client) GetTerminal(ctx context.Context, id int) (*Terminal, error) {
+	var terminal Terminal
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, fmt.Sprintf("/terminals/%d", id), nil), &terminal); err != nil {
+		return nil, err
+	}
+	return &terminal, nil
+}
+
+func (c *Client) ListTerminals(ctx context.Context) ([]*Terminal, error) {
+	var terminals []*Terminal
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, "/terminals", nil), &terminals); err != nil {
+		return nil, err
+	}
+	return terminals, nil
+}
+
+func (c *Client) UpdateTerminal(ctx context.Context, id int, req *TerminalUpdateRequest) (*Terminal, error) {
+	var terminal Terminal
+	if err := c.doJSON(ctx, newRequest(http.MethodPut, fmt.Sprintf("/terminals/%d", id), req), &terminal); err != nil {
+		return nil, err
+	}
+	return &terminal, nil
+}
+
+// PatchTerminal меняет только переданные поля (JSON Merge Patch), например
+// map[string]interface{}{"address": ""} очищает адрес
+func (c *Client) PatchTerminal(ctx context.Context, id int, patch map[string]interface{}) (*Terminal, error) {
+	var terminal Terminal
+	if err := c.doJSON(ctx, newRequest(http.MethodPatch, fmt.Sprintf("/terminals/%d", id), patch), &terminal); err != nil {
+		return nil, err
+	}
+	return &terminal, nil
+}
+
+// DeleteTerminal мягко удаляет терминал (только для администраторов)
+func (c *Client) DeleteTerminal(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodDelete, fmt.Sprintf("/terminals/%d", id), nil), nil)
+}
+
+// RestoreTerminal восстанавливает удалённый терминал (только для администраторов)
+func (c *Client) RestoreTerminal(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodPost, fmt.Sprintf("/terminals/%d/restore", id), nil), nil)
+}
+
+// TerminalExists ищет терминал по номеру кассы. Это POST, но запрос
+// ничего не меняет, поэтому повторяется как идемпотентный.
+func (c *Client) TerminalExists(ctx context.Context, cashRegisterNumber string) (*TerminalExistsResponse, error) {
+	r := newRequest(http.MethodPost, "/terminals/exists", &TerminalExistsRequest{CashRegisterNumber: cashRegisterNumber})
+	r.idempotent = true
+
+	var resp TerminalExistsResponse
+	if err := c.doJSON(ctx, r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetTerminalStatus(ctx context.Context, id int) (*TerminalStatusResponse, error) {
+	var resp TerminalStatusResponse
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, fmt.Sprintf("/terminals/status/%d", id), nil), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// TerminalCertificate скачивает PDF-акт активации фискального модуля
+func (c *Client) TerminalCertificate(ctx context.Context, id int) (*File, error) {
+	return c.doFile(ctx, newRequest(http.MethodGet, fmt.Sprintf("/terminals/%d/certificate", id), nil))
+}
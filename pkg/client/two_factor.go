@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// TwoFactorStatus сообщает, включён ли второй фактор у текущего пользователя
+// и сколько осталось кодов восстановления
+func (c *Client) TwoFactorStatus(ctx context.Context) (*TwoFactorStatus, error) {
+	var status TwoFactorStatus
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, "/auth/2fa", nil), &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// EnrollTwoFactor выпускает новый секрет TOTP. После Login с
+// resp.MFAEnrollmentRequired передайте resp.ChallengeToken, иначе пустую строку.
+func (c *Client) EnrollTwoFactor(ctx context.Context, challengeToken string) (*TwoFactorEnrollResponse, error) {
+	r := newRequest(http.MethodPost, "/auth/2fa/enroll", nil)
+	if challengeToken != "" {
+		r.anonymous = true
+		r.bearer = challengeToken
+	}
+
+	var resp TwoFactorEnrollResponse
+	if err := c.doJSON(ctx, r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ConfirmTwoFactor включает второй фактор первым кодом из приложения и
+// возвращает коды восстановления. С challengeToken из EnrollTwoFactor вход
+// завершается: токен из ответа запоминается.
+func (c *Client) ConfirmTwoFactor(ctx context.Context, challengeToken string, req *TwoFactorCodeRequest) (*TwoFactorConfirmResponse, error) {
+	r := newRequest(http.MethodPost, "/auth/2fa/confirm", req)
+	if challengeToken != "" {
+		r.anonymous = true
+		r.bearer = challengeToken
+	}
+
+	var resp TwoFactorConfirmResponse
+	if err := c.doJSON(ctx, r, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Token != "" {
+		c.setToken(resp.Token)
+	}
+	return &resp, nil
+}
+
+// DisableTwoFactor отключает второй фактор текущим кодом
+func (c *Client) DisableTwoFactor(ctx context.Context, req *TwoFactorCodeRequest) error {
+	return c.doJSON(ctx, newRequest(http.MethodPost, "/auth/2fa/disable", req), nil)
+}
+
+// RegenerateRecoveryCodes заменяет все коды восстановления новыми
+func (c *Client) RegenerateRecoveryCodes(ctx context.Context, req *TwoFactorCodeRequest) ([]string, error) {
+	var resp RecoveryCodesResponse
+	if err := c.doJSON(ctx, newRequest(http.MethodPost, "/auth/2fa/recovery-codes", req), &resp); err != nil {
+		return nil, err
+	}
+	return resp.RecoveryCodes, nil
+}
@@ -0,0 +1,59 @@
+package client
+
+import "github.com/idkOybek/newNewTerminal/internal/models"
+
+// Псевдонимы делают типы запросов и ответов сервера доступными за пределами
+// модуля, где internal/models импортировать нельзя
+
+type (
+	ErrorResponse = models.ErrorResponse
+	ErrorDetail   = models.ErrorDetail
+
+	User              = models.User
+	UserCreateRequest = models.UserCreateRequest
+	UserUpdateRequest = models.UserUpdateRequest
+	UserLoginRequest  = models.UserLoginRequest
+	UserLoginResponse = models.UserLoginResponse
+
+	LoginTwoFactorRequest    = models.LoginTwoFactorRequest
+	TwoFactorStatus          = models.TwoFactorStatus
+	TwoFactorEnrollResponse  = models.TwoFactorEnrollResponse
+	TwoFactorCodeRequest     = models.TwoFactorCodeRequest
+	TwoFactorConfirmResponse = models.TwoFactorConfirmResponse
+	RecoveryCodesResponse    = models.RecoveryCodesResponse
+
+	ChangePasswordRequest = models.ChangePasswordRequest
+	ForgotPasswordRequest = models.ForgotPasswordRequest
+	ResetPasswordRequest  = models.ResetPasswordRequest
+	VerifyEmailRequest    = models.VerifyEmailRequest
+
+	FiscalModuleCreateRequest = models.FiscalModuleCreateRequest
+	FiscalModuleUpdateRequest = models.FiscalModuleUpdateRequest
+	FiscalModuleResponse      = models.FiscalModuleResponse
+
+	Terminal               = models.Terminal
+	TerminalCreateRequest  = models.TerminalCreateRequest
+	TerminalUpdateRequest  = models.TerminalUpdateRequest
+	TerminalExistsRequest  = models.TerminalExistsRequest
+	TerminalExistsResponse = models.TerminalExistsResponse
+	TerminalStatusResponse = models.TerminalStatusResponse
+
+	ExportRequest      = models.ExportRequest
+	FleetExportRequest = models.FleetExportRequest
+	ExportAuditEntry   = models.ExportAuditEntry
+
+	ReportFilters               = models.ReportFilters
+	ReportSchedule              = models.ReportSchedule
+	ReportScheduleCreateRequest = models.ReportScheduleCreateRequest
+	ReportScheduleUpdateRequest = models.ReportScheduleUpdateRequest
+	ReportRun                   = models.ReportRun
+
+	Company = models.Company
+)
+
+// File — файл, отданный сервером (XLSX, PDF)
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
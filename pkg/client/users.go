@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+func (c *Client) GetUser(ctx context.Context, id int) (*User, error) {
+	var user User
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, fmt.Sprintf("/users/%d", id), nil), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) ListUsers(ctx context.Context) ([]*User, error) {
+	var users []*User
+	if err := c.doJSON(ctx, newRequest(http.MethodGet, "/users", nil), &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (c *Client) UpdateUser(ctx context.Context, id int, req *UserUpdateRequest) (*User, error) {
+	var user User
+	if err := c.doJSON(ctx, newRequest(http.MethodPut, fmt.Sprintf("/users/%d", id), req), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// PatchUser меняет только переданные поля (JSON Merge Patch)
+func (c *Client) PatchUser(ctx context.Context, id int, patch map[string]interface{}) (*User, error) {
+	var user User
+	if err := c.doJSON(ctx, newRequest(http.MethodPatch, fmt.Sprintf("/users/%d", id), patch), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser мягко удаляет пользователя (только для администраторов)
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodDelete, fmt.Sprintf("/users/%d", id), nil), nil)
+}
+
+// UnlockUser снимает блокировку входа после неудачных попыток (только для администраторов)
+func (c *Client) UnlockUser(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodPost, fmt.Sprintf("/users/%d/unlock", id), nil), nil)
+}
+
+// ResetUserTwoFactor отключает второй фактор пользователя, потерявшего
+// приложение и коды восстановления (только для администраторов)
+func (c *Client) ResetUserTwoFactor(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodPost, fmt.Sprintf("/users/%d/2fa/reset", id), nil), nil)
+}
+
+// RestoreUser восстанавливает удалённого пользователя (только для администраторов)
+func (c *Client) RestoreUser(ctx context.Context, id int) error {
+	return c.doJSON(ctx, newRequest(http.MethodPost, fmt.Sprintf("/users/%d/restore", id), nil), nil)
+}
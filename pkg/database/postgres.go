@@ -1,18 +1,68 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func NewPostgresDB(dataSourceName string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", dataSourceName)
+// Pool — ограничения пула соединений. Для MaxOpenConns и времён 0 — без ограничений,
+// MaxIdleConns = 0 — простаивающие соединения не хранятся.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Apply можно вызывать на работающем пуле: database/sql применяет лимиты на лету
+func (p Pool) Apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// NewPostgresDB открывает пул соединений, в котором каждый запрос
+// становится спаном OpenTelemetry с текстом SQL
+func NewPostgresDB(dataSourceName string, pool Pool) (*sql.DB, error) {
+	db, err := otelsql.Open("postgres", dataSourceName,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanNameFormatter(spanName),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
 		return nil, err
 	}
+	pool.Apply(db)
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
+
+var sqlTable = regexp.MustCompile(`(?i)\b(?:from|into|update)\s+([a-z_][a-z0-9_]*)`)
+
+// spanName называет спан по операции и таблице ("SELECT terminals"),
+// чтобы в трассе было видно, какой запрос занял время
+func spanName(_ context.Context, method otelsql.Method, query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return string(method)
+	}
+	name := strings.ToUpper(fields[0])
+	if match := sqlTable.FindStringSubmatch(query); match != nil {
+		name += " " + match[1]
+	}
+	return name
+}
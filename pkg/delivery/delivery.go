@@ -0,0 +1,16 @@
+package delivery
+
+import "context"
+
+// File — готовый к отправке файл отчёта
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Deliverer доставляет файл по адресу target и возвращает итоговое
+// расположение (путь, список адресов, URL) для истории запусков
+type Deliverer interface {
+	Deliver(ctx context.Context, target string, file *File) (string, error)
+}
@@ -0,0 +1,41 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type DirectoryDeliverer struct {
+	baseDir string
+}
+
+func NewDirectoryDeliverer(baseDir string) *DirectoryDeliverer {
+	return &DirectoryDeliverer{baseDir: baseDir}
+}
+
+// Deliver сохраняет файл в baseDir/target; target не может выходить за пределы baseDir
+func (d *DirectoryDeliverer) Deliver(ctx context.Context, target string, file *File) (string, error) {
+	if d.baseDir == "" {
+		return "", fmt.Errorf("reports directory is not configured")
+	}
+
+	dir := filepath.Join(d.baseDir, filepath.Clean("/"+target))
+	base := filepath.Clean(d.baseDir)
+	if dir != base && !strings.HasPrefix(dir, base+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid target directory %q", target)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	path := filepath.Join(dir, filepath.Base(file.Name))
+	if err := os.WriteFile(path, file.Data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return path, nil
+}
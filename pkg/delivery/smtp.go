@@ -0,0 +1,46 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/idkOybek/newNewTerminal/pkg/mail"
+)
+
+type EmailDeliverer struct {
+	mailer *mail.Mailer
+}
+
+func NewEmailDeliverer(mailer *mail.Mailer) *EmailDeliverer {
+	return &EmailDeliverer{mailer: mailer}
+}
+
+// Deliver отправляет файл вложением; target — адреса через запятую
+func (d *EmailDeliverer) Deliver(ctx context.Context, target string, file *File) (string, error) {
+	var recipients []string
+	for _, addr := range strings.Split(target, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			recipients = append(recipients, addr)
+		}
+	}
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("no email recipients")
+	}
+
+	msg := &mail.Message{
+		To:      recipients,
+		Subject: "Отчёт " + file.Name,
+		Body:    "Отчёт сформирован автоматически по расписанию.",
+		Attachments: []mail.Attachment{{
+			Filename:    file.Name,
+			ContentType: file.ContentType,
+			Data:        file.Data,
+		}},
+	}
+	if err := d.mailer.Send(ctx, msg); err != nil {
+		return "", fmt.Errorf("failed to send report email: %w", err)
+	}
+
+	return strings.Join(recipients, ", "), nil
+}
@@ -0,0 +1,74 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// sharedAddressSpace — 100.64.0.0/10 (CGNAT), net.IP.IsPrivate его не учитывает
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+type WebhookDeliverer struct {
+	client *http.Client
+}
+
+// NewWebhookDeliverer: соединения с внутренними адресами запрещены. Адрес
+// проверяется при подключении, уже после DNS, поэтому подмена записи между
+// проверкой и запросом (DNS rebinding) и редиректы не помогают обойти запрет.
+func NewWebhookDeliverer(timeout time.Duration) *WebhookDeliverer {
+	dialer := &net.Dialer{Timeout: timeout, Control: publicOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// через прокси проверялся бы адрес прокси, а не получателя
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &WebhookDeliverer{client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+// publicOnly отклоняет подключение к loopback, частным, link-local и прочим
+// непубличным адресам
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// Deliver отправляет файл POST-запросом на URL из target
+func (d *WebhookDeliverer) Deliver(ctx context.Context, target string, file *File) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid webhook url %q", target)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(file.Data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", file.ContentType)
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fieldsKey struct{}
+
+// fields — поля, привязанные к запросу. Набор изменяемый: номер кассы, который
+// сервис узнаёт глубоко в стеке, попадает и в строку access-лога.
+type fields struct {
+	mu     sync.Mutex
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewContext начинает пустой набор полей; вызывается один раз на запрос
+func NewContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fields{values: make(map[string]interface{})})
+}
+
+// WithFields добавляет пары ключ/значение ко всем записям через Ctx(ctx).
+// Повторный ключ заменяет прежнее значение. Если набора в ctx нет, создаёт его.
+func WithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		ctx = NewContext(ctx)
+		f = ctx.Value(fieldsKey{}).(*fields)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			continue
+		}
+		if _, exists := f.values[key]; !exists {
+			f.keys = append(f.keys, key)
+		}
+		f.values[key] = keysAndValues[i+1]
+	}
+	return ctx
+}
+
+func fieldsFrom(ctx context.Context) []interface{} {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	args := make([]interface{}, 0, 2*len(f.keys))
+	for _, key := range f.keys {
+		args = append(args, key, f.values[key])
+	}
+	return args
+}
+
+// Ctx добавляет к записям поля запроса (request_id, user_id, номер кассы),
+// шаблон маршрута chi, а также trace_id и span_id текущего спана.
+// Без всего этого в ctx возвращает тот же логгер.
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	args := fieldsFrom(ctx)
+
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if route := rctx.RoutePattern(); route != "" {
+			args = append(args, "route", route)
+		}
+	}
+
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+		args = append(args, "trace_id", spanCtx.TraceID().String(), "span_id", spanCtx.SpanID().String())
+	}
+
+	if len(args) == 0 {
+		return l
+	}
+	return &Logger{SugaredLogger: l.With(args...), level: l.level}
+}
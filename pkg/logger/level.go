@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelStatus — текущий уровень и, если он временный, когда и к какому уровню он вернётся
+type LevelStatus struct {
+	Level     string
+	RevertTo  string
+	ExpiresAt time.Time
+}
+
+type levelControl struct {
+	atomic zap.AtomicLevel
+
+	mu        sync.Mutex
+	timer     *time.Timer
+	revertTo  zapcore.Level
+	expiresAt time.Time
+}
+
+// set с ttl = 0 задаёт постоянный уровень
+func (c *levelControl) set(level zapcore.Level, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	} else if ttl > 0 {
+		c.revertTo = c.atomic.Level()
+	}
+
+	c.atomic.SetLevel(level)
+	if ttl <= 0 {
+		c.expiresAt = time.Time{}
+		return
+	}
+
+	c.expiresAt = time.Now().Add(ttl)
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// Таймер мог быть заменён новым вызовом set, пока ждал блокировку
+		if c.timer != timer {
+			return
+		}
+		c.atomic.SetLevel(c.revertTo)
+		c.timer = nil
+		c.expiresAt = time.Time{}
+	})
+	c.timer = timer
+}
+
+func (c *levelControl) status() LevelStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := LevelStatus{Level: c.atomic.Level().String()}
+	if c.timer != nil {
+		status.RevertTo = c.revertTo.String()
+		status.ExpiresAt = c.expiresAt
+	}
+	return status
+}
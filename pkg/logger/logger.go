@@ -1,12 +1,16 @@
 package logger
 
 import (
+	"fmt"
+	"time"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 type Logger struct {
 	*zap.SugaredLogger
+	level *levelControl
 }
 
 func NewLogger(level string) (*Logger, error) {
@@ -16,8 +20,9 @@ func NewLogger(level string) (*Logger, error) {
 		return nil, err
 	}
 
+	control := &levelControl{atomic: zap.NewAtomicLevelAt(zapLevel)}
 	config := zap.Config{
-		Level:             zap.NewAtomicLevelAt(zapLevel),
+		Level:             control.atomic,
 		Development:       false,
 		DisableCaller:     false,
 		DisableStacktrace: false,
@@ -37,15 +42,34 @@ func NewLogger(level string) (*Logger, error) {
 	}
 
 	sugar := logger.Sugar()
-	return &Logger{sugar}, nil
+	return &Logger{SugaredLogger: sugar, level: control}, nil
 }
 
+// SetLevel меняет уровень логирования на лету для всех логгеров, полученных
+// из этого через Ctx/With, и отменяет временный уровень, если он был задан
 func (l *Logger) SetLevel(level string) error {
 	zapLevel, err := zapcore.ParseLevel(level)
 	if err != nil {
 		return err
 	}
+	l.level.set(zapLevel, 0)
+	return nil
+}
 
-	l.SugaredLogger.Desugar().Core().Enabled(zapLevel)
+// SetLevelFor временно меняет уровень: через ttl вернётся уровень, действовавший
+// до первого временного изменения
+func (l *Logger) SetLevelFor(level string, ttl time.Duration) error {
+	zapLevel, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive, got %s", ttl)
+	}
+	l.level.set(zapLevel, ttl)
 	return nil
 }
+
+func (l *Logger) Level() LevelStatus {
+	return l.level.status()
+}
@@ -0,0 +1,44 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// CheckColumns сверяет живую схему с колонками, которые ожидает код.
+// Возвращает отсутствующие колонки в виде "table.column".
+func CheckColumns(ctx context.Context, db *sql.DB, expected map[string][]string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT table_name, column_name
+        FROM information_schema.columns
+        WHERE table_schema = current_schema()`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	live := make(map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, err
+		}
+		live[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for table, columns := range expected {
+		for _, column := range columns {
+			if !live[table+"."+column] {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
@@ -0,0 +1,371 @@
+// Package migrate применяет SQL-миграции из fs.FS к Postgres.
+// Версия схемы хранится в таблице schema_migrations(version, dirty) в том же
+// формате, что и у golang-migrate, поэтому базы, размеченные этим
+// инструментом, подхватываются без конвертации.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+	"github.com/lib/pq"
+)
+
+// NilVersion — версия пустой базы, к которой не применена ни одна миграция
+const NilVersion int64 = -1
+
+// undefinedTable — код ошибки Postgres "relation does not exist"
+const undefinedTable = "42P01"
+
+// lockKey — ключ advisory-блокировки, чтобы реплики не мигрировали базу одновременно
+const lockKey = 7305937412
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	HasUp   bool
+	HasDown bool
+}
+
+type Status struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+	Dirty   bool   `json:"dirty"`
+}
+
+// ErrDirty возвращается, если прошлая миграция упала посередине
+type ErrDirty struct {
+	Version int64
+}
+
+func (e ErrDirty) Error() string {
+	return fmt.Sprintf("database is dirty at version %d: fix the schema manually and run 'migrate force <version>'", e.Version)
+}
+
+// Load читает миграции из каталога dir. Файлы с неподходящими именами
+// считаются ошибкой, чтобы опечатка не превращалась в пропущенную миграцию.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unrecognised migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", entry.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+			m.HasUp = true
+		} else {
+			m.Down = string(body)
+			m.HasDown = true
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for _, m := range migrations {
+		if !m.HasUp {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+	}
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	logger     *logger.Logger
+}
+
+func New(db *sql.DB, fsys fs.FS, dir string, logger *logger.Logger) (*Migrator, error) {
+	migrations, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, logger: logger}, nil
+}
+
+// Latest возвращает номер последней встроенной миграции
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return NilVersion
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version возвращает текущую версию схемы. Запрос только читает: его делают
+// проверки готовности, которым не нужны ни блокировка, ни право CREATE.
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	return readVersion(ctx, m.db)
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+			Applied: version != NilVersion && migration.Version <= version,
+			Dirty:   dirty && migration.Version == version,
+		})
+	}
+	return statuses, nil
+}
+
+// Up применяет n следующих миграций, при n <= 0 — все недостающие
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var applied []Migration
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty{Version: version}
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+			if n > 0 && len(applied) == n {
+				break
+			}
+			if err := m.apply(ctx, conn, migration.Version, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			m.logger.Infow("Applied migration", "version", migration.Version, "name", migration.Name)
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает n последних применённых миграций, при n <= 0 — все
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty{Version: version}
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if migration.Version > version {
+				continue
+			}
+			if n > 0 && len(reverted) == n {
+				break
+			}
+			if !migration.HasDown {
+				return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+			}
+
+			target := NilVersion
+			if i > 0 {
+				target = m.migrations[i-1].Version
+			}
+			if err := m.apply(ctx, conn, target, migration.Down); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			m.logger.Infow("Reverted migration", "version", migration.Version, "name", migration.Name)
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Redo откатывает и заново применяет последнюю миграцию
+func (m *Migrator) Redo(ctx context.Context) error {
+	reverted, err := m.Down(ctx, 1)
+	if err != nil {
+		return err
+	}
+	if len(reverted) == 0 {
+		return errors.New("no applied migrations to redo")
+	}
+	_, err = m.Up(ctx, 1)
+	return err
+}
+
+// Force выставляет версию без выполнения миграций и снимает флаг dirty
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != NilVersion && !m.known(version) {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+	return m.withConn(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := writeVersion(ctx, tx, version, false); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// apply помечает базу грязной на целевой версии, выполняет SQL в транзакции
+// и в той же транзакции снимает флаг. Если миграция упала, база остаётся
+// dirty до ручного вмешательства — так же ведёт себя golang-migrate.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, target int64, body string) error {
+	if err := setVersion(ctx, conn, target, true); err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if strings.TrimSpace(body) != "" {
+		if _, err := tx.ExecContext(ctx, body); err != nil {
+			return fmt.Errorf("%w (database left dirty at version %d)", err, target)
+		}
+	}
+	if err := writeVersion(ctx, tx, target, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withConn выполняет fn на выделенном соединении под advisory-блокировкой,
+// которую держит именно это соединение, и при необходимости создаёт
+// schema_migrations
+func (m *Migrator) withConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version BIGINT NOT NULL PRIMARY KEY,
+            dirty BOOLEAN NOT NULL
+        )`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	return fn(conn)
+}
+
+// queryRower — *sql.DB, *sql.Conn или *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// readVersion: нет строки или самой таблицы schema_migrations — база ещё не мигрирована
+func readVersion(ctx context.Context, q queryRower) (int64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := q.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	var pqErr *pq.Error
+	if errors.Is(err, sql.ErrNoRows) || errors.As(err, &pqErr) && pqErr.Code == undefinedTable {
+		return NilVersion, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, dirty, nil
+}
+
+func setVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := writeVersion(ctx, tx, version, dirty); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeVersion(ctx context.Context, tx *sql.Tx, version int64, dirty bool) error {
+	if _, err := tx.ExecContext(ctx, `TRUNCATE schema_migrations`); err != nil {
+		return fmt.Errorf("failed to reset schema version: %w", err)
+	}
+	// Как и golang-migrate, пустая база без флага dirty не хранит строку вовсе
+	if version == NilVersion && !dirty {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty); err != nil {
+		return fmt.Errorf("failed to write schema version: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileNotifier складывает сообщения в каталог, по файлу на сообщение.
+// Только для разработки: в файлах действующие токены.
+type FileNotifier struct {
+	dir string
+}
+
+func NewFileNotifier(dir string) *FileNotifier {
+	return &FileNotifier{dir: dir}
+}
+
+func (n *FileNotifier) Notify(_ context.Context, msg *Message) error {
+	if err := os.MkdirAll(n.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create notifications directory: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix) + ".txt"
+
+	content := fmt.Sprintf("To: %s\nPhone: %s\nSubject: %s\n\n%s\n", msg.Email, msg.Phone, msg.Subject, msg.Body)
+	if err := os.WriteFile(filepath.Join(n.dir, name), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/idkOybek/newNewTerminal/pkg/logger"
+)
+
+// LogNotifier пишет сообщения в лог. Только для разработки: в логе
+// оказываются действующие токены.
+type LogNotifier struct {
+	logger *logger.Logger
+}
+
+func NewLogNotifier(logger *logger.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg *Message) error {
+	n.logger.Ctx(ctx).Infow("Notification",
+		"email", msg.Email,
+		"phone", msg.Phone,
+		"subject", msg.Subject,
+		"body", msg.Body,
+	)
+	return nil
+}
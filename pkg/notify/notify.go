@@ -0,0 +1,18 @@
+// Package notify доставляет пользователям служебные сообщения: ссылки для
+// сброса пароля и подтверждения почты. В разработке вместо почты сообщения
+// можно складывать в файлы или писать в лог.
+package notify
+
+import "context"
+
+// Message — сообщение одному получателю
+type Message struct {
+	Email   string
+	Phone   string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg *Message) error
+}
@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/idkOybek/newNewTerminal/pkg/mail"
+)
+
+type SMTPNotifier struct {
+	mailer *mail.Mailer
+}
+
+func NewSMTPNotifier(mailer *mail.Mailer) *SMTPNotifier {
+	return &SMTPNotifier{mailer: mailer}
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, msg *Message) error {
+	if msg.Email == "" {
+		return errors.New("recipient has no email address")
+	}
+
+	err := n.mailer.Send(ctx, &mail.Message{
+		To:      []string{msg.Email},
+		Subject: msg.Subject,
+		Body:    msg.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// List — утёкшие пароли из локального файла, по одному в строке. Строка из
+// 40 шестнадцатеричных символов (можно с ":count", как в выгрузке Have I Been
+// Pwned) считается SHA-1 пароля, остальные — самим паролем. Строки с # и
+// пустые пропускаются.
+type List struct {
+	plain map[string]struct{}
+	sha1  map[string]struct{}
+}
+
+func LoadList(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password list: %w", err)
+	}
+	defer f.Close()
+
+	l := &List{plain: make(map[string]struct{}), sha1: make(map[string]struct{})}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1(hash) {
+			l.sha1[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		l.plain[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password list: %w", err)
+	}
+	return l, nil
+}
+
+// Contains — есть ли пароль в списке; nil-список пуст
+func (l *List) Contains(password string) bool {
+	if l == nil {
+		return false
+	}
+	if _, ok := l.plain[password]; ok {
+		return true
+	}
+	sum := sha1.Sum([]byte(password))
+	_, ok := l.sha1[strings.ToUpper(hex.EncodeToString(sum[:]))]
+	return ok
+}
+
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.plain) + len(l.sha1)
+}
+
+func isSHA1(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,80 @@
+// Package password — правила для новых паролей: классы символов и список
+// утёкших паролей. Длину и повторы проверяет сервис по своей политике.
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Class — класс символов, который должен встретиться в пароле
+type Class string
+
+const (
+	Lower  Class = "lower"
+	Upper  Class = "upper"
+	Digit  Class = "digit"
+	Symbol Class = "symbol"
+)
+
+// ParseClasses разбирает список вида "lower,upper,digit"; пустая строка — без требований
+func ParseClasses(spec string) ([]Class, error) {
+	var classes []Class
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		switch c := Class(part); c {
+		case Lower, Upper, Digit, Symbol:
+			classes = append(classes, c)
+		default:
+			return nil, fmt.Errorf("unknown character class %q, want lower, upper, digit or symbol", part)
+		}
+	}
+	return classes, nil
+}
+
+// Missing возвращает классы из required, которых нет в password
+func Missing(password string, required []Class) []Class {
+	var missing []Class
+	for _, c := range required {
+		if !strings.ContainsFunc(password, c.matches) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+func (c Class) matches(r rune) bool {
+	switch c {
+	case Lower:
+		return unicode.IsLower(r)
+	case Upper:
+		return unicode.IsUpper(r)
+	case Digit:
+		return unicode.IsDigit(r)
+	case Symbol:
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	}
+	return false
+}
+
+// Describe — классы для сообщения об ошибке: "a lowercase letter, a digit"
+func Describe(classes []Class) string {
+	names := make([]string, 0, len(classes))
+	for _, c := range classes {
+		switch c {
+		case Lower:
+			names = append(names, "a lowercase letter")
+		case Upper:
+			names = append(names, "an uppercase letter")
+		case Digit:
+			names = append(names, "a digit")
+		case Symbol:
+			names = append(names, "a symbol")
+		}
+	}
+	return strings.Join(names, ", ")
+}
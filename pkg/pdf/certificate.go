@@ -0,0 +1,86 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+)
+
+// Certificate — данные акта активации фискального модуля на терминале
+type Certificate struct {
+	Number             string
+	CompanyName        string
+	INN                string
+	Address            string
+	AssemblyNumber     string
+	CashRegisterNumber string
+	ModuleNumber       string
+	FiscalNumber       string
+	ActivatedAt        time.Time
+	StatusURL          string
+}
+
+func WriteCertificate(w io.Writer, c *Certificate, opts Options) error {
+	pdf := newDocument("P")
+	pdf.SetTitle("Акт активации "+c.Number, true)
+	opts.apply(pdf)
+	pdf.SetFooterFunc(func() { opts.drawStamp(pdf) })
+	pdf.AddPage()
+
+	pdf.SetFont(fontFamily, "B", 16)
+	pdf.CellFormat(0, 10, "АКТ АКТИВАЦИИ ФИСКАЛЬНОГО МОДУЛЯ", "", 1, "C", false, 0, "")
+	pdf.SetFont(fontFamily, "", 11)
+	pdf.CellFormat(0, 7, fmt.Sprintf("№ %s от %s", c.Number, c.ActivatedAt.Format("02.01.2006")), "", 1, "C", false, 0, "")
+	pdf.Ln(8)
+
+	fields := [][2]string{
+		{"Компания", c.CompanyName},
+		{"ИНН", c.INN},
+		{"Адрес", c.Address},
+		{"Номер сборки", c.AssemblyNumber},
+		{"Номер кассового аппарата", c.CashRegisterNumber},
+		{"Номер модуля", c.ModuleNumber},
+		{"Фискальный номер", c.FiscalNumber},
+		{"Дата активации", c.ActivatedAt.Format("02.01.2006 15:04")},
+	}
+
+	const labelWidth = 65.0
+	valueWidth := 180.0 - labelWidth
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		pdf.SetFont(fontFamily, "B", 11)
+		pdf.CellFormat(labelWidth, 8, field[0], "1", 0, "L", false, 0, "")
+		pdf.SetFont(fontFamily, "", 11)
+		pdf.CellFormat(valueWidth, 8, fitText(pdf, field[1], valueWidth-2), "1", 1, "L", false, 0, "")
+	}
+
+	if c.StatusURL != "" {
+		png, err := qrcode.Encode(c.StatusURL, qrcode.Medium, 512)
+		if err != nil {
+			return fmt.Errorf("failed to generate QR code: %w", err)
+		}
+
+		pdf.Ln(10)
+		y := pdf.GetY()
+		pdf.RegisterImageOptionsReader("status_qr", fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+		pdf.ImageOptions("status_qr", 15, y, 40, 40, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, c.StatusURL)
+
+		pdf.SetXY(60, y+12)
+		pdf.SetFont(fontFamily, "", 10)
+		pdf.MultiCell(135, 5, "Отсканируйте QR-код, чтобы проверить статус терминала:\n"+c.StatusURL, "", "L", false)
+		pdf.SetY(y + 45)
+	}
+
+	pdf.Ln(15)
+	pdf.SetFont(fontFamily, "", 11)
+	pdf.CellFormat(90, 8, "Исполнитель: ____________________", "", 0, "L", false, 0, "")
+	pdf.CellFormat(90, 8, "Заказчик: ____________________", "", 1, "L", false, 0, "")
+
+	return pdf.Output(w)
+}
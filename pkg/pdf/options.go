@@ -0,0 +1,30 @@
+package pdf
+
+import "github.com/go-pdf/fpdf"
+
+type Options struct {
+	// Password требуется для открытия документа
+	Password string
+	// Stamp печатается внизу каждой страницы
+	Stamp string
+}
+
+func (o Options) apply(pdf *fpdf.Fpdf) {
+	if o.Password != "" {
+		pdf.SetProtection(fpdf.CnProtectPrint, o.Password, "")
+	}
+	if o.Stamp != "" {
+		pdf.SetSubject(o.Stamp, true)
+	}
+}
+
+func (o Options) drawStamp(pdf *fpdf.Fpdf) {
+	if o.Stamp == "" {
+		return
+	}
+	pdf.SetY(-8)
+	pdf.SetFont(fontFamily, "", 7)
+	pdf.SetTextColor(128, 128, 128)
+	pdf.CellFormat(0, 4, o.Stamp, "", 0, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+}
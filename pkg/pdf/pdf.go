@@ -0,0 +1,40 @@
+package pdf
+
+import (
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Шрифты семейства Go содержат кириллицу, поэтому документы не зависят
+// от шрифтов, установленных на сервере
+const fontFamily = "Go"
+
+func newDocument(orientation string) *fpdf.Fpdf {
+	pdf := fpdf.New(orientation, "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(fontFamily, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(fontFamily, "B", gobold.TTF)
+	pdf.SetFont(fontFamily, "", 10)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AliasNbPages("")
+	return pdf
+}
+
+// fitText обрезает строку так, чтобы она поместилась в ширину ячейки
+func fitText(pdf *fpdf.Fpdf, text string, width float64) string {
+	const ellipsis = "…"
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := string(runes) + ellipsis
+		if pdf.GetStringWidth(candidate) <= width {
+			return candidate
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// Table — табличный отчёт; строки должны иметь столько же ячеек, сколько заголовков
+type Table struct {
+	Title       string
+	Headers     []string
+	Rows        [][]string
+	GeneratedAt time.Time
+}
+
+func WriteTable(w io.Writer, t *Table, opts Options) error {
+	if len(t.Headers) == 0 {
+		return fmt.Errorf("table has no columns")
+	}
+
+	pdf := newDocument("L")
+	pdf.SetTitle(t.Title, true)
+	opts.apply(pdf)
+
+	generatedAt := t.GeneratedAt
+	if generatedAt.IsZero() {
+		generatedAt = time.Now()
+	}
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-14)
+		pdf.SetFont(fontFamily, "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("%s — %s — стр. %d/{nb}", t.Title, generatedAt.Format("02.01.2006 15:04"), pdf.PageNo()), "", 0, "C", false, 0, "")
+		opts.drawStamp(pdf)
+	})
+
+	widths := columnWidths(t, 267)
+
+	header := func() {
+		pdf.SetFont(fontFamily, "B", 8)
+		pdf.SetFillColor(221, 235, 247)
+		for i, title := range t.Headers {
+			pdf.CellFormat(widths[i], 7, fitText(pdf, title, widths[i]-1), "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont(fontFamily, "", 8)
+	}
+
+	pdf.AddPage()
+	pdf.SetFont(fontFamily, "B", 14)
+	pdf.CellFormat(0, 10, t.Title, "", 1, "L", false, 0, "")
+	header()
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	for _, row := range t.Rows {
+		if pdf.GetY()+6 > pageHeight-bottom {
+			pdf.AddPage()
+			header()
+		}
+		for i := range t.Headers {
+			var value string
+			if i < len(row) {
+				value = row[i]
+			}
+			pdf.CellFormat(widths[i], 6, fitText(pdf, value, widths[i]-1), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	return pdf.Output(w)
+}
+
+// columnWidths распределяет ширину страницы пропорционально длине содержимого
+func columnWidths(t *Table, total float64) []float64 {
+	const minWeight, maxWeight = 4, 40
+
+	weights := make([]float64, len(t.Headers))
+	for i, h := range t.Headers {
+		weights[i] = float64(utf8.RuneCountInString(h))
+	}
+	for _, row := range t.Rows {
+		for i := range t.Headers {
+			if i < len(row) {
+				if l := float64(utf8.RuneCountInString(row[i])); l > weights[i] {
+					weights[i] = l
+				}
+			}
+		}
+	}
+
+	var sum float64
+	for i := range weights {
+		if weights[i] < minWeight {
+			weights[i] = minWeight
+		}
+		if weights[i] > maxWeight {
+			weights[i] = maxWeight
+		}
+		sum += weights[i]
+	}
+
+	widths := make([]float64, len(weights))
+	for i := range weights {
+		widths[i] = total * weights[i] / sum
+	}
+	return widths
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore хранит счётчики в памяти процесса. Подходит для одного
+// экземпляра: у каждой реплики были бы свои счётчики.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+}
+
+type counter struct {
+	windowStart time.Time
+	count       int
+	expiresAt   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]*counter)}
+}
+
+func (s *MemoryStore) Hit(_ context.Context, key string, windowStart, expiresAt time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok || !c.windowStart.Equal(windowStart) {
+		c = &counter{windowStart: windowStart, expiresAt: expiresAt}
+		s.counters[key] = c
+	}
+	c.count++
+	return c.count, nil
+}
+
+func (s *MemoryStore) PurgeExpired(_ context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for key, c := range s.counters {
+		if !c.expiresAt.After(now) {
+			delete(s.counters, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
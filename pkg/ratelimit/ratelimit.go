@@ -0,0 +1,116 @@
+// Package ratelimit считает запросы в фиксированных окнах. Счётчики хранятся
+// в Store: в памяти процесса или в общей базе, если реплик несколько.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Виды ключей, по которым считаются запросы
+const (
+	ByIP     = "ip"
+	ByUser   = "user"
+	ByDevice = "device"
+)
+
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// Rule — ограничение для одного вида ключа
+type Rule struct {
+	By    string
+	Limit Limit
+}
+
+// ParseRules разбирает правила вида "ip:20/1m,user:100/1m"; пустая строка — без ограничений
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		by, limit, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("rule %q: want <ip|user|device>:<requests>/<window>", part)
+		}
+		if by != ByIP && by != ByUser && by != ByDevice {
+			return nil, fmt.Errorf("rule %q: unknown key %q, want ip, user or device", part, by)
+		}
+		requests, window, ok := strings.Cut(limit, "/")
+		if !ok {
+			return nil, fmt.Errorf("rule %q: want <requests>/<window>, e.g. 20/1m", part)
+		}
+		n, err := strconv.Atoi(requests)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("rule %q: requests must be a positive number", part)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("rule %q: window must be a duration of at least 1s", part)
+		}
+		rules = append(rules, Rule{By: by, Limit: Limit{Requests: n, Window: d}})
+	}
+	return rules, nil
+}
+
+// Store увеличивает счётчик ключа в окне windowStart и возвращает новое значение.
+// Счётчик прошлого окна сбрасывается.
+type Store interface {
+	Hit(ctx context.Context, key string, windowStart, expiresAt time.Time) (int, error)
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset — начало следующего окна
+	Reset time.Time
+}
+
+type Limiter struct {
+	store Store
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	windowStart := now.Truncate(limit.Window)
+	reset := windowStart.Add(limit.Window)
+
+	count, err := l.store.Hit(ctx, key, windowStart, reset)
+	if err != nil {
+		return Result{}, err
+	}
+
+	remaining := limit.Requests - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{
+		Allowed:   count <= limit.Requests,
+		Limit:     limit.Requests,
+		Remaining: remaining,
+		Reset:     reset,
+	}, nil
+}
+
+// Purge удаляет счётчики истёкших окон; вызывается планировщиком
+func (l *Limiter) Purge(ctx context.Context, now time.Time) error {
+	_, err := l.store.PurgeExpired(ctx, now)
+	return err
+}
@@ -0,0 +1,45 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileRegistry держит в памяти реестр из JSON-файла вида
+// [{"tax_id": "301234567", "name": "OOO Vipos", "active": true}]
+type FileRegistry struct {
+	companies map[string]Company
+}
+
+func NewFileRegistry(path string) (*FileRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry file: %w", err)
+	}
+
+	var companies []Company
+	if err := json.Unmarshal(data, &companies); err != nil {
+		return nil, fmt.Errorf("failed to parse registry file %s: %w", path, err)
+	}
+
+	r := &FileRegistry{companies: make(map[string]Company, len(companies))}
+	for _, c := range companies {
+		r.companies[c.TaxID] = c
+	}
+	return r, nil
+}
+
+func (r *FileRegistry) Lookup(ctx context.Context, taxID string) (*Company, error) {
+	c, ok := r.companies[taxID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &c, nil
+}
+
+// Len — количество компаний в реестре
+func (r *FileRegistry) Len() int {
+	return len(r.companies)
+}
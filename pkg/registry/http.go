@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPRegistry обращается к внешнему реестру: GET {baseURL}/companies/{taxID},
+// 404 означает, что компании нет
+type HTTPRegistry struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPRegistry(baseURL string, timeout time.Duration) (*HTTPRegistry, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid registry url %q", baseURL)
+	}
+	return &HTTPRegistry{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (r *HTTPRegistry) Lookup(ctx context.Context, taxID string) (*Company, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/companies/"+url.PathEscape(taxID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		io.Copy(io.Discard, resp.Body)
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("registry responded with status %d", resp.StatusCode)
+	}
+
+	var c Company
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return nil, fmt.Errorf("failed to decode registry response: %w", err)
+	}
+	return &c, nil
+}
+
+// Handler отдаёт реестр по тому же протоколу, что ожидает HTTPRegistry.
+// Используется мок-сервером реестра для разработки и стендов.
+func Handler(reg Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		taxID, ok := strings.CutPrefix(r.URL.Path, "/companies/")
+		if r.Method != http.MethodGet || !ok || taxID == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		c, err := reg.Lookup(r.Context(), taxID)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.NotFound(w, r)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+	})
+}
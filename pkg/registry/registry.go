@@ -0,0 +1,37 @@
+// Package registry ищет компании в реестре налогоплательщиков по ИНН или ПИНФЛ.
+package registry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("company not found in registry")
+
+// Company — запись реестра
+type Company struct {
+	TaxID string `json:"tax_id"`
+	Name  string `json:"name"`
+	// Active — налогоплательщик не ликвидирован
+	Active bool `json:"active"`
+}
+
+// Registry возвращает компанию по идентификатору или ErrNotFound
+type Registry interface {
+	Lookup(ctx context.Context, taxID string) (*Company, error)
+}
+
+// Open выбирает реализацию по source: http(s)-адрес — внешний реестр,
+// иначе путь к JSON-файлу. Пустой source — реестр не настроен, возвращается nil.
+func Open(source string, timeout time.Duration) (Registry, error) {
+	switch {
+	case source == "":
+		return nil, nil
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return NewHTTPRegistry(source, timeout)
+	default:
+		return NewFileRegistry(source)
+	}
+}
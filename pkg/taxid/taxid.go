@@ -0,0 +1,103 @@
+// Package taxid проверяет идентификаторы налогоплательщиков Узбекистана:
+// ИНН юридического лица (9 цифр) и ПИНФЛ физического лица (14 цифр).
+package taxid
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Kind string
+
+const (
+	KindINN   Kind = "inn"
+	KindPINFL Kind = "pinfl"
+)
+
+const (
+	innLength   = 9
+	pinflLength = 14
+)
+
+// IsINN — 9 цифр, ИНН не начинается с нуля
+func IsINN(s string) bool {
+	return len(s) == innLength && digits(s) && s[0] != '0'
+}
+
+// IsPINFL проверяет длину и структуру ПИНФЛ: первая цифра кодирует пол и век
+// рождения (1–6), следующие шесть — дату рождения ДДММГГ
+func IsPINFL(s string) bool {
+	if len(s) != pinflLength || !digits(s) {
+		return false
+	}
+
+	var century int
+	switch s[0] {
+	case '1', '2':
+		century = 1800
+	case '3', '4':
+		century = 1900
+	case '5', '6':
+		century = 2000
+	default:
+		return false
+	}
+
+	day := atoi(s[1:3])
+	month := atoi(s[3:5])
+	year := century + atoi(s[5:7])
+	birth := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	// time.Date нормализует 31.02 в 03.03, поэтому сверяем компоненты
+	return birth.Day() == day && int(birth.Month()) == month && birth.Year() == year
+}
+
+// KindOf определяет вид идентификатора; пустая строка — идентификатор некорректен
+func KindOf(s string) Kind {
+	switch {
+	case IsINN(s):
+		return KindINN
+	case IsPINFL(s):
+		return KindPINFL
+	}
+	return ""
+}
+
+// Valid — ИНН или ПИНФЛ
+func Valid(s string) bool {
+	return KindOf(s) != ""
+}
+
+// SameCompany сравнивает названия без учёта регистра, кавычек и лишних пробелов:
+// `OOO "Vipos"` и `ooo «VIPOS»` — одна компания
+func SameCompany(a, b string) bool {
+	return NormalizeCompanyName(a) == NormalizeCompanyName(b)
+}
+
+func NormalizeCompanyName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '"', '\'', '«', '»', '“', '”', '`':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func atoi(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n = n*10 + int(s[i]-'0')
+	}
+	return n
+}
@@ -0,0 +1,62 @@
+package xlsx
+
+import (
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type SaveOptions struct {
+	// Password шифрует файл (ECMA-376); без пароля файл не откроется
+	Password string
+	// Stamp печатается в колонтитулах каждого листа и сохраняется в свойствах
+	// документа, чтобы по утёкшему файлу можно было найти выгрузку
+	Stamp string
+}
+
+func Save(f *excelize.File, w io.Writer, opts SaveOptions) error {
+	if opts.Stamp != "" {
+		stamp := headerText(opts.Stamp, 200)
+		for _, sheet := range f.GetSheetList() {
+			err := f.SetHeaderFooter(sheet, &excelize.HeaderFooterOptions{
+				OddHeader: "&R&8" + stamp,
+				OddFooter: "&L&8" + stamp + "&R&8&P / &N",
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := f.SetDocProps(&excelize.DocProperties{Description: opts.Stamp}); err != nil {
+			return err
+		}
+	}
+
+	if opts.Password != "" {
+		return f.Write(w, excelize.Options{Password: opts.Password})
+	}
+	return f.Write(w)
+}
+
+// headerText экранирует "&" (в колонтитулах это управляющий символ) и обрезает
+// текст по символам так, чтобы с экранированием он не превышал limit
+func headerText(s string, limit int) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := 1
+		if r == '&' {
+			size = 2
+		}
+		if n+size > limit {
+			break
+		}
+		n += size
+		if r == '&' {
+			b.WriteString("&&")
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,286 @@
+package xlsx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Formula — значение ячейки, которое записывается как формула, а не как текст
+type Formula string
+
+type Column struct {
+	Key   string
+	Title string
+	Width float64
+}
+
+// Link превращает значение колонки в гиперссылку на строку другого листа,
+// у которой в колонке Key то же значение
+type Link struct {
+	Sheet string
+	Key   string
+}
+
+type Sheet struct {
+	Name    string
+	Columns []Column
+	Rows    []map[string]interface{}
+	Links   map[string]Link
+}
+
+type Workbook struct {
+	sheets []*Sheet
+	byName map[string]*Sheet
+}
+
+func NewWorkbook() *Workbook {
+	return &Workbook{byName: make(map[string]*Sheet)}
+}
+
+// AddSheet добавляет лист. Если колонки не заданы, они собираются из строк:
+// сначала "id", затем остальные по алфавиту.
+func (wb *Workbook) AddSheet(sheet *Sheet) error {
+	if sheet.Name == "" || len([]rune(sheet.Name)) > 31 {
+		return fmt.Errorf("invalid sheet name %q", sheet.Name)
+	}
+	if _, exists := wb.byName[sheet.Name]; exists {
+		return fmt.Errorf("sheet %q already exists", sheet.Name)
+	}
+
+	if len(sheet.Columns) == 0 {
+		for _, key := range sortedKeys(sheet.Rows) {
+			sheet.Columns = append(sheet.Columns, Column{Key: key})
+		}
+	}
+	for i := range sheet.Columns {
+		if sheet.Columns[i].Title == "" {
+			sheet.Columns[i].Title = HeaderTitle(sheet.Columns[i].Key)
+		}
+	}
+
+	wb.sheets = append(wb.sheets, sheet)
+	wb.byName[sheet.Name] = sheet
+	return nil
+}
+
+// ColumnRange возвращает абсолютную ссылку на данные колонки листа,
+// например 'Терминалы'!$C$2:$C$120, для использования в формулах
+func (wb *Workbook) ColumnRange(sheetName, key string) (string, error) {
+	sheet, ok := wb.byName[sheetName]
+	if !ok {
+		return "", fmt.Errorf("sheet %q not found", sheetName)
+	}
+
+	col := sheet.columnIndex(key)
+	if col < 0 {
+		return "", fmt.Errorf("column %q not found on sheet %q", key, sheetName)
+	}
+
+	name, err := excelize.ColumnNumberToName(col + 1)
+	if err != nil {
+		return "", err
+	}
+
+	lastRow := len(sheet.Rows) + 1
+	if lastRow < 2 {
+		lastRow = 2
+	}
+
+	return fmt.Sprintf("%s!$%s$2:$%s$%d", quoteSheetName(sheetName), name, name, lastRow), nil
+}
+
+func (wb *Workbook) Build() (*excelize.File, error) {
+	if len(wb.sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+
+	index, err := wb.buildLinkIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	f := excelize.NewFile()
+
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"DDEBF7"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	linkStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Color: "0563C1", Underline: "single"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, sheet := range wb.sheets {
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", sheet.Name); err != nil {
+				return nil, err
+			}
+		} else if _, err := f.NewSheet(sheet.Name); err != nil {
+			return nil, err
+		}
+
+		if err := wb.writeSheet(f, sheet, index, headerStyle, linkStyle); err != nil {
+			return nil, fmt.Errorf("failed to write sheet %q: %w", sheet.Name, err)
+		}
+	}
+
+	f.SetActiveSheet(0)
+	return f, nil
+}
+
+func (wb *Workbook) writeSheet(f *excelize.File, sheet *Sheet, index map[Link]map[string]int, headerStyle, linkStyle int) error {
+	for col, column := range sheet.Columns {
+		cell, err := excelize.CoordinatesToCellName(col+1, 1)
+		if err != nil {
+			return err
+		}
+		if err := f.SetCellValue(sheet.Name, cell, column.Title); err != nil {
+			return err
+		}
+
+		if column.Width > 0 {
+			name, _ := excelize.ColumnNumberToName(col + 1)
+			if err := f.SetColWidth(sheet.Name, name, name, column.Width); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(sheet.Columns) > 0 {
+		lastHeader, _ := excelize.CoordinatesToCellName(len(sheet.Columns), 1)
+		if err := f.SetCellStyle(sheet.Name, "A1", lastHeader, headerStyle); err != nil {
+			return err
+		}
+		// Закрепляем строку заголовков
+		if err := f.SetPanes(sheet.Name, &excelize.Panes{
+			Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft",
+		}); err != nil {
+			return err
+		}
+	}
+
+	for row, item := range sheet.Rows {
+		for col, column := range sheet.Columns {
+			cell, err := excelize.CoordinatesToCellName(col+1, row+2)
+			if err != nil {
+				return err
+			}
+
+			value := item[column.Key]
+			if formula, ok := value.(Formula); ok {
+				if err := f.SetCellFormula(sheet.Name, cell, strings.TrimPrefix(string(formula), "=")); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := f.SetCellValue(sheet.Name, cell, value); err != nil {
+				return err
+			}
+
+			link, ok := sheet.Links[column.Key]
+			if !ok || value == nil {
+				continue
+			}
+			targetRow, ok := index[link][fmt.Sprint(value)]
+			if !ok {
+				continue
+			}
+			location := fmt.Sprintf("%s!A%d", quoteSheetName(link.Sheet), targetRow)
+			if err := f.SetCellHyperLink(sheet.Name, cell, location, "Location"); err != nil {
+				return err
+			}
+			if err := f.SetCellStyle(sheet.Name, cell, cell, linkStyle); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// buildLinkIndex для каждой цели ссылок строит отображение значения в номер строки
+func (wb *Workbook) buildLinkIndex() (map[Link]map[string]int, error) {
+	index := make(map[Link]map[string]int)
+
+	for _, sheet := range wb.sheets {
+		for key, link := range sheet.Links {
+			if sheet.columnIndex(key) < 0 {
+				return nil, fmt.Errorf("link column %q not found on sheet %q", key, sheet.Name)
+			}
+			if _, done := index[link]; done {
+				continue
+			}
+
+			target, ok := wb.byName[link.Sheet]
+			if !ok {
+				return nil, fmt.Errorf("link target sheet %q not found", link.Sheet)
+			}
+
+			rows := make(map[string]int, len(target.Rows))
+			for i, item := range target.Rows {
+				value, ok := item[link.Key]
+				if !ok || value == nil {
+					continue
+				}
+				if _, dup := rows[fmt.Sprint(value)]; !dup {
+					rows[fmt.Sprint(value)] = i + 2
+				}
+			}
+			index[link] = rows
+		}
+	}
+
+	return index, nil
+}
+
+func (s *Sheet) columnIndex(key string) int {
+	for i, column := range s.Columns {
+		if column.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func quoteSheetName(name string) string {
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
+
+// HeaderTitle возвращает русское название колонки, если оно известно
+func HeaderTitle(key string) string {
+	if translation, ok := headerTranslations[key]; ok {
+		return translation
+	}
+	return key
+}
+
+// sortedKeys собирает все ключи строк: "id" первым, остальные по алфавиту
+func sortedKeys(data []map[string]interface{}) []string {
+	headers := make(map[string]bool)
+	for _, item := range data {
+		for key := range item {
+			headers[key] = true
+		}
+	}
+
+	var keys []string
+	hasID := headers["id"]
+	delete(headers, "id")
+	for header := range headers {
+		keys = append(keys, header)
+	}
+	sort.Strings(keys)
+
+	if hasID {
+		keys = append([]string{"id"}, keys...)
+	}
+	return keys
+}
@@ -2,7 +2,6 @@ package xlsx
 
 import (
 	"fmt"
-	"sort"
 
 	"github.com/xuri/excelize/v2"
 )
@@ -75,45 +74,10 @@ func WriteXLSX(data []map[string]interface{}) (*excelize.File, error) {
 		return nil, fmt.Errorf("no data to export")
 	}
 
-	f := excelize.NewFile()
-	sheet := "Sheet1"
-
-	// Собираем все возможные заголовки
-	headers := make(map[string]bool)
-	for _, item := range data {
-		for key := range item {
-			headers[key] = true
-		}
-	}
-
-	// Сортируем заголовки, но "id" должен быть первым
-	var sortedHeaders []string
-	if headers["id"] {
-		sortedHeaders = append(sortedHeaders, "id")
-		delete(headers, "id")
-	}
-	for header := range headers {
-		sortedHeaders = append(sortedHeaders, header)
-	}
-	sort.Strings(sortedHeaders[1:]) // Сортируем все, кроме первого элемента (id)
-
-	// Записываем заголовки
-	for col, header := range sortedHeaders {
-		cell := fmt.Sprintf("%s1", string(rune('A'+col)))
-		translation, ok := headerTranslations[header]
-		if !ok {
-			translation = header
-		}
-		f.SetCellValue(sheet, cell, translation)
-	}
-
-	// Записываем данные
-	for row, item := range data {
-		for col, header := range sortedHeaders {
-			cell := fmt.Sprintf("%s%d", string(rune('A'+col)), row+2)
-			f.SetCellValue(sheet, cell, item[header])
-		}
+	wb := NewWorkbook()
+	if err := wb.AddSheet(&Sheet{Name: "Sheet1", Rows: data}); err != nil {
+		return nil, err
 	}
 
-	return f, nil
+	return wb.Build()
 }